@@ -0,0 +1,27 @@
+package main
+
+import (
+	"crypto/subtle"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requireAdmin protege los endpoints de administración con el token de
+// ADMIN_TOKEN enviado como "Authorization: Bearer <token>". Si ADMIN_TOKEN
+// no está definido los endpoints quedan deshabilitados.
+func requireAdmin(c *gin.Context) {
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" {
+		c.AbortWithStatusJSON(403, gin.H{"error": "endpoint de administración deshabilitado: defina ADMIN_TOKEN"})
+		return
+	}
+
+	provided, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+		c.AbortWithStatusJSON(401, gin.H{"error": "token de administración inválido"})
+		return
+	}
+	c.Next()
+}
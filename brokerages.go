@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/JuanVel1/stock-api/store"
+)
+
+// getBrokerages devuelve los brókers con su reputación y sus alias
+func getBrokerages(c *gin.Context) {
+	brokerages, err := store.ListBrokerages(c.Request.Context(), db)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"data": brokerages})
+}
+
+// mergeBrokeragesRequest es el cuerpo de POST /api/brokerages/:id/merge
+type mergeBrokeragesRequest struct {
+	Brokerages []string `json:"brokerages"`
+	Aliases    []string `json:"aliases"`
+}
+
+// mergeBrokerages fusiona otros brókers y nombres sueltos en el bróker :id
+func mergeBrokerages(c *gin.Context) {
+	id := c.Param("id")
+	if !uuidPattern.MatchString(id) {
+		c.JSON(400, gin.H{"error": "id de bróker inválido"})
+		return
+	}
+
+	var req mergeBrokeragesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	for _, source := range req.Brokerages {
+		if !uuidPattern.MatchString(source) {
+			c.JSON(400, gin.H{"error": "id de bróker inválido: " + source})
+			return
+		}
+	}
+
+	merged, err := store.MergeBrokerages(c.Request.Context(), db, id, req.Brokerages, req.Aliases)
+	switch {
+	case errors.Is(err, store.ErrBrokerageNotFound):
+		c.JSON(404, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, store.ErrInvalidMerge):
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	// Las recomendaciones deben ver la fusión sin esperar referenceDataTTL
+	reloadReferenceData(c.Request.Context(), requestLog(c))
+
+	c.JSON(200, merged)
+}
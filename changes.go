@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/JuanVel1/stock-api/store"
+)
+
+// defaultChangesSettleWindow es la ventana por defecto durante la que un
+// cambio recién detectado no se devuelve (ver store.StockChangeFilter)
+const defaultChangesSettleWindow = time.Minute
+
+// changesSettleWindow lee CHANGES_SETTLE_WINDOW (ej. "30s"); debe superar la
+// duración de las transacciones de save y de POST /api/ingest
+func changesSettleWindow() time.Duration {
+	if window, err := time.ParseDuration(os.Getenv("CHANGES_SETTLE_WINDOW")); err == nil && window >= 0 {
+		return window
+	}
+	return defaultChangesSettleWindow
+}
+
+// getChanges devuelve los cambios detectados por las sincronizaciones después
+// de ?since= (RFC3339, exclusivo), los más antiguos primero. Se puede filtrar
+// por ?type= (inserted, updated, disappeared) y ?ticker=, y paginar con next
+// y limit o con ?cursor=, el next_cursor de la respuesta anterior. Los cambios
+// aparecen recién pasada la ventana de changesSettleWindow, para que el
+// cursor no saltee los de transacciones que confirmaron tarde.
+func getChanges(c *gin.Context) {
+	filter := store.StockChangeFilter{SettleWindow: changesSettleWindow()}
+	if since := c.Query("since"); since != "" {
+		parsed, err := time.Parse(time.RFC3339Nano, since)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "since debe ser una fecha RFC3339, ej. 2025-01-13T00:00:00Z"})
+			return
+		}
+		filter.Since = parsed
+	}
+
+	filter.ChangeType = c.Query("type")
+	switch filter.ChangeType {
+	case "", store.ChangeInserted, store.ChangeUpdated, store.ChangeDisappeared:
+	default:
+		c.JSON(400, gin.H{"error": "type debe ser inserted, updated o disappeared"})
+		return
+	}
+	filter.Ticker = c.Query("ticker")
+	if cursor := c.Query("cursor"); cursor != "" {
+		parsed, err := store.ParseChangeCursor(cursor)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "cursor debe ser el next_cursor de una respuesta anterior"})
+			return
+		}
+		filter.After = &parsed
+	}
+
+	nextNum := 0
+	limitNum := 100
+
+	if n, err := strconv.Atoi(c.DefaultQuery("next", "0")); err == nil && n >= 0 {
+		nextNum = n
+	}
+	if l, err := strconv.Atoi(c.DefaultQuery("limit", "100")); err == nil && l > 0 && l <= 1000 {
+		limitNum = l
+	}
+
+	total, err := store.CountStockChanges(c.Request.Context(), db, filter)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	changes, err := store.ListStockChanges(c.Request.Context(), db, filter, nextNum, limitNum)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Sin cambios nuevos se devuelve el mismo cursor para seguir consultando
+	nextCursor := c.Query("cursor")
+	if len(changes) > 0 {
+		nextCursor = store.CursorOf(changes[len(changes)-1]).String()
+	}
+
+	c.JSON(200, gin.H{
+		"data": changes,
+		"pagination": gin.H{
+			"current_offset": nextNum,
+			"per_page":       limitNum,
+			"total":          total,
+			"has_more":       (nextNum + limitNum) < total,
+			"next_offset":    nextNum + limitNum,
+			"next_cursor":    nextCursor,
+		},
+	})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/JuanVel1/stock-api/store"
+)
+
+// getDataQuality devuelve los reportes de calidad de datos de las ejecuciones,
+// paginados igual que /api/sync-runs; con ?run_id= devuelve el de una ejecución
+func getDataQuality(c *gin.Context) {
+	if runID := c.Query("run_id"); runID != "" {
+		if !uuidPattern.MatchString(runID) {
+			c.JSON(400, gin.H{"error": "id de ejecución inválido"})
+			return
+		}
+
+		report, err := store.GetQualityReport(c.Request.Context(), db, runID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if report == nil {
+			c.JSON(404, gin.H{"error": "reporte de calidad no encontrado"})
+			return
+		}
+		c.JSON(200, report)
+		return
+	}
+
+	nextNum := 0
+	limitNum := 20
+
+	if n, err := strconv.Atoi(c.DefaultQuery("next", "0")); err == nil && n >= 0 {
+		nextNum = n
+	}
+	if l, err := strconv.Atoi(c.DefaultQuery("limit", "20")); err == nil && l > 0 && l <= 100 {
+		limitNum = l
+	}
+
+	total, err := store.CountQualityReports(c.Request.Context(), db)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	reports, err := store.ListQualityReports(c.Request.Context(), db, nextNum, limitNum)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"data": reports,
+		"pagination": gin.H{
+			"current_offset": nextNum,
+			"per_page":       limitNum,
+			"total":          total,
+			"has_more":       (nextNum + limitNum) < total,
+			"next_offset":    nextNum + limitNum,
+		},
+	})
+}
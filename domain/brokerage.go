@@ -0,0 +1,133 @@
+package domain
+
+import (
+	"strings"
+	"time"
+)
+
+// DefaultReputation es el puntaje de los brókers sin reputación asignada
+const DefaultReputation = 0.9
+
+// UnknownBrokerage es el bróker de los registros que llegan sin nombre de
+// bróker; lo crea la migración 0012_create_rating_events
+const UnknownBrokerage = "Unknown"
+
+// Brokerage es un bróker con su nombre canónico y los nombres con los que
+// aparece en las fuentes
+type Brokerage struct {
+	ID         string    `db:"id" json:"id"`
+	Name       string    `db:"name" json:"name"`
+	Reputation float64   `db:"reputation" json:"reputation"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt  time.Time `db:"updated_at" json:"updated_at"`
+	Aliases    []string  `db:"-" json:"aliases"`
+}
+
+// DefaultBrokerages son los brókers con reputación conocida; la migración
+// 0010_create_brokerages carga la misma lista en las tablas brokerages y
+// brokerage_aliases
+var DefaultBrokerages = []Brokerage{
+	{Name: "The Goldman Sachs Group", Reputation: 1.2},
+	{Name: "Morgan Stanley", Reputation: 1.1},
+	{Name: "JPMorgan Chase & Co.", Reputation: 1.15, Aliases: []string{"JP Morgan"}},
+	{Name: "Citigroup", Reputation: 1.05, Aliases: []string{"Citi"}},
+	{Name: "Benchmark", Reputation: 1.0},
+	{Name: "Needham & Company LLC", Reputation: 0.95},
+	{Name: "Wedbush", Reputation: 0.98},
+	{Name: "Truist Financial", Reputation: 0.97, Aliases: []string{"Truist Securities"}},
+}
+
+// brokerageNoise son las palabras que no distinguen a un bróker
+var brokerageNoise = map[string]bool{
+	"the": true, "inc": true, "llc": true, "co": true, "corp": true,
+	"corporation": true, "company": true, "ltd": true, "plc": true,
+	"lp": true, "group": true, "securities": true, "and": true,
+}
+
+// BrokerageKey es la clave con la que se comparan los nombres de bróker: sin
+// mayúsculas, puntuación, espacios ni sufijos societarios, de modo que
+// "J.P. Morgan", "JP Morgan" y "JPMorgan" coinciden
+func BrokerageKey(name string) string {
+	name = strings.ToLower(name)
+	name = strings.NewReplacer(".", "", ",", "", "'", "", "&", " ", "-", " ").Replace(name)
+
+	var words []string
+	for _, word := range strings.Fields(name) {
+		if !brokerageNoise[word] {
+			words = append(words, word)
+		}
+	}
+	return strings.Join(words, "")
+}
+
+// BrokerageName devuelve name, o UnknownBrokerage si el nombre no tiene
+// ninguna palabra que identifique a un bróker
+func BrokerageName(name string) string {
+	if BrokerageKey(name) == "" {
+		return UnknownBrokerage
+	}
+	return name
+}
+
+// BrokerageDirectory resuelve nombres de bróker a su registro canónico
+type BrokerageDirectory struct {
+	byKey map[string]*Brokerage
+}
+
+// NewBrokerageDirectory indexa los brókers por su nombre y sus alias
+func NewBrokerageDirectory(brokerages []Brokerage) *BrokerageDirectory {
+	d := &BrokerageDirectory{byKey: make(map[string]*Brokerage)}
+	for i := range brokerages {
+		d.add(brokerages[i])
+	}
+	return d
+}
+
+var defaultBrokerageDirectory = NewBrokerageDirectory(DefaultBrokerages)
+
+// DefaultBrokerageDirectory devuelve el directorio de DefaultBrokerages
+func DefaultBrokerageDirectory() *BrokerageDirectory {
+	return defaultBrokerageDirectory
+}
+
+func (d *BrokerageDirectory) add(b Brokerage) {
+	brokerage := &b
+	d.byKey[BrokerageKey(b.Name)] = brokerage
+	for _, alias := range b.Aliases {
+		d.byKey[BrokerageKey(alias)] = brokerage
+	}
+}
+
+// Resolve busca el bróker de un nombre tal como aparece en la fuente
+func (d *BrokerageDirectory) Resolve(name string) (Brokerage, bool) {
+	key := BrokerageKey(name)
+	if key == "" {
+		return Brokerage{}, false
+	}
+	b, ok := d.byKey[key]
+	if !ok {
+		return Brokerage{}, false
+	}
+	return *b, true
+}
+
+// AssignIDs completa el BrokerageID de los registros; los registros sin
+// nombre de bróker van a UnknownBrokerage y los de brókers desconocidos
+// quedan sin id
+func (d *BrokerageDirectory) AssignIDs(stocks []Stock) {
+	for i := range stocks {
+		if b, ok := d.Resolve(BrokerageName(stocks[i].Brokerage)); ok {
+			stocks[i].BrokerageID = b.ID
+		} else {
+			stocks[i].BrokerageID = ""
+		}
+	}
+}
+
+// Reputation devuelve la reputación del bróker o DefaultReputation si no se conoce
+func (d *BrokerageDirectory) Reputation(name string) float64 {
+	if b, ok := d.Resolve(name); ok {
+		return b.Reputation
+	}
+	return DefaultReputation
+}
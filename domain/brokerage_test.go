@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestBrokerageKey verifica que las variantes de un nombre compartan clave
+func TestBrokerageKey(t *testing.T) {
+	assert.Equal(t, "jpmorgan", BrokerageKey("J.P. Morgan"))
+	assert.Equal(t, "jpmorgan", BrokerageKey("JP Morgan"))
+	assert.Equal(t, "jpmorgan", BrokerageKey("JPMorgan"))
+	assert.Equal(t, "goldmansachs", BrokerageKey("The Goldman Sachs Group, Inc."))
+	assert.Equal(t, "needham", BrokerageKey("Needham & Company LLC"))
+	assert.Empty(t, BrokerageKey(" Inc. "))
+}
+
+// TestBrokerageReputation verifica la resolución de alias y el valor por defecto
+func TestBrokerageReputation(t *testing.T) {
+	directory := DefaultBrokerageDirectory()
+
+	assert.Equal(t, 1.15, directory.Reputation("J.P. Morgan"))
+	assert.Equal(t, 1.15, directory.Reputation("JPMorgan Chase & Co."))
+	assert.Equal(t, 1.2, directory.Reputation("Goldman Sachs"))
+	assert.Equal(t, DefaultReputation, directory.Reputation("Broker Desconocido"))
+	assert.Equal(t, DefaultReputation, directory.Reputation(""))
+
+	b, ok := directory.Resolve("Truist Securities")
+	assert.True(t, ok)
+	assert.Equal(t, "Truist Financial", b.Name)
+}
+
+// TestBrokerageName verifica que los nombres vacíos vayan a UnknownBrokerage
+func TestBrokerageName(t *testing.T) {
+	assert.Equal(t, "Citi", BrokerageName("Citi"))
+	assert.Equal(t, UnknownBrokerage, BrokerageName(""))
+	assert.Equal(t, UnknownBrokerage, BrokerageName(" Inc. "))
+}
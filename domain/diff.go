@@ -0,0 +1,61 @@
+package domain
+
+import "time"
+
+// FieldChange es el valor anterior y el nuevo de un campo
+type FieldChange struct {
+	Old any `json:"old"`
+	New any `json:"new"`
+}
+
+// DiffStocks compara dos versiones de un registro con la misma clave
+// (ticker, bróker y time) y devuelve los campos que cambiaron, con el nombre
+// JSON del campo como clave. Del origen solo compara la fuente: una nueva
+// lectura de la misma fuente no es un cambio. No compara company: el nombre
+// vive en companies, uno por ticker, y no es parte del evento. Devuelve nil
+// si son iguales.
+func DiffStocks(previous, current Stock) map[string]FieldChange {
+	diff := make(map[string]FieldChange)
+	compare := func(field string, before, after any) {
+		if before != after {
+			diff[field] = FieldChange{Old: before, New: after}
+		}
+	}
+
+	compare("brokerage", previous.Brokerage, current.Brokerage)
+	compare("action", previous.Action, current.Action)
+	compare("rating_from", previous.RatingFrom, current.RatingFrom)
+	compare("rating_to", previous.RatingTo, current.RatingTo)
+	if !sameMoney(previous.TargetFrom, current.TargetFrom) {
+		diff["target_from"] = FieldChange{Old: previous.TargetFrom, New: current.TargetFrom}
+	}
+	if !sameMoney(previous.TargetTo, current.TargetTo) {
+		diff["target_to"] = FieldChange{Old: previous.TargetTo, New: current.TargetTo}
+	}
+	compare("normalized_action", previous.NormalizedAction, current.NormalizedAction)
+	compare("normalized_rating_from", previous.NormalizedRatingFrom, current.NormalizedRatingFrom)
+	compare("normalized_rating_to", previous.NormalizedRatingTo, current.NormalizedRatingTo)
+	compare("source_id", previous.SourceID, current.SourceID)
+	if !sameTime(previous.DisappearedAt, current.DisappearedAt) {
+		diff["disappeared_at"] = FieldChange{Old: previous.DisappearedAt, New: current.DisappearedAt}
+	}
+
+	if len(diff) == 0 {
+		return nil
+	}
+	return diff
+}
+
+func sameMoney(a, b *Money) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
@@ -0,0 +1,65 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDiffStocks verifica las diferencias campo a campo entre dos versiones
+func TestDiffStocks(t *testing.T) {
+	old := Stock{Ticker: "AAPL", Time: "2025-01-13T00:30:05Z", RatingTo: "Buy", TargetTo: Price(180), Brokerage: "Citigroup"}
+	assert.Nil(t, DiffStocks(old, old))
+
+	updated := old
+	updated.RatingTo = "Strong Buy"
+	updated.TargetTo = Price(200)
+	diff := DiffStocks(old, updated)
+	require.Len(t, diff, 2)
+	assert.Equal(t, FieldChange{Old: "Buy", New: "Strong Buy"}, diff["rating_to"])
+	assert.Equal(t, FieldChange{Old: Price(180), New: Price(200)}, diff["target_to"])
+
+	// Un registro que reaparece vuelve a tener disappeared_at en NULL
+	gone := time.Date(2025, 1, 14, 0, 0, 0, 0, time.UTC)
+	old.DisappearedAt = &gone
+	diff = DiffStocks(old, old)
+	assert.Nil(t, diff)
+	reappeared := old
+	reappeared.DisappearedAt = nil
+	diff = DiffStocks(old, reappeared)
+	require.Contains(t, diff, "disappeared_at")
+
+	// El nombre de la empresa es de companies, no del evento
+	renamed := reappeared
+	renamed.Company = "Apple Inc."
+	assert.Nil(t, DiffStocks(reappeared, renamed))
+}
+
+// TestDiffStocksProvenance verifica que solo el cambio de fuente sea un cambio
+func TestDiffStocksProvenance(t *testing.T) {
+	fetched := time.Date(2025, 1, 13, 0, 0, 0, 0, time.UTC)
+	old := Stock{Ticker: "AAPL", Time: "t1", Provenance: Provenance{SourceID: "primary", FetchedAt: &fetched, PageRef: "p1"}}
+
+	refetched := old
+	later := fetched.Add(time.Hour)
+	refetched.FetchedAt = &later
+	refetched.PageRef = "p2"
+	assert.Nil(t, DiffStocks(old, refetched))
+
+	other := old
+	other.SourceID = "backup"
+	assert.Equal(t, map[string]FieldChange{"source_id": {Old: "primary", New: "backup"}}, DiffStocks(old, other))
+}
+
+// TestProvenanceOverrides verifica la resolución de conflictos por prioridad
+func TestProvenanceOverrides(t *testing.T) {
+	primary := Provenance{SourceID: "primary", SourcePriority: 10}
+	backup := Provenance{SourceID: "backup", SourcePriority: 5}
+
+	assert.True(t, primary.Overrides(backup))
+	assert.False(t, backup.Overrides(primary))
+	assert.True(t, backup.Overrides(Provenance{SourceID: "backup", SourcePriority: 20}))
+	assert.True(t, backup.Overrides(Provenance{}))
+}
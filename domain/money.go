@@ -0,0 +1,215 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money es un precio en centavos de dólar. Money(0) es un precio de $0.00:
+// la falta de precio se representa con un *Money nil, que se guarda como NULL
+// y se escribe como null en JSON.
+type Money int64
+
+// MaxPrice es el mayor precio en dólares (en valor absoluto) que entra en
+// las columnas NUMERIC(14,2)
+const MaxPrice = 999999999999.99
+
+// ErrPriceOutOfRange indica un precio no finito (NaN, Inf) o mayor que MaxPrice
+var ErrPriceOutOfRange = errors.New("precio fuera de rango")
+
+// Dollars convierte un monto en dólares a Money redondeando al centavo. No
+// revisa el rango: los montos que vienen de afuera pasan por NewMoney.
+func Dollars(amount float64) Money {
+	return Money(math.Round(amount * 100))
+}
+
+// Price devuelve Dollars(amount) como precio presente de un campo *Money
+func Price(amount float64) *Money {
+	m := Dollars(amount)
+	return &m
+}
+
+// NewMoney es Dollars para montos no confiables: falla con
+// ErrPriceOutOfRange si el monto no es finito o no entra en NUMERIC(14,2)
+func NewMoney(amount float64) (Money, error) {
+	if err := checkPrice(amount); err != nil {
+		return 0, err
+	}
+	return Dollars(amount), nil
+}
+
+// checkPrice verifica que el monto sea finito y no supere MaxPrice
+func checkPrice(amount float64) error {
+	if math.IsNaN(amount) || math.IsInf(amount, 0) || math.Abs(amount) > MaxPrice {
+		return fmt.Errorf("%w: %v", ErrPriceOutOfRange, amount)
+	}
+	return nil
+}
+
+// ParseMoney interpreta un precio como "$1,135.00" usando ParsePriceString;
+// un texto sin precio ("", "null", "N/A") devuelve 0
+func ParseMoney(price string) (Money, error) {
+	amount, err := ParsePriceString(price)
+	if err != nil {
+		return 0, fmt.Errorf("precio inválido %q: %w", price, err)
+	}
+	return Dollars(amount), nil
+}
+
+// ParseOptionalMoney es ParseMoney para los campos *Money: un texto sin
+// precio devuelve nil y "$0.00" un precio de cero
+func ParseOptionalMoney(price string) (*Money, error) {
+	if missingPrice(price) {
+		return nil, nil
+	}
+	m, err := ParseMoney(price)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// missingPrice indica si el texto significa "sin precio": vacío, "null" o
+// "N/A", sin espacios alrededor y sin distinguir mayúsculas. La migración
+// 0005 usa la misma definición al convertir los precios guardados como texto.
+func missingPrice(price string) bool {
+	switch strings.ToUpper(strings.TrimSpace(price)) {
+	case "", "NULL", "N/A":
+		return true
+	}
+	return false
+}
+
+// Float64 devuelve el monto en dólares
+func (m Money) Float64() float64 {
+	return float64(m) / 100
+}
+
+// String formatea el monto como "$135.00"
+func (m Money) String() string {
+	return fmt.Sprintf("$%.2f", m.Float64())
+}
+
+// decimal formatea el monto con dos decimales sin símbolo, ej. "-135.05"
+func (m Money) decimal() string {
+	sign := ""
+	cents := int64(m)
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// Value guarda el monto como NUMERIC; un *Money nil se guarda como NULL
+func (m Money) Value() (driver.Value, error) {
+	return m.decimal(), nil
+}
+
+// Scan lee una columna NUMERIC. NULL deja 0: las columnas que admiten NULL
+// se leen en un *Money, que queda nil.
+func (m *Money) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+	case []byte:
+		return m.scanText(string(v))
+	case string:
+		return m.scanText(v)
+	case float64:
+		return m.set(v)
+	case int64:
+		*m = Money(v * 100)
+	default:
+		return fmt.Errorf("no se puede convertir %T a Money", src)
+	}
+	return nil
+}
+
+func (m *Money) scanText(text string) error {
+	amount, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+	if err != nil {
+		return fmt.Errorf("valor NUMERIC inválido %q", text)
+	}
+	return m.set(amount)
+}
+
+// set guarda amount con NewMoney
+func (m *Money) set(amount float64) error {
+	parsed, err := NewMoney(amount)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// MarshalJSON escribe el monto como número en dólares, ej. 135.5
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.decimal()), nil
+}
+
+// UnmarshalJSON acepta un número (135.5) o un texto con formato de precio ("$135.50")
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*m = 0
+		return nil
+	}
+
+	if len(data) > 0 && data[0] == '"' {
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+		parsed, err := ParseMoney(text)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	}
+
+	var amount float64
+	if err := json.Unmarshal(data, &amount); err != nil {
+		return fmt.Errorf("precio inválido %s", data)
+	}
+	return m.set(amount)
+}
+
+// ParsePriceString convierte un string de precio (ej. "$135.00") a float64.
+// Falla con ErrPriceOutOfRange si el valor no es finito ("NaN", "Inf") o no
+// entra en NUMERIC(14,2), aunque strconv.ParseFloat lo acepte.
+func ParsePriceString(price string) (float64, error) {
+	// Si el precio está vacío o es nulo, retorna 0
+	if missingPrice(price) {
+		return 0, nil
+	}
+
+	// Eliminar el símbolo de dólar, espacios, y comas
+	price = strings.TrimSpace(price)
+	price = strings.ReplaceAll(price, "$", "")
+	price = strings.ReplaceAll(price, ",", "")
+
+	// Convertir a float64
+	amount, err := strconv.ParseFloat(price, 64)
+	if err != nil {
+		return 0, err
+	}
+	if err := checkPrice(amount); err != nil {
+		return 0, err
+	}
+	return amount, nil
+}
+
+// FormatPriceFloat formatea un float64 como un string de precio (ej. "$135.00")
+func FormatPriceFloat(price float64) string {
+	if price == 0 {
+		return ""
+	}
+	return fmt.Sprintf("$%.2f", price)
+}
@@ -0,0 +1,115 @@
+package domain
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseMoney verifica la conversión de textos de precio a centavos
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Money
+		wantErr  bool
+	}{
+		{"$135.00", 13500, false},
+		{"$1,234.56", 123456, false},
+		{" 7.005 ", 701, false},
+		{"", 0, false},
+		{"N/A", 0, false},
+		{" n/a ", 0, false},
+		{"NULL", 0, false},
+		{"$abc", 0, true},
+		{"NaN", 0, true},
+		{"Inf", 0, true},
+		{"-Inf", 0, true},
+		{"1e13", 0, true},
+		{"$999,999,999,999.99", 99999999999999, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := ParseMoney(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+
+	_, err := ParseMoney("1e13")
+	assert.ErrorIs(t, err, ErrPriceOutOfRange)
+}
+
+// TestMoneySQL verifica la lectura y escritura de columnas NUMERIC
+func TestMoneySQL(t *testing.T) {
+	value, err := Money(13505).Value()
+	require.NoError(t, err)
+	assert.Equal(t, "135.05", value)
+
+	value, err = Money(-5).Value()
+	require.NoError(t, err)
+	assert.Equal(t, "-0.05", value)
+
+	// $0.00 es un precio; la falta de precio es un *Money nil
+	value, err = Money(0).Value()
+	require.NoError(t, err)
+	assert.Equal(t, "0.00", value)
+
+	var m Money
+	require.NoError(t, m.Scan([]byte("180.50")))
+	assert.Equal(t, Money(18050), m)
+	require.NoError(t, m.Scan(nil))
+	assert.Equal(t, Money(0), m)
+	assert.Error(t, m.Scan([]byte("$x")))
+	assert.ErrorIs(t, m.Scan(math.Inf(1)), ErrPriceOutOfRange)
+}
+
+// TestMoneyJSON verifica que el JSON acepte números y textos de precio
+func TestMoneyJSON(t *testing.T) {
+	var stock Stock
+	require.NoError(t, json.Unmarshal([]byte(`{"target_from": "$135.00", "target_to": 140.5}`), &stock))
+	assert.Equal(t, Price(135), stock.TargetFrom)
+	assert.Equal(t, Price(140.5), stock.TargetTo)
+	assert.Error(t, json.Unmarshal([]byte(`{"target_to": 1e13}`), &stock))
+	assert.Error(t, json.Unmarshal([]byte(`{"target_to": "NaN"}`), &stock))
+
+	encoded, err := json.Marshal(Money(14050))
+	require.NoError(t, err)
+	assert.Equal(t, "140.50", string(encoded))
+
+	assert.Equal(t, "$140.50", Money(14050).String())
+
+	// Sin precio es null; un precio de cero es 0.00
+	encoded, err = json.Marshal(Stock{TargetTo: Price(0)})
+	require.NoError(t, err)
+	assert.Contains(t, string(encoded), `"target_from":null`)
+	assert.Contains(t, string(encoded), `"target_to":0.00`)
+	var decoded Stock
+	require.NoError(t, json.Unmarshal(encoded, &decoded))
+	assert.Nil(t, decoded.TargetFrom)
+	assert.Equal(t, Price(0), decoded.TargetTo)
+	assert.Equal(t, 140.5, Money(14050).Float64())
+}
+
+// TestRawStockToStock verifica la conversión de registros crudos
+func TestRawStockToStock(t *testing.T) {
+	stock, err := RawStock{Ticker: "AAPL", TargetFrom: "$150.00", TargetTo: "$180.25"}.ToStock()
+	require.NoError(t, err)
+	assert.Equal(t, Price(150), stock.TargetFrom)
+	assert.Equal(t, Price(180.25), stock.TargetTo)
+
+	stock, err = RawStock{Ticker: "AAPL", TargetFrom: "N/A", TargetTo: "$0.00"}.ToStock()
+	require.NoError(t, err)
+	assert.Nil(t, stock.TargetFrom)
+	assert.Equal(t, Price(0), stock.TargetTo)
+
+	_, err = RawStock{Ticker: "AAPL", TargetTo: "ciento"}.ToStock()
+	assert.Error(t, err)
+}
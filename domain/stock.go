@@ -0,0 +1,100 @@
+// Package domain contiene el modelo de recomendaciones compartido por la API
+// y el proceso de sincronización (save).
+package domain
+
+import (
+	"fmt"
+	"time"
+)
+
+// Stock es una recomendación de un bróker sobre una acción: una fila de
+// rating_events con el nombre de la empresa de companies
+type Stock struct {
+	Ticker     string `json:"ticker" db:"ticker"`
+	Company    string `json:"company" db:"company"`
+	Brokerage  string `json:"brokerage" db:"brokerage"`
+	Action     string `json:"action" db:"action"`
+	RatingFrom string `json:"rating_from" db:"rating_from"`
+	RatingTo   string `json:"rating_to" db:"rating_to"`
+	// Precios objetivo; nil si la fuente no los publicó (NULL y null en JSON)
+	TargetFrom *Money `json:"target_from" db:"target_from"`
+	TargetTo   *Money `json:"target_to" db:"target_to"`
+	Time       string `json:"time" db:"time"`
+
+	// BrokerageID es el bróker canónico al que resuelve Brokerage; junto con
+	// Ticker y Time identifica el evento
+	BrokerageID string `json:"brokerage_id" db:"brokerage_id"`
+
+	// Valores canónicos según el vocabulario; vacíos si el texto no se conoce
+	NormalizedAction     string `json:"normalized_action" db:"normalized_action"`
+	NormalizedRatingFrom string `json:"normalized_rating_from" db:"normalized_rating_from"`
+	NormalizedRatingTo   string `json:"normalized_rating_to" db:"normalized_rating_to"`
+
+	// DisappearedAt es cuándo una sincronización completa dejó de ver el
+	// registro en la fuente; vuelve a NULL si reaparece
+	DisappearedAt *time.Time `json:"disappeared_at,omitempty" db:"disappeared_at"`
+
+	Provenance `json:"provenance"`
+}
+
+// Provenance es el origen de un registro: la fuente que lo publicó, con qué
+// prioridad, cuándo se leyó y en qué página venía
+type Provenance struct {
+	SourceID       string     `json:"source_id" db:"source_id"`
+	SourcePriority int        `json:"priority" db:"source_priority"`
+	FetchedAt      *time.Time `json:"fetched_at" db:"fetched_at"`
+	PageRef        string     `json:"page_ref" db:"page_ref"`
+}
+
+// Overrides indica si un registro con este origen puede reemplazar a uno
+// guardado con el origen previous: la misma fuente siempre puede, otra
+// fuente solo con prioridad igual o mayor
+func (p Provenance) Overrides(previous Provenance) bool {
+	return p.SourceID == previous.SourceID || p.SourcePriority >= previous.SourcePriority
+}
+
+// RawStock es una recomendación tal como llega de la API externa o de un
+// archivo, con los precios como texto (ej. "$135.00")
+type RawStock struct {
+	Ticker     string `json:"ticker"`
+	Company    string `json:"company"`
+	Brokerage  string `json:"brokerage"`
+	Action     string `json:"action"`
+	RatingFrom string `json:"rating_from"`
+	RatingTo   string `json:"rating_to"`
+	TargetFrom string `json:"target_from"`
+	TargetTo   string `json:"target_to"`
+	Time       string `json:"time"`
+}
+
+// APIResponse es una página de recomendaciones: la respuesta de la API
+// externa y el cuerpo JSON de POST /api/ingest
+type APIResponse struct {
+	Items    []RawStock `json:"items"`
+	NextPage string     `json:"next_page"`
+}
+
+// ToStock convierte los precios con ParseOptionalMoney; falla si alguno no
+// se puede interpretar
+func (r RawStock) ToStock() (Stock, error) {
+	targetFrom, err := ParseOptionalMoney(r.TargetFrom)
+	if err != nil {
+		return Stock{}, fmt.Errorf("target_from: %v", err)
+	}
+	targetTo, err := ParseOptionalMoney(r.TargetTo)
+	if err != nil {
+		return Stock{}, fmt.Errorf("target_to: %v", err)
+	}
+
+	return Stock{
+		Ticker:     r.Ticker,
+		Company:    r.Company,
+		Brokerage:  r.Brokerage,
+		Action:     r.Action,
+		RatingFrom: r.RatingFrom,
+		RatingTo:   r.RatingTo,
+		TargetFrom: targetFrom,
+		TargetTo:   targetTo,
+		Time:       r.Time,
+	}, nil
+}
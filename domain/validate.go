@@ -0,0 +1,113 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Reglas de validación de un registro antes de guardarlo
+const (
+	RuleMissingTicker  = "missing_ticker"
+	RuleInvalidTime    = "invalid_time"
+	RuleUnknownRating  = "unknown_rating"
+	RuleUnknownAction  = "unknown_action"
+	RuleInvalidTarget  = "invalid_target"
+	RuleNegativeTarget = "negative_target"
+)
+
+// Severity indica si un problema descarta el registro o solo se informa
+type Severity string
+
+const (
+	SeverityReject  Severity = "reject"
+	SeverityWarning Severity = "warning"
+)
+
+// Issue es un problema encontrado en un campo de un registro
+type Issue struct {
+	Rule     string
+	Severity Severity
+	Field    string
+	Value    string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s %s=%q", i.Rule, i.Field, i.Value)
+}
+
+// Validate valida el registro con el vocabulario por defecto
+func Validate(raw RawStock) (Stock, []Issue) {
+	return DefaultVocabulary().Validate(raw)
+}
+
+// Validate revisa un registro y lo convierte a Stock con los campos
+// canónicos completos. Los problemas con severidad reject (ticker vacío, hora
+// que no es RFC3339, precio ilegible, no finito, fuera de rango o negativo)
+// descartan el registro; los ratings y acciones fuera del vocabulario solo se
+// informan porque puntúan como 0 en las recomendaciones.
+func (v *Vocabulary) Validate(raw RawStock) (Stock, []Issue) {
+	var issues []Issue
+	reject := func(rule, field, value string) {
+		issues = append(issues, Issue{Rule: rule, Severity: SeverityReject, Field: field, Value: value})
+	}
+
+	if strings.TrimSpace(raw.Ticker) == "" {
+		reject(RuleMissingTicker, "ticker", raw.Ticker)
+	}
+	if _, err := time.Parse(time.RFC3339, raw.Time); err != nil {
+		reject(RuleInvalidTime, "time", raw.Time)
+	}
+
+	for _, target := range []struct{ field, value string }{
+		{"target_from", raw.TargetFrom},
+		{"target_to", raw.TargetTo},
+	} {
+		price, err := ParsePriceString(target.value)
+		switch {
+		case err != nil:
+			// Incluye ErrPriceOutOfRange: un precio que no entra en
+			// NUMERIC(14,2) haría fallar el lote completo
+			reject(RuleInvalidTarget, target.field, target.value)
+		case price < 0:
+			reject(RuleNegativeTarget, target.field, target.value)
+		}
+	}
+
+	warn := func(rule, field, value string) {
+		issues = append(issues, Issue{Rule: rule, Severity: SeverityWarning, Field: field, Value: value})
+	}
+	for _, rating := range []struct{ field, value string }{
+		{"rating_from", raw.RatingFrom},
+		{"rating_to", raw.RatingTo},
+	} {
+		if _, _, ok := v.Rating(rating.value); rating.value != "" && !ok {
+			warn(RuleUnknownRating, rating.field, rating.value)
+		}
+	}
+	if _, ok := v.Action(raw.Action); raw.Action != "" && !ok {
+		warn(RuleUnknownAction, "action", raw.Action)
+	}
+
+	if Rejected(issues) {
+		return Stock{}, issues
+	}
+	stock, err := raw.ToStock()
+	if err != nil {
+		// ParsePriceString ya aceptó los precios; no debería pasar
+		reject(RuleInvalidTarget, "target", err.Error())
+		return Stock{}, issues
+	}
+	v.Normalize(&stock)
+	return stock, issues
+}
+
+// Rejected indica si alguno de los problemas descarta el registro
+func Rejected(issues []Issue) bool {
+	for _, issue := range issues {
+		if issue.Severity == SeverityReject {
+			return true
+		}
+	}
+	return false
+}
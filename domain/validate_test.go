@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestValidate verifica las reglas de validación de un registro
+func TestValidate(t *testing.T) {
+	valid := RawStock{Ticker: "AAPL", TargetFrom: "$150.00", TargetTo: "$180.00",
+		RatingFrom: "Hold", RatingTo: "Buy", Time: "2025-01-13T00:30:05Z"}
+
+	stock, issues := Validate(valid)
+	assert.Empty(t, issues)
+	assert.Equal(t, Price(180), stock.TargetTo)
+	assert.Equal(t, string(RatingBuy), stock.NormalizedRatingTo)
+
+	tests := []struct {
+		name     string
+		change   func(*RawStock)
+		rule     string
+		rejected bool
+	}{
+		{"Ticker vacío", func(r *RawStock) { r.Ticker = " " }, RuleMissingTicker, true},
+		{"Hora inválida", func(r *RawStock) { r.Time = "13/01/2025" }, RuleInvalidTime, true},
+		{"Precio ilegible", func(r *RawStock) { r.TargetTo = "ciento" }, RuleInvalidTarget, true},
+		{"Precio NaN", func(r *RawStock) { r.TargetTo = "NaN" }, RuleInvalidTarget, true},
+		{"Precio infinito", func(r *RawStock) { r.TargetTo = "Inf" }, RuleInvalidTarget, true},
+		{"Precio fuera de rango", func(r *RawStock) { r.TargetFrom = "1e13" }, RuleInvalidTarget, true},
+		{"Precio negativo", func(r *RawStock) { r.TargetFrom = "-$5" }, RuleNegativeTarget, true},
+		{"Rating desconocido", func(r *RawStock) { r.RatingTo = "Mega Buy" }, RuleUnknownRating, false},
+		{"Acción desconocida", func(r *RawStock) { r.Action = "teleported by" }, RuleUnknownAction, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := valid
+			tt.change(&raw)
+			stock, issues := Validate(raw)
+			require.Len(t, issues, 1)
+			assert.Equal(t, tt.rule, issues[0].Rule)
+			assert.Equal(t, tt.rejected, Rejected(issues))
+			if !tt.rejected {
+				assert.Equal(t, "AAPL", stock.Ticker)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package domain
+
+import "strings"
+
+// Tipos de término del vocabulario
+const (
+	KindRating = "rating"
+	KindAction = "action"
+)
+
+// Rating es la clase canónica de un rating; cada bróker usa sus propios
+// nombres ("Overweight", "Sector Perform", "Moderate Buy"...)
+type Rating string
+
+const (
+	RatingSell         Rating = "sell"
+	RatingUnderperform Rating = "underperform"
+	RatingHold         Rating = "hold"
+	RatingBuy          Rating = "buy"
+	RatingStrongBuy    Rating = "strong_buy"
+)
+
+// RatingLevels es el nivel numérico de cada rating canónico, de 0 (venta) a
+// 4 (compra fuerte)
+var RatingLevels = map[Rating]int{
+	RatingSell:         0,
+	RatingUnderperform: 1,
+	RatingHold:         2,
+	RatingBuy:          3,
+	RatingStrongBuy:    4,
+}
+
+// Action es el tipo canónico de la acción del bróker ("upgraded by" → upgrade)
+type Action string
+
+const (
+	ActionUpgrade       Action = "upgrade"
+	ActionDowngrade     Action = "downgrade"
+	ActionInitiate      Action = "initiate"
+	ActionReiterate     Action = "reiterate"
+	ActionTargetRaised  Action = "target_raised"
+	ActionTargetLowered Action = "target_lowered"
+	ActionTargetSet     Action = "target_set"
+)
+
+// Mapping asocia un texto tal como lo publica la fuente con su valor canónico.
+// Level solo aplica a los ratings.
+type Mapping struct {
+	Kind      string `db:"kind" json:"kind"`
+	RawValue  string `db:"raw_value" json:"raw_value"`
+	Canonical string `db:"canonical" json:"canonical"`
+	Level     *int   `db:"level" json:"level"`
+}
+
+func ratingTerm(raw string, r Rating) Mapping {
+	level := RatingLevels[r]
+	return Mapping{Kind: KindRating, RawValue: raw, Canonical: string(r), Level: &level}
+}
+
+func actionTerm(raw string, a Action) Mapping {
+	return Mapping{Kind: KindAction, RawValue: raw, Canonical: string(a)}
+}
+
+// DefaultMappings es el vocabulario inicial; la migración
+// 0009_create_vocabulary carga la misma lista en la tabla vocabulary, que es
+// la que se usa en producción
+var DefaultMappings = []Mapping{
+	ratingTerm("strong-buy", RatingStrongBuy),
+	ratingTerm("strong buy", RatingStrongBuy),
+	ratingTerm("conviction buy", RatingStrongBuy),
+	ratingTerm("top pick", RatingStrongBuy),
+	ratingTerm("buy", RatingBuy),
+	ratingTerm("speculative buy", RatingBuy),
+	ratingTerm("moderate buy", RatingBuy),
+	ratingTerm("accumulate", RatingBuy),
+	ratingTerm("add", RatingBuy),
+	ratingTerm("outperform", RatingBuy),
+	ratingTerm("market outperform", RatingBuy),
+	ratingTerm("sector outperform", RatingBuy),
+	ratingTerm("outperformer", RatingBuy),
+	ratingTerm("overweight", RatingBuy),
+	ratingTerm("positive", RatingBuy),
+	ratingTerm("hold", RatingHold),
+	ratingTerm("neutral", RatingHold),
+	ratingTerm("market perform", RatingHold),
+	ratingTerm("sector perform", RatingHold),
+	ratingTerm("peer perform", RatingHold),
+	ratingTerm("equal weight", RatingHold),
+	ratingTerm("sector weight", RatingHold),
+	ratingTerm("in-line", RatingHold),
+	ratingTerm("underperform", RatingUnderperform),
+	ratingTerm("market underperform", RatingUnderperform),
+	ratingTerm("sector underperform", RatingUnderperform),
+	ratingTerm("underweight", RatingUnderperform),
+	ratingTerm("reduce", RatingUnderperform),
+	ratingTerm("negative", RatingUnderperform),
+	ratingTerm("moderate sell", RatingUnderperform),
+	ratingTerm("sell", RatingSell),
+	ratingTerm("strong sell", RatingSell),
+	actionTerm("upgraded by", ActionUpgrade),
+	actionTerm("downgraded by", ActionDowngrade),
+	actionTerm("initiated by", ActionInitiate),
+	actionTerm("reiterated by", ActionReiterate),
+	actionTerm("target raised by", ActionTargetRaised),
+	actionTerm("target lowered by", ActionTargetLowered),
+	actionTerm("target set by", ActionTargetSet),
+}
+
+// NormalizeTerm es la clave con la que se buscan los textos en el
+// vocabulario: minúsculas y espacios simples
+func NormalizeTerm(raw string) string {
+	return strings.ToLower(strings.Join(strings.Fields(raw), " "))
+}
+
+// Vocabulary traduce ratings y acciones a sus valores canónicos
+type Vocabulary struct {
+	terms map[string]map[string]Mapping
+}
+
+// NewVocabulary arma el vocabulario a partir de las filas de la tabla
+func NewVocabulary(mappings []Mapping) *Vocabulary {
+	v := &Vocabulary{terms: map[string]map[string]Mapping{
+		KindRating: {},
+		KindAction: {},
+	}}
+	for _, m := range mappings {
+		if v.terms[m.Kind] == nil {
+			v.terms[m.Kind] = map[string]Mapping{}
+		}
+		v.terms[m.Kind][NormalizeTerm(m.RawValue)] = m
+	}
+	return v
+}
+
+var defaultVocabulary = NewVocabulary(DefaultMappings)
+
+// DefaultVocabulary devuelve el vocabulario de DefaultMappings
+func DefaultVocabulary() *Vocabulary {
+	return defaultVocabulary
+}
+
+// Len devuelve la cantidad de textos conocidos
+func (v *Vocabulary) Len() int {
+	n := 0
+	for _, terms := range v.terms {
+		n += len(terms)
+	}
+	return n
+}
+
+// Rating devuelve la clase canónica y el nivel de un rating; ok es false si
+// el texto no está en el vocabulario
+func (v *Vocabulary) Rating(raw string) (r Rating, level int, ok bool) {
+	m, ok := v.terms[KindRating][NormalizeTerm(raw)]
+	if !ok {
+		return "", 0, false
+	}
+	r = Rating(m.Canonical)
+	if m.Level != nil {
+		return r, *m.Level, true
+	}
+	return r, RatingLevels[r], true
+}
+
+// Action devuelve el tipo canónico de una acción; ok es false si el texto no
+// está en el vocabulario
+func (v *Vocabulary) Action(raw string) (Action, bool) {
+	m, ok := v.terms[KindAction][NormalizeTerm(raw)]
+	return Action(m.Canonical), ok
+}
+
+// Normalize completa los campos canónicos de un stock; los textos que no
+// están en el vocabulario quedan vacíos
+func (v *Vocabulary) Normalize(stock *Stock) {
+	from, _, _ := v.Rating(stock.RatingFrom)
+	to, _, _ := v.Rating(stock.RatingTo)
+	act, _ := v.Action(stock.Action)
+	stock.NormalizedRatingFrom = string(from)
+	stock.NormalizedRatingTo = string(to)
+	stock.NormalizedAction = string(act)
+}
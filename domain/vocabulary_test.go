@@ -0,0 +1,46 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestVocabulary verifica la traducción de ratings y acciones a valores canónicos
+func TestVocabulary(t *testing.T) {
+	vocab := DefaultVocabulary()
+
+	r, level, ok := vocab.Rating("Overweight")
+	assert.True(t, ok)
+	assert.Equal(t, RatingBuy, r)
+	assert.Equal(t, 3, level)
+
+	r, level, ok = vocab.Rating("  equal   WEIGHT ")
+	assert.True(t, ok)
+	assert.Equal(t, RatingHold, r)
+	assert.Equal(t, 2, level)
+
+	_, _, ok = vocab.Rating("Mega Buy")
+	assert.False(t, ok)
+
+	action, ok := vocab.Action("upgraded by")
+	assert.True(t, ok)
+	assert.Equal(t, ActionUpgrade, action)
+
+	// El nivel de la tabla tiene prioridad sobre el del rating canónico
+	custom := 4
+	vocab = NewVocabulary([]Mapping{{Kind: KindRating, RawValue: "Moderate Buy", Canonical: string(RatingBuy), Level: &custom}})
+	_, level, ok = vocab.Rating("moderate buy")
+	assert.True(t, ok)
+	assert.Equal(t, 4, level)
+}
+
+// TestVocabularyNormalize verifica los campos canónicos que se guardan al ingerir
+func TestVocabularyNormalize(t *testing.T) {
+	stock := Stock{Action: "target raised by", RatingFrom: "Sector Perform", RatingTo: "Mega Buy"}
+	DefaultVocabulary().Normalize(&stock)
+
+	assert.Equal(t, string(ActionTargetRaised), stock.NormalizedAction)
+	assert.Equal(t, string(RatingHold), stock.NormalizedRatingFrom)
+	assert.Empty(t, stock.NormalizedRatingTo)
+}
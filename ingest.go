@@ -0,0 +1,424 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/JuanVel1/stock-api/domain"
+	"github.com/JuanVel1/stock-api/logging"
+	"github.com/JuanVel1/stock-api/store"
+)
+
+const (
+	// maxIngestBytes es el tamaño máximo del cuerpo de POST /api/ingest
+	maxIngestBytes = 10 << 20
+	// maxIngestItems son los registros que acepta una petición
+	maxIngestItems = 5000
+	// ingestBatchSize son los registros que se guardan por transacción
+	ingestBatchSize = 100
+	// maxIdempotencyKeyLength es el largo máximo de Idempotency-Key
+	maxIdempotencyKeyLength = 255
+	// ingestSourceKey guarda en el contexto de gin la fuente del cliente autenticado
+	ingestSourceKey = "ingestSource"
+)
+
+// ingestSummary es la respuesta de POST /api/ingest
+type ingestSummary struct {
+	RunID    string         `json:"run_id"`
+	Source   string         `json:"source"`
+	Received int            `json:"received"`
+	Accepted int            `json:"accepted"`
+	Rejected int            `json:"rejected"`
+	Flagged  int            `json:"flagged"`
+	Inserted int            `json:"inserted"`
+	Updated  int            `json:"updated"`
+	Skipped  int            `json:"skipped"`
+	NextPage string         `json:"next_page,omitempty"`
+	Rejects  []ingestReject `json:"rejects"`
+	// Warnings son los campos desconocidos del cuerpo, que se ignoraron
+	Warnings []string `json:"warnings,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// ingestReject es un registro descartado por la validación; Index es su
+// posición en items (o la línea, desde 0, en NDJSON)
+type ingestReject struct {
+	Index  int      `json:"index"`
+	Ticker string   `json:"ticker"`
+	Time   string   `json:"time"`
+	Issues []string `json:"issues"`
+}
+
+// ingestTokens lee INGEST_TOKENS, con el formato "cliente=token,otro=token2"
+func ingestTokens() map[string]string {
+	tokens := make(map[string]string)
+	for _, entry := range strings.Split(os.Getenv("INGEST_TOKENS"), ",") {
+		client, token, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		client, token = strings.TrimSpace(client), strings.TrimSpace(token)
+		if ok && client != "" && token != "" {
+			tokens[client] = token
+		}
+	}
+	return tokens
+}
+
+// requireIngestToken protege POST /api/ingest con los tokens de
+// INGEST_TOKENS enviados como "Authorization: Bearer <token>". Cada cliente
+// escribe como la fuente "push:<cliente>". Si INGEST_TOKENS no está definido
+// el endpoint queda deshabilitado.
+func requireIngestToken(c *gin.Context) {
+	tokens := ingestTokens()
+	if len(tokens) == 0 {
+		c.AbortWithStatusJSON(403, gin.H{"error": "ingesta deshabilitada: defina INGEST_TOKENS"})
+		return
+	}
+
+	provided, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if ok {
+		for client, token := range tokens {
+			if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1 {
+				c.Set(ingestSourceKey, "push:"+client)
+				c.Next()
+				return
+			}
+		}
+	}
+	c.AbortWithStatusJSON(401, gin.H{"error": "token de ingesta inválido"})
+}
+
+// ingestPriority es la prioridad con la que compiten los registros recibidos
+// por POST /api/ingest con los de las fuentes del proceso save
+func ingestPriority() int {
+	if v, err := strconv.Atoi(os.Getenv("INGEST_PRIORITY")); err == nil {
+		return v
+	}
+	return 0
+}
+
+// isNDJSON indica si el Content-Type corresponde a un registro JSON por línea
+func isNDJSON(contentType string) bool {
+	switch contentType {
+	case "application/x-ndjson", "application/ndjson", "application/jsonl", "application/x-jsonlines":
+		return true
+	}
+	return false
+}
+
+// decodeIngestBody lee el cuerpo como domain.APIResponse, el mismo formato
+// que devuelve la API de origen, o como NDJSON con un domain.RawStock por
+// línea. Los campos desconocidos se ignoran, para que un cliente con una
+// versión más nueva del formato no pierda la petición entera, y se devuelven
+// como advertencias (ver unknownIngestFields).
+func decodeIngestBody(contentType string, body []byte) (domain.APIResponse, []string, error) {
+	var payload domain.APIResponse
+	if !isNDJSON(contentType) {
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		if err := decoder.Decode(&payload); err != nil {
+			return payload, nil, fmt.Errorf("JSON inválido: %w", err)
+		}
+		if decoder.More() {
+			return payload, nil, errors.New("JSON inválido: contenido después del objeto")
+		}
+		var fields struct {
+			Items []map[string]json.RawMessage `json:"items"`
+		}
+		var top map[string]json.RawMessage
+		// Ya se decodificó una vez, así que estas no fallan
+		json.Unmarshal(body, &top)
+		json.Unmarshal(body, &fields)
+		return payload, unknownIngestFields(top, fields.Items), nil
+	}
+
+	var items []map[string]json.RawMessage
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), maxIngestBytes)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var raw domain.RawStock
+		if err := json.Unmarshal(text, &raw); err != nil {
+			return payload, nil, fmt.Errorf("línea %d: JSON inválido: %w", line, err)
+		}
+		payload.Items = append(payload.Items, raw)
+		var fields map[string]json.RawMessage
+		json.Unmarshal(text, &fields)
+		items = append(items, fields)
+	}
+	if err := scanner.Err(); err != nil {
+		return payload, nil, fmt.Errorf("error leyendo NDJSON: %w", err)
+	}
+	return payload, unknownIngestFields(nil, items), nil
+}
+
+// Campos que entiende POST /api/ingest, en minúsculas: encoding/json los
+// compara sin distinguir mayúsculas
+var (
+	ingestPayloadFields = jsonFieldNames(reflect.TypeOf(domain.APIResponse{}))
+	ingestItemFields    = jsonFieldNames(reflect.TypeOf(domain.RawStock{}))
+)
+
+// jsonFieldNames devuelve los nombres JSON de los campos del struct t
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" {
+			name = t.Field(i).Name
+		}
+		names[strings.ToLower(name)] = true
+	}
+	return names
+}
+
+// unknownIngestFields lista una vez cada campo desconocido del objeto
+// principal y de los registros, ej. "items[].sector"
+func unknownIngestFields(top map[string]json.RawMessage, items []map[string]json.RawMessage) []string {
+	unknown := make(map[string]bool)
+	for field := range top {
+		if !ingestPayloadFields[strings.ToLower(field)] {
+			unknown[field] = true
+		}
+	}
+	for _, item := range items {
+		for field := range item {
+			if !ingestItemFields[strings.ToLower(field)] {
+				unknown["items[]."+field] = true
+			}
+		}
+	}
+
+	var warnings []string
+	for field := range unknown {
+		warnings = append(warnings, "campo desconocido ignorado: "+field)
+	}
+	sort.Strings(warnings)
+	return warnings
+}
+
+// postIngest recibe registros empujados por un cliente y los guarda con la
+// misma validación y escritura que el proceso save. Con Idempotency-Key la
+// primera respuesta queda guardada y los reintentos con el mismo cuerpo la
+// reciben de nuevo sin volver a escribir.
+func postIngest(c *gin.Context) {
+	source := c.GetString(ingestSourceKey)
+	logger := requestLog(c).With("source", source)
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxIngestBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(413, gin.H{"error": fmt.Sprintf("el cuerpo supera %d bytes", maxIngestBytes)})
+			return
+		}
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	payload, warnings, err := decodeIngestBody(c.ContentType(), body)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if len(warnings) > 0 {
+		logger.Warn("La petición trae campos desconocidos, se ignoran", "warnings", warnings)
+	}
+	if len(payload.Items) > maxIngestItems {
+		c.JSON(413, gin.H{"error": fmt.Sprintf("la petición supera %d registros", maxIngestItems)})
+		return
+	}
+
+	key := c.GetHeader("Idempotency-Key")
+	if key == "" {
+		status, summary := runIngest(c.Request.Context(), logger, source, payload, warnings)
+		c.JSON(status, summary)
+		return
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Idempotency-Key supera %d caracteres", maxIdempotencyKeyLength)})
+		return
+	}
+
+	hash := sha256.Sum256(body)
+	requestHash := hex.EncodeToString(hash[:])
+	existing, claimed, err := store.ClaimIngestRequest(c.Request.Context(), db, source, key, requestHash)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	if !claimed {
+		switch {
+		case existing.RequestHash != requestHash:
+			c.JSON(422, gin.H{"error": "Idempotency-Key ya se usó con otro cuerpo"})
+		case !existing.Completed():
+			c.JSON(409, gin.H{"error": "hay otra petición en curso con esta Idempotency-Key"})
+		default:
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(*existing.StatusCode, "application/json; charset=utf-8", existing.Response)
+		}
+		return
+	}
+
+	logger = logger.With("idempotency_key", key)
+	status, summary := runIngest(c.Request.Context(), logger, source, payload, warnings)
+	// La respuesta se guarda aunque el cliente se haya desconectado
+	ctx := context.Background()
+	if status >= 500 {
+		// Los lotes ya guardados se repiten sin cambios, así que el cliente
+		// puede reintentar con la misma clave
+		if err := store.ReleaseIngestRequest(ctx, db, source, key); err != nil {
+			logger.Error("Error liberando Idempotency-Key", logging.Err(err))
+		}
+	} else if response, err := json.Marshal(summary); err != nil {
+		logger.Error("Error serializando la respuesta de la ingesta", "run_id", summary.RunID, logging.Err(err))
+	} else {
+		var runID *string
+		if summary.RunID != "" {
+			runID = &summary.RunID
+		}
+		if err := store.CompleteIngestRequest(ctx, db, source, key, runID, status, response); err != nil {
+			logger.Error("Error guardando Idempotency-Key", "run_id", summary.RunID, logging.Err(err))
+		}
+	}
+	c.JSON(status, summary)
+}
+
+// runIngest valida y guarda los registros como una ejecución de tipo
+// "ingest" de la fuente source. Devuelve el código HTTP y el resumen; los
+// registros rechazados por la validación no hacen fallar la petición, y las
+// advertencias de decodeIngestBody se devuelven en el resumen.
+func runIngest(ctx context.Context, logger *slog.Logger, source string, payload domain.APIResponse, warnings []string) (int, ingestSummary) {
+	summary := ingestSummary{
+		Source:   source,
+		Received: len(payload.Items),
+		NextPage: payload.NextPage,
+		Rejects:  []ingestReject{},
+		Warnings: warnings,
+	}
+
+	run, err := store.CreateSyncRun(ctx, db, "ingest", source)
+	if err != nil {
+		summary.Error = err.Error()
+		return 500, summary
+	}
+	summary.RunID = run.ID
+	run.PagesFetched = 1
+	logger = logger.With("run_id", run.ID)
+
+	runErr := saveIngest(ctx, logger, run, payload.Items, &summary)
+	if err := store.FinishSyncRun(context.Background(), db, run, runErr); err != nil {
+		logger.Error("Error registrando la ingesta", logging.Err(err))
+	}
+	attrs := []any{
+		"received", summary.Received, "inserted", summary.Inserted, "updated", summary.Updated,
+		"skipped", summary.Skipped, "rejected", summary.Rejected,
+	}
+	if runErr != nil {
+		logger.Error("Ingesta fallida", append(attrs, logging.Err(runErr))...)
+	} else {
+		logger.Info("Ingesta terminada", attrs...)
+	}
+	if runErr != nil {
+		summary.Error = runErr.Error()
+		return 500, summary
+	}
+	return 200, summary
+}
+
+// saveIngest valida los registros, completa su origen y brókers y los guarda
+// por lotes con store.UpsertStocks, sumando los contadores a run y summary
+func saveIngest(ctx context.Context, logger *slog.Logger, run *store.SyncRun, items []domain.RawStock, summary *ingestSummary) error {
+	reloadReferenceData(ctx, logger)
+	vocab := currentVocabulary()
+
+	report := store.NewQualityReport(run.ID, run.Source)
+	stocks := make([]domain.Stock, 0, len(items))
+	for i, raw := range items {
+		stock, issues := vocab.Validate(raw)
+		report.Record(raw, issues)
+		if domain.Rejected(issues) {
+			logger.Debug("Registro descartado", "index", i, "ticker", raw.Ticker, "time", raw.Time, "issues", issues)
+			reject := ingestReject{Index: i, Ticker: raw.Ticker, Time: raw.Time}
+			for _, issue := range issues {
+				reject.Issues = append(reject.Issues, issue.String())
+			}
+			summary.Rejects = append(summary.Rejects, reject)
+			continue
+		}
+		stocks = append(stocks, stock)
+	}
+	summary.Accepted = report.Accepted
+	summary.Rejected = report.Rejected
+	summary.Flagged = report.Flagged
+	run.RowsFailed += report.Rejected
+	if err := store.SaveQualityReport(ctx, db, report); err != nil {
+		logger.Warn("Error guardando el reporte de calidad de la ingesta", logging.Err(err))
+	}
+
+	fetchedAt := time.Now().UTC()
+	provenance := domain.Provenance{
+		SourceID:       run.Source,
+		SourcePriority: ingestPriority(),
+		FetchedAt:      &fetchedAt,
+		PageRef:        "ingest:" + run.ID,
+	}
+	for i := range stocks {
+		stocks[i].Provenance = provenance
+	}
+
+	directory, registered, err := store.ResolveBrokerages(ctx, db, currentBrokerages(), stocks)
+	brokerages.Store(directory)
+	if err != nil {
+		run.RowsFailed += len(stocks)
+		return err
+	}
+	for _, name := range registered {
+		logger.Info("Bróker nuevo registrado", "brokerage", name)
+	}
+
+	opts := store.TxOptions{
+		OnRetry: func(retry int, err error) {
+			logger.Warn("Conflicto en la transacción, se reintenta", "attempt", retry+1,
+				"error_class", store.ClassifyError(err).String(), logging.Err(err))
+		},
+	}
+	for i := 0; i < len(stocks); i += ingestBatchSize {
+		batch := stocks[i:min(i+ingestBatchSize, len(stocks))]
+		logger.Debug("Guardando lote", "batch", i/ingestBatchSize+1, "size", len(batch))
+		result, err := store.UpsertStocks(ctx, db, run.ID, batch, opts)
+		run.Retries += result.Retries
+		if err != nil {
+			run.RecordError(err)
+			run.RowsFailed += len(stocks) - i
+			return fmt.Errorf("error guardando registros %d-%d: %w", i, i+len(batch)-1, err)
+		}
+		run.RowsInserted += result.Inserted
+		run.RowsUpdated += result.Updated
+		run.RowsSkipped += result.Skipped
+		summary.Inserted += result.Inserted
+		summary.Updated += result.Updated
+		summary.Skipped += result.Skipped
+	}
+	return nil
+}
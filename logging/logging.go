@@ -0,0 +1,99 @@
+// Package logging configura el logger estructurado (log/slog) que comparten
+// la API y el proceso save.
+//
+// Los mensajes usan siempre los mismos nombres de campo para poder filtrar
+// los registros de una ejecución o petición: run_id, source, page, batch,
+// attempt, ticker y request_id.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Formatos de salida
+const (
+	FormatJSON   = "json"
+	FormatLogfmt = "logfmt"
+)
+
+// Options configura el logger
+type Options struct {
+	// Format es json o logfmt (clave=valor, el formato por defecto)
+	Format string
+	// Level es debug, info, warn o error
+	Level string
+}
+
+// OptionsFromEnv lee las opciones de LOG_FORMAT y LOG_LEVEL
+func OptionsFromEnv() Options {
+	return Options{Format: os.Getenv("LOG_FORMAT"), Level: os.Getenv("LOG_LEVEL")}
+}
+
+// ParseLevel interpreta un nivel; el valor vacío es info
+func ParseLevel(level string) (slog.Level, error) {
+	if strings.TrimSpace(level) == "" {
+		return slog.LevelInfo, nil
+	}
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(strings.TrimSpace(level))); err != nil {
+		return slog.LevelInfo, fmt.Errorf("nivel de log inválido %q (debug, info, warn o error)", level)
+	}
+	return l, nil
+}
+
+// New crea un logger que escribe en w con las opciones dadas
+func New(w io.Writer, opts Options) (*slog.Logger, error) {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return nil, err
+	}
+	handlerOpts := &slog.HandlerOptions{Level: level}
+
+	switch strings.ToLower(strings.TrimSpace(opts.Format)) {
+	case "", FormatLogfmt, "text":
+		return slog.New(slog.NewTextHandler(w, handlerOpts)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, handlerOpts)), nil
+	default:
+		return nil, fmt.Errorf("formato de log inválido %q (json o logfmt)", opts.Format)
+	}
+}
+
+// Setup crea el logger con las opciones de LOG_FORMAT y LOG_LEVEL, que
+// escribe en la salida de errores, y lo deja como logger por defecto de slog
+// y del paquete log. Si las opciones son inválidas usa logfmt con nivel info
+// y devuelve el error para que se informe.
+func Setup() (*slog.Logger, error) {
+	logger, err := New(os.Stderr, OptionsFromEnv())
+	if err != nil {
+		logger, _ = New(os.Stderr, Options{})
+	}
+	slog.SetDefault(logger)
+	return logger, err
+}
+
+// Err es el atributo con el que se registra un error
+func Err(err error) slog.Attr {
+	return slog.Any("error", err)
+}
+
+type contextKey struct{}
+
+// NewContext devuelve una copia de ctx que lleva logger, para que las
+// funciones que reciben ctx registren con los campos de quien las llamó
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext devuelve el logger guardado con NewContext o el logger por defecto
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
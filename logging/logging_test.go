@@ -0,0 +1,64 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLevel(t *testing.T) {
+	for input, want := range map[string]slog.Level{
+		"": slog.LevelInfo, "debug": slog.LevelDebug, "INFO": slog.LevelInfo,
+		"warn": slog.LevelWarn, "error": slog.LevelError,
+	} {
+		level, err := ParseLevel(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, want, level, input)
+	}
+
+	_, err := ParseLevel("verbose")
+	assert.Error(t, err)
+}
+
+func TestNewJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, Options{Format: "json", Level: "warn"})
+	require.NoError(t, err)
+
+	logger.Info("no se escribe")
+	logger.Warn("lote fallido", "run_id", "r1", "page", 3, Err(errors.New("timeout")))
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "WARN", entry["level"])
+	assert.Equal(t, "lote fallido", entry["msg"])
+	assert.Equal(t, "r1", entry["run_id"])
+	assert.Equal(t, float64(3), entry["page"])
+	assert.Equal(t, "timeout", entry["error"])
+}
+
+func TestNewLogfmt(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, Options{})
+	require.NoError(t, err)
+
+	logger.Debug("no se escribe")
+	logger.Info("página confirmada", "run_id", "r1", "next_page", "AAPL")
+	assert.Contains(t, buf.String(), `level=INFO msg="página confirmada" run_id=r1 next_page=AAPL`)
+
+	_, err = New(&buf, Options{Format: "xml"})
+	assert.Error(t, err)
+}
+
+func TestContext(t *testing.T) {
+	assert.Same(t, slog.Default(), FromContext(context.Background()))
+
+	logger := slog.Default().With("run_id", "r1")
+	assert.Same(t, logger, FromContext(NewContext(context.Background(), logger)))
+}
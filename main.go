@@ -1,13 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"math"
 	"os"
 	"sort"
 	"strconv"
-	"strings"
+	"sync/atomic"
 	"time"
 
 	//AWS
@@ -20,6 +21,11 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
+
+	"github.com/JuanVel1/stock-api/domain"
+	"github.com/JuanVel1/stock-api/logging"
+	"github.com/JuanVel1/stock-api/migrations"
+	"github.com/JuanVel1/stock-api/store"
 )
 
 var db *sqlx.DB
@@ -28,6 +34,10 @@ func main() {
 
 	godotenv.Load(".env")
 
+	if _, err := logging.Setup(); err != nil {
+		slog.Warn("Configuración de logs inválida, se usa logfmt con nivel info", logging.Err(err))
+	}
+
 	// Configuración para LocalStack
 	// sess := session.Must(session.NewSession(&aws.Config{
 	// 	Endpoint:   aws.String("http://localhost:4566"), // LocalStack endpoint
@@ -51,15 +61,40 @@ func main() {
 	db = sqlx.MustConnect("postgres", os.Getenv("DB_URL"))
 	port := os.Getenv("PORT")
 
+	// Aplicar migraciones pendientes antes de servir peticiones
+	applied, err := migrations.Up(context.Background(), db)
+	if err != nil {
+		slog.Error("Error aplicando migraciones", logging.Err(err))
+		os.Exit(1)
+	}
+	for _, m := range applied {
+		slog.Info("Migración aplicada", "version", m.Version, "name", m.Name)
+		switch m.Name {
+		case store.PriceConversionMigration:
+			reportPriceConversionErrors()
+		case store.RatingEventsMigration:
+			// Sin la copia, rating_events queda incompleto: no se sirve nada
+			if err := backfillRatingEvents(); err != nil {
+				slog.Error("Error copiando stocks a rating_events; reintentar con `save backfill`", logging.Err(err))
+				os.Exit(1)
+			}
+		}
+	}
+
+	// El vocabulario y los brókers se leen al iniciar y luego cada
+	// referenceDataTTL (ver refreshReferenceData)
+	reloadReferenceData(context.Background(), slog.Default())
+
 	// 2. Crear API
-	r := gin.Default()
+	r := gin.New()
+	r.Use(requestLogger, gin.Recovery())
 
 	// Configura el middleware CORS para permitir solicitudes desde el frontend
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:5173"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Idempotency-Key", requestIDHeader},
+		ExposeHeaders:    []string{"Content-Length", requestIDHeader},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -75,10 +110,16 @@ func main() {
 	}
 
 	if err := r.SetTrustedProxies(trustedProxies); err != nil {
-		log.Fatalf("Error configurando proxies: %v", err)
+		slog.Error("Error configurando proxies", logging.Err(err))
+		os.Exit(1)
 	}
 
 	r.GET("/api/stocks", func(c *gin.Context) {
+		where, ok := stocksFilter(c)
+		if !ok {
+			return
+		}
+
 		// Obtener parámetros de paginación
 		next := c.DefaultQuery("next", "0")
 		limit := c.DefaultQuery("limit", "50") // Cambiado a 50 por defecto
@@ -95,18 +136,18 @@ func main() {
 			limitNum = l // Limitar a máximo 100 registros
 		}
 
-		var stocks []Stock
+		var stocks []domain.Stock
 		var total int
 
 		// Obtener el total de registros
-		err := db.Get(&total, "SELECT COUNT(*) FROM stocks")
+		err := db.Get(&total, "SELECT COUNT(*) FROM rating_events e"+where)
 		if err != nil {
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
 
 		// Consulta paginada
-		query := `SELECT * FROM stocks ORDER BY time DESC OFFSET $1 LIMIT $2`
+		query := stocksQuery + where + ` ORDER BY e.time DESC, e.ticker, e.brokerage_id OFFSET $1 LIMIT $2`
 		err = db.Select(&stocks, query, nextNum, limitNum)
 		if err != nil {
 			c.JSON(500, gin.H{"error": err.Error()})
@@ -127,66 +168,135 @@ func main() {
 				"next_offset":    nextOffset,
 			},
 		})
-		fmt.Println("Totales ", len(stocks))
+		requestLog(c).Debug("Stocks devueltos", "count", len(stocks), "total", total)
 	})
 
 	r.GET("/api/recommendations", getStockRecommendations)
+	r.GET("/api/sync-runs", getSyncRuns)
+	r.GET("/api/sync-runs/:id", getSyncRun)
+	r.GET("/api/data-quality", getDataQuality)
+	r.GET("/api/vocabulary/unmapped", getUnmappedVocabulary)
+	r.GET("/api/changes", getChanges)
+	r.GET("/api/brokerages", getBrokerages)
+	r.POST("/api/brokerages/:id/merge", requireAdmin, mergeBrokerages)
+	r.POST("/api/ingest", requireIngestToken, postIngest)
 
 	// 4. Iniciar servidor
 	r.Run(":" + port)
 }
 
-type Stock struct {
-	Ticker     string  `json:"ticker" db:"ticker"`
-	Company    string  `json:"company" db:"company"`
-	Brokerage  string  `json:"brokerage" db:"brokerage"`
-	Action     string  `json:"action" db:"action"`
-	RatingFrom string  `json:"rating_from" db:"rating_from"`
-	RatingTo   string  `json:"rating_to" db:"rating_to"`
-	TargetFrom float64 `json:"target_from" db:"target_from"`
-	TargetTo   float64 `json:"target_to" db:"target_to"`
-	Time       string  `json:"time" db:"time"`
+// stocksQuery lee los eventos de rating_events con el nombre de su empresa y
+// su origen, con las columnas de domain.Stock
+const stocksQuery = `SELECT
+		e.ticker, c.name AS company, e.brokerage, e.brokerage_id, e.action,
+		e.rating_from, e.rating_to, e.target_from, e.target_to, e.time,
+		e.normalized_action, e.normalized_rating_from, e.normalized_rating_to,
+		e.disappeared_at, e.source_id, e.source_priority, e.fetched_at, e.page_ref
+	FROM rating_events e
+	JOIN companies c ON c.ticker = e.ticker`
+
+// stocksFilter devuelve la condición WHERE de stocksQuery para la petición:
+// los eventos que una sincronización completa marcó como desaparecidos
+// quedan afuera salvo con ?include_disappeared=true. Si el parámetro no es
+// un booleano responde 400 y devuelve false.
+func stocksFilter(c *gin.Context) (string, bool) {
+	include := false
+	if value := c.Query("include_disappeared"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "include_disappeared debe ser true o false"})
+			return "", false
+		}
+		include = parsed
+	}
+	if include {
+		return "", true
+	}
+	return ` WHERE e.disappeared_at IS NULL`, true
 }
 
 type StockRecommendation struct {
-	Stock
+	domain.Stock
 	Score         float64 `json:"score"`
 	RatingChange  string  `json:"rating_change"`
 	TargetChange  string  `json:"target_change"`
 	PercentChange float64 `json:"percent_change"`
 }
 
-// Brokerage puntajes
-var brokerageReputation = map[string]float64{
-	"The Goldman Sachs Group": 1.2,
-	"Morgan Stanley":          1.1,
-	"JPMorgan Chase & Co.":    1.15,
-	"Citigroup":               1.05,
-	"Benchmark":               1.0,
-	"Needham & Company LLC":   0.95,
-	"Wedbush":                 0.98,
-	"Truist Financial":        0.97,
-	"Other":                   0.9,
+// brokerages resuelve los nombres de bróker a su reputación; se carga de las
+// tablas brokerages y brokerage_aliases (ver reloadReferenceData)
+var brokerages atomic.Pointer[domain.BrokerageDirectory]
+
+func currentBrokerages() *domain.BrokerageDirectory {
+	if d := brokerages.Load(); d != nil {
+		return d
+	}
+	return domain.DefaultBrokerageDirectory()
+}
+
+// vocabulary traduce ratings y acciones a valores canónicos; se carga de la
+// tabla vocabulary (ver reloadReferenceData)
+var vocabulary atomic.Pointer[domain.Vocabulary]
+
+func currentVocabulary() *domain.Vocabulary {
+	if v := vocabulary.Load(); v != nil {
+		return v
+	}
+	return domain.DefaultVocabulary()
+}
+
+// Puntaje por tipo de acción
+var actionScores = map[domain.Action]float64{
+	domain.ActionUpgrade:   8,
+	domain.ActionInitiate:  6,
+	domain.ActionReiterate: 5,
+}
+
+// referenceDataTTL es cuánto se usan el vocabulario y los brókers cargados
+// antes de volver a leerlos. Las escrituras de la API (ingesta y fusión de
+// brókers) los recargan enseguida; el TTL cubre las del proceso save y las
+// ediciones manuales de las tablas.
+const referenceDataTTL = time.Minute
+
+// referenceDataLoadedAt es cuándo se intentó la última recarga, en UnixNano
+var referenceDataLoadedAt atomic.Int64
+
+// refreshReferenceData recarga el vocabulario y el directorio de brókers si
+// pasó referenceDataTTL desde la última recarga
+func refreshReferenceData(ctx context.Context, logger *slog.Logger) {
+	if time.Since(time.Unix(0, referenceDataLoadedAt.Load())) < referenceDataTTL {
+		return
+	}
+	reloadReferenceData(ctx, logger)
 }
 
-// Rating values for scoring
-var ratingValues = map[string]float64{
-	"Sell":           0,
-	"Underweight":    1,
-	"Neutral":        2,
-	"Market Perform": 2,
-	"Buy":            3,
-	"Outperform":     3,
-	"Strong Buy":     4,
+// reloadReferenceData recarga el vocabulario y el directorio de brókers; si
+// la lectura falla se siguen usando los últimos cargados hasta el próximo
+// intento, pasado referenceDataTTL
+func reloadReferenceData(ctx context.Context, logger *slog.Logger) {
+	referenceDataLoadedAt.Store(time.Now().UnixNano())
+	if v, err := store.LoadVocabulary(ctx, db); err != nil {
+		logger.Warn("Error leyendo vocabulary, se usa el último cargado", logging.Err(err))
+	} else {
+		vocabulary.Store(v)
+	}
+	if d, err := store.LoadBrokerageDirectory(ctx, db); err != nil {
+		logger.Warn("Error leyendo brokerages, se usa el último directorio cargado", logging.Err(err))
+	} else {
+		brokerages.Store(d)
+	}
 }
 
 func getStockRecommendations(c *gin.Context) {
-	var stocks []Stock
-	query := `SELECT 
-		ticker, company, brokerage, action, rating_from, rating_to, 
-		target_from, target_to, time 
-	FROM stocks`
-	err := db.Select(&stocks, query)
+	refreshReferenceData(c.Request.Context(), requestLog(c))
+
+	where, ok := stocksFilter(c)
+	if !ok {
+		return
+	}
+
+	var stocks []domain.Stock
+	err := db.Select(&stocks, stocksQuery+where)
 	if err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
@@ -208,7 +318,7 @@ func getStockRecommendations(c *gin.Context) {
 	c.JSON(200, recommendations)
 }
 
-func processRecommendations(stocks []Stock) []StockRecommendation {
+func processRecommendations(stocks []domain.Stock) []StockRecommendation {
 	stockMap := make(map[string]StockRecommendation)
 
 	for _, stock := range stocks {
@@ -222,7 +332,10 @@ func processRecommendations(stocks []Stock) []StockRecommendation {
 			Stock:        stock,
 			Score:        currentScore,
 			RatingChange: calculateRatingChange(stock.RatingFrom, stock.RatingTo),
-			TargetChange: formatTargetChange(stock.TargetTo - stock.TargetFrom),
+		}
+		// Sin alguno de los dos precios no hay cambio que informar
+		if stock.TargetFrom != nil && stock.TargetTo != nil {
+			currentRec.TargetChange = formatTargetChange((*stock.TargetTo - *stock.TargetFrom).Float64())
 		}
 
 		if existing, exists := stockMap[stock.Ticker]; !exists || currentScore > existing.Score {
@@ -238,7 +351,7 @@ func processRecommendations(stocks []Stock) []StockRecommendation {
 
 	sort.Slice(recommendations, func(i, j int) bool {
 		if recommendations[i].Score == recommendations[j].Score {
-			return recommendations[i].TargetTo > recommendations[j].TargetTo
+			return targetPrice(recommendations[i].TargetTo) > targetPrice(recommendations[j].TargetTo)
 		}
 		return recommendations[i].Score > recommendations[j].Score
 	})
@@ -246,19 +359,32 @@ func processRecommendations(stocks []Stock) []StockRecommendation {
 	return recommendations
 }
 
-func calculateStockScore(stock Stock, lastUpdated time.Time) float64 {
-	// Puntaje por cambio de rating (más peso)
-	ratingScore := (ratingValues[stock.RatingTo] - ratingValues[stock.RatingFrom]) * 20
+// targetPrice es el precio en dólares para ordenar; sin precio va al final
+func targetPrice(price *domain.Money) float64 {
+	if price == nil {
+		return math.Inf(-1)
+	}
+	return price.Float64()
+}
+
+func calculateStockScore(stock domain.Stock, lastUpdated time.Time) float64 {
+	vocab := currentVocabulary()
+
+	// Puntaje por cambio de rating (más peso); los ratings desconocidos valen 0
+	_, levelFrom, _ := vocab.Rating(stock.RatingFrom)
+	ratingTo, levelTo, _ := vocab.Rating(stock.RatingTo)
+	ratingScore := float64(levelTo-levelFrom) * 20
 
 	// Puntaje por cambio en precio objetivo (porcentaje)
 	var targetChangeScore float64
-	if stock.TargetFrom > 0 {
-		percentChange := ((stock.TargetTo - stock.TargetFrom) / stock.TargetFrom) * 100
+	if stock.TargetFrom != nil && stock.TargetTo != nil && *stock.TargetFrom > 0 {
+		percentChange := ((*stock.TargetTo - *stock.TargetFrom).Float64() / stock.TargetFrom.Float64()) * 100
 		targetChangeScore = percentChange * 0.5
 	}
 
-	// Puntaje por reputación del bróker (más diferenciación)
-	brokerScore := brokerageReputation[stock.Brokerage] * 8
+	// Puntaje por reputación del bróker (más diferenciación); los alias se
+	// resuelven al nombre canónico y los desconocidos valen DefaultReputation
+	brokerScore := currentBrokerages().Reputation(stock.Brokerage) * 8
 
 	// Puntaje por actividad reciente (últimos 7 días)
 	recencyScore := 0.0
@@ -267,19 +393,12 @@ func calculateStockScore(stock Stock, lastUpdated time.Time) float64 {
 	}
 
 	// Puntaje por tipo de acción
-	actionScore := 0.0
-	switch {
-	case strings.Contains(stock.Action, "upgraded"):
-		actionScore = 8
-	case strings.Contains(stock.Action, "initiated"):
-		actionScore = 6
-	case strings.Contains(stock.Action, "reiterated"):
-		actionScore = 5
-	}
+	action, _ := vocab.Action(stock.Action)
+	actionScore := actionScores[action]
 
 	// Bonus especial para Strong Buy
 	strongBuyBonus := 0.0
-	if stock.RatingTo == "Strong Buy" {
+	if ratingTo == domain.RatingStrongBuy {
 		strongBuyBonus = 15
 	}
 
@@ -289,6 +408,30 @@ func calculateStockScore(stock Stock, lastUpdated time.Time) float64 {
 	return math.Max(0, totalScore)
 }
 
+// reportPriceConversionErrors informa los precios que la migración a NUMERIC
+// no pudo convertir y quedaron en NULL
+func reportPriceConversionErrors() {
+	conversionErrors, err := store.ListPriceConversionErrors(context.Background(), db)
+	if err != nil {
+		slog.Error("Error leyendo price_conversion_errors", logging.Err(err))
+		return
+	}
+	if len(conversionErrors) > 0 {
+		slog.Warn("Precios objetivo que no se pudieron convertir a NUMERIC (ver tabla price_conversion_errors)", "count", len(conversionErrors))
+	}
+}
+
+// backfillRatingEvents copia a rating_events los registros de stocks
+// guardados antes del modelo normalizado
+func backfillRatingEvents() error {
+	copied, err := store.BackfillRatingEvents(context.Background(), db)
+	if err != nil {
+		return err
+	}
+	slog.Info("Registros de stocks copiados a rating_events", "count", copied)
+	return nil
+}
+
 func calculateRatingChange(from, to string) string {
 	if from == to {
 		return "Mantiene " + from
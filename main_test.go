@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -11,6 +12,8 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/JuanVel1/stock-api/domain"
 )
 
 // TestCalculateRatingChange verifica la función de cálculo de cambio de rating
@@ -65,17 +68,17 @@ func TestCalculateStockScore(t *testing.T) {
 
 	tests := []struct {
 		name     string
-		stock    Stock
+		stock    domain.Stock
 		time     time.Time
 		expected float64
 	}{
 		{
 			"Upgrade with Target Increase",
-			Stock{
+			domain.Stock{
 				RatingFrom: "Neutral",
 				RatingTo:   "Buy",
-				TargetFrom: 100,
-				TargetTo:   120,
+				TargetFrom: domain.Price(100),
+				TargetTo:   domain.Price(120),
 				Brokerage:  "The Goldman Sachs Group",
 				Action:     "upgraded by",
 			},
@@ -84,11 +87,11 @@ func TestCalculateStockScore(t *testing.T) {
 		},
 		{
 			"Reiterated with No Change",
-			Stock{
+			domain.Stock{
 				RatingFrom: "Buy",
 				RatingTo:   "Buy",
-				TargetFrom: 50,
-				TargetTo:   50,
+				TargetFrom: domain.Price(50),
+				TargetTo:   domain.Price(50),
 				Brokerage:  "Other Broker",
 				Action:     "reiterated by",
 			},
@@ -97,11 +100,11 @@ func TestCalculateStockScore(t *testing.T) {
 		},
 		{
 			"Old Downgrade",
-			Stock{
+			domain.Stock{
 				RatingFrom: "Buy",
 				RatingTo:   "Neutral",
-				TargetFrom: 75,
-				TargetTo:   60,
+				TargetFrom: domain.Price(75),
+				TargetTo:   domain.Price(60),
 				Brokerage:  "Needham & Company LLC",
 				Action:     "target lowered by",
 			},
@@ -121,14 +124,14 @@ func TestCalculateStockScore(t *testing.T) {
 // TestProcessRecommendations verifica el procesamiento de recomendaciones
 func TestProcessRecommendations(t *testing.T) {
     now := time.Now()
-    stocks := []Stock{
+    stocks := []domain.Stock{
         // Recomendación "menor" para AAPL
         {
             Ticker:     "AAPL",
             RatingFrom: "Neutral",
             RatingTo:   "Buy",
-            TargetFrom: 150,
-            TargetTo:   180,
+            TargetFrom: domain.Price(150),
+            TargetTo:   domain.Price(180),
             Brokerage:  "Morgan Stanley",
             Action:     "upgraded by",
             Time:       now.Format(time.RFC3339),
@@ -138,8 +141,8 @@ func TestProcessRecommendations(t *testing.T) {
             Ticker:     "AAPL",
             RatingFrom: "Buy",
             RatingTo:   "Strong Buy",
-            TargetFrom: 180,
-            TargetTo:   200,
+            TargetFrom: domain.Price(180),
+            TargetTo:   domain.Price(200),
             Brokerage:  "The Goldman Sachs Group",
             Action:     "upgraded by",
             Time:       now.Add(-12 * time.Hour).Format(time.RFC3339),
@@ -150,7 +153,7 @@ func TestProcessRecommendations(t *testing.T) {
     
     require.Len(t, recommendations, 1)
     require.Equal(t, "De Buy a Strong Buy", recommendations[0].RatingChange)
-    require.Equal(t, 200.0, recommendations[0].TargetTo)
+    require.Equal(t, 200.0, recommendations[0].TargetTo.Float64())
     
     // Verificar que el score es mayor que el mínimo esperado
     // Score mínimo esperado: 
@@ -202,7 +205,7 @@ func TestStocksEndpoint(t *testing.T) {
 	// Verificar respuesta
 	assert.Equal(t, http.StatusOK, resp.Code)
 
-	var stocks []Stock
+	var stocks []domain.Stock
 	err := json.Unmarshal(resp.Body.Bytes(), &stocks)
 	assert.NoError(t, err)
 
@@ -218,8 +221,8 @@ func setupRouter() *gin.Engine {
 	// Configurar router
 	router := gin.Default()
 	router.GET("/api/stocks", func(c *gin.Context) {
-		var stocks []Stock
-		err := db.Select(&stocks, "SELECT * FROM stocks LIMIT 100")
+		var stocks []domain.Stock
+		err := db.Select(&stocks, stocksQuery+" LIMIT 100")
 		if err != nil {
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
@@ -230,3 +233,164 @@ func setupRouter() *gin.Engine {
 
 	return router
 }
+
+// TestSyncRunInvalidID verifica que un id mal formado responda 400 sin consultar la BD
+func TestSyncRunInvalidID(t *testing.T) {
+	router := gin.New()
+	router.GET("/api/sync-runs/:id", getSyncRun)
+
+	req, _ := http.NewRequest("GET", "/api/sync-runs/123", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+// TestDataQualityInvalidRunID verifica que un run_id mal formado responda 400 sin consultar la BD
+func TestDataQualityInvalidRunID(t *testing.T) {
+	router := gin.New()
+	router.GET("/api/data-quality", getDataQuality)
+
+	req, _ := http.NewRequest("GET", "/api/data-quality?run_id=abc", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+// TestMergeBrokeragesRequiresAdmin verifica la protección del endpoint de fusión
+func TestMergeBrokeragesRequiresAdmin(t *testing.T) {
+	router := gin.New()
+	router.POST("/api/brokerages/:id/merge", requireAdmin, mergeBrokerages)
+
+	merge := func(token string) int {
+		req, _ := http.NewRequest("POST", "/api/brokerages/abc/merge", strings.NewReader(`{"aliases": ["JP Morgan"]}`))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	t.Setenv("ADMIN_TOKEN", "")
+	assert.Equal(t, http.StatusForbidden, merge("secreto"))
+
+	t.Setenv("ADMIN_TOKEN", "secreto")
+	assert.Equal(t, http.StatusUnauthorized, merge(""))
+	assert.Equal(t, http.StatusUnauthorized, merge("otro"))
+	// Con el token correcto llega al handler, que rechaza el id sin consultar la BD
+	assert.Equal(t, http.StatusBadRequest, merge("secreto"))
+}
+
+// TestStocksFilter verifica que los eventos desaparecidos se excluyan por defecto
+func TestStocksFilter(t *testing.T) {
+	filter := func(query string) (string, bool, int) {
+		resp := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(resp)
+		c.Request, _ = http.NewRequest("GET", "/api/stocks?"+query, nil)
+		where, ok := stocksFilter(c)
+		return where, ok, resp.Code
+	}
+
+	where, ok, _ := filter("")
+	assert.True(t, ok)
+	assert.Contains(t, where, "e.disappeared_at IS NULL")
+
+	where, ok, _ = filter("include_disappeared=false")
+	assert.True(t, ok)
+	assert.Contains(t, where, "e.disappeared_at IS NULL")
+
+	where, ok, _ = filter("include_disappeared=true")
+	assert.True(t, ok)
+	assert.Empty(t, where)
+
+	_, ok, code := filter("include_disappeared=todos")
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+// TestChangesInvalidParams verifica que since y type se validen sin consultar la BD
+func TestChangesInvalidParams(t *testing.T) {
+	router := gin.New()
+	router.GET("/api/changes", getChanges)
+
+	for _, query := range []string{"since=ayer", "since=2025-01-13", "type=deleted", "cursor=abc", "cursor=2025-01-13T00:00:00Z"} {
+		req, _ := http.NewRequest("GET", "/api/changes?"+query, nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusBadRequest, resp.Code, query)
+	}
+}
+
+// TestIngestRequiresToken verifica la protección de POST /api/ingest
+func TestIngestRequiresToken(t *testing.T) {
+	router := gin.New()
+	router.POST("/api/ingest", requireIngestToken, postIngest)
+
+	ingest := func(token string) int {
+		req, _ := http.NewRequest("POST", "/api/ingest", strings.NewReader(`{"items": [`))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	t.Setenv("INGEST_TOKENS", "")
+	assert.Equal(t, http.StatusForbidden, ingest("secreto"))
+
+	t.Setenv("INGEST_TOKENS", "partner=secreto, otro=clave")
+	assert.Equal(t, http.StatusUnauthorized, ingest(""))
+	assert.Equal(t, http.StatusUnauthorized, ingest("partner"))
+	// Con un token válido llega al handler, que rechaza el cuerpo sin consultar la BD
+	assert.Equal(t, http.StatusBadRequest, ingest("secreto"))
+	assert.Equal(t, http.StatusBadRequest, ingest("clave"))
+}
+
+// TestDecodeIngestBody verifica los formatos que acepta POST /api/ingest
+func TestDecodeIngestBody(t *testing.T) {
+	payload, warnings, err := decodeIngestBody("application/json",
+		[]byte(`{"items": [{"ticker": "AAPL", "time": "2025-01-13T00:30:05Z"}], "next_page": "AAPL"}`))
+	require.NoError(t, err)
+	assert.Empty(t, warnings)
+	require.Len(t, payload.Items, 1)
+	assert.Equal(t, "AAPL", payload.Items[0].Ticker)
+	assert.Equal(t, "AAPL", payload.NextPage)
+
+	payload, warnings, err = decodeIngestBody("application/x-ndjson",
+		[]byte("{\"ticker\": \"AAPL\"}\n\n{\"ticker\": \"MSFT\", \"sector\": \"tech\"}\n"))
+	require.NoError(t, err)
+	require.Len(t, payload.Items, 2)
+	assert.Equal(t, "MSFT", payload.Items[1].Ticker)
+	assert.Equal(t, []string{"campo desconocido ignorado: items[].sector"}, warnings)
+
+	// Los campos desconocidos no rechazan la petición; se informan una vez
+	payload, warnings, err = decodeIngestBody("application/json",
+		[]byte(`{"items": [{"Ticker": "AAPL", "sector": "tech"}, {"ticker": "MSFT", "sector": "tech"}], "version": 2}`))
+	require.NoError(t, err)
+	require.Len(t, payload.Items, 2)
+	assert.Equal(t, []string{"campo desconocido ignorado: items[].sector", "campo desconocido ignorado: version"}, warnings)
+
+	_, _, err = decodeIngestBody("application/x-ndjson", []byte("{\"ticker\": \"AAPL\"}\nno es json\n"))
+	assert.ErrorContains(t, err, "línea 2")
+}
+
+// TestRequestLoggerRequestID verifica que cada respuesta lleve su request_id
+func TestRequestLoggerRequestID(t *testing.T) {
+	router := gin.New()
+	router.Use(requestLogger)
+	router.GET("/ping", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	req, _ := http.NewRequest("GET", "/ping", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Len(t, resp.Header().Get(requestIDHeader), 16)
+
+	req.Header.Set(requestIDHeader, "abc-123")
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, "abc-123", resp.Header().Get(requestIDHeader))
+}
@@ -0,0 +1,130 @@
+package migrations
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/JuanVel1/stock-api/store"
+)
+
+// advisoryLockID es la clave de pg_advisory_lock con la que se serializan
+// las migraciones en PostgreSQL ("stockapi" en ASCII)
+const advisoryLockID int64 = 0x73746f636b617069
+
+// lockTTL es cuánto dura el candado de CockroachDB sin renovarse. Lo renueva
+// el proceso que lo tiene cada lockTTL/3; si el proceso muere, otro puede
+// tomarlo cuando vence.
+const lockTTL = time.Minute
+
+// lockPollInterval es cada cuánto se vuelve a intentar tomar el candado de
+// CockroachDB mientras lo tiene otro proceso
+const lockPollInterval = time.Second
+
+// lock toma el candado que impide que dos procesos (la API y save, o dos
+// réplicas) apliquen o reviertan migraciones a la vez; las migraciones
+// -- migrate:no-transaction no tienen otra protección. Espera hasta obtenerlo
+// o hasta que se cancele ctx y devuelve la función que lo libera.
+func (m *Migrator) lock(ctx context.Context) (func(), error) {
+	dialect, err := store.DetectDialect(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+	if dialect == store.DialectCockroach {
+		return m.leaseLock(ctx)
+	}
+	return m.advisoryLock(ctx)
+}
+
+// advisoryLock toma pg_advisory_lock en una conexión propia: el candado es de
+// la sesión y se libera en esa misma conexión
+func (m *Migrator) advisoryLock(ctx context.Context) (func(), error) {
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo conexión para el candado de migraciones: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, advisoryLockID); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error tomando el candado de migraciones: %w", err)
+	}
+	return func() {
+		// Si falla el unlock, cerrar la conexión termina la sesión y lo libera
+		conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, advisoryLockID)
+		conn.Close()
+	}, nil
+}
+
+// leaseLock toma el candado en la tabla schema_migrations_lock, porque
+// CockroachDB no implementa pg_advisory_lock. El candado es una fila con
+// vencimiento que se renueva mientras el proceso lo tiene.
+func (m *Migrator) leaseLock(ctx context.Context) (func(), error) {
+	_, err := m.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations_lock (
+			id INT8 PRIMARY KEY,
+			owner TEXT NOT NULL,
+			expires_at TIMESTAMPTZ NOT NULL
+		)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creando tabla schema_migrations_lock: %w", err)
+	}
+
+	owner, err := lockOwner()
+	if err != nil {
+		return nil, err
+	}
+	ttl := int(lockTTL / time.Second)
+	for {
+		// Se toma si no hay fila o si la del otro proceso venció
+		result, err := m.db.ExecContext(ctx, `
+			INSERT INTO schema_migrations_lock (id, owner, expires_at)
+			VALUES (1, $1, now() + $2 * INTERVAL '1 second')
+			ON CONFLICT (id) DO UPDATE SET owner = EXCLUDED.owner, expires_at = EXCLUDED.expires_at
+			WHERE schema_migrations_lock.expires_at < now()`, owner, ttl)
+		if err != nil {
+			return nil, fmt.Errorf("error tomando el candado de migraciones: %w", err)
+		}
+		if taken, err := result.RowsAffected(); err == nil && taken > 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("esperando el candado de migraciones: %w", ctx.Err())
+		case <-time.After(lockPollInterval):
+		}
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(lockTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				m.db.ExecContext(context.Background(), `
+					UPDATE schema_migrations_lock SET expires_at = now() + $2 * INTERVAL '1 second'
+					WHERE id = 1 AND owner = $1`, owner, ttl)
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+		m.db.ExecContext(context.Background(), `DELETE FROM schema_migrations_lock WHERE id = 1 AND owner = $1`, owner)
+	}, nil
+}
+
+// lockOwner identifica al proceso que tiene el candado de CockroachDB
+func lockOwner() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("error generando el dueño del candado de migraciones: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,448 @@
+// Package migrations contiene las migraciones versionadas del esquema de la
+// base de datos. Los scripts SQL se embeben en el binario y los aplican tanto
+// la API como el proceso de sincronización (save).
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/JuanVel1/stock-api/store"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// noTransactionDirective al inicio de un script indica que sus sentencias se
+// ejecutan una por una fuera de una transacción. CockroachDB no permite usar
+// en la misma transacción una columna recién agregada, así que las migraciones
+// que transforman datos entre columnas lo necesitan. Si una de esas migraciones
+// falla a mitad de camino no queda registrada y debe corregirse a mano.
+const noTransactionDirective = "-- migrate:no-transaction"
+
+// Migration representa una versión del esquema con sus scripts up y down
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// AppliedMigration es una fila de la tabla schema_migrations
+type AppliedMigration struct {
+	Version   int       `db:"version"`
+	Name      string    `db:"name"`
+	Checksum  string    `db:"checksum"`
+	AppliedAt time.Time `db:"applied_at"`
+}
+
+// Status describe el estado de una migración en la base de datos
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Load devuelve las migraciones embebidas ordenadas por versión
+func Load() ([]Migration, error) {
+	sub, err := fs.Sub(files, "sql")
+	if err != nil {
+		return nil, err
+	}
+	return load(sub)
+}
+
+// load lee los archivos NNNN_nombre.up.sql / NNNN_nombre.down.sql de fsys
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo migraciones: %v", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+
+		version, name, direction, err := parseFilename(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("error leyendo %s: %v", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("la versión %d tiene nombres distintos: %q y %q", version, m.Name, name)
+		}
+
+		switch direction {
+		case "up":
+			m.Up = string(content)
+		case "down":
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if strings.TrimSpace(m.Up) == "" {
+			return nil, fmt.Errorf("la migración %04d_%s no tiene script up", m.Version, m.Name)
+		}
+		m.Checksum = checksum(m.Up)
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// parseFilename separa "0001_create_stocks.up.sql" en (1, "create_stocks", "up")
+func parseFilename(filename string) (int, string, string, error) {
+	base := strings.TrimSuffix(filename, ".sql")
+
+	var direction string
+	switch {
+	case strings.HasSuffix(base, ".up"):
+		direction = "up"
+	case strings.HasSuffix(base, ".down"):
+		direction = "down"
+	default:
+		return 0, "", "", fmt.Errorf("archivo de migración sin dirección up/down: %s", filename)
+	}
+	base = strings.TrimSuffix(base, "."+direction)
+
+	versionPart, name, found := strings.Cut(base, "_")
+	if !found || name == "" {
+		return 0, "", "", fmt.Errorf("nombre de migración inválido: %s", filename)
+	}
+
+	version, err := strconv.Atoi(versionPart)
+	if err != nil || version <= 0 {
+		return 0, "", "", fmt.Errorf("versión de migración inválida en %s", filename)
+	}
+
+	return version, name, direction, nil
+}
+
+// checksum es el SHA-256 del script up. El down queda afuera a propósito: no
+// cambia el esquema aplicado, se lee del binario recién al revertir y puede
+// corregirse después de aplicar la migración; incluirlo además invalidaría
+// los checksums ya registrados en schema_migrations.
+func checksum(sql string) string {
+	sum := sha256.Sum256([]byte(sql))
+	return hex.EncodeToString(sum[:])
+}
+
+// legacyChecksums son checksums de versiones anteriores de un script up que
+// se corrigió después de publicarse. Las bases que ya aplicaron la versión
+// vieja no necesitan volver a correrla, así que verify los acepta.
+var legacyChecksums = map[int][]string{
+	// 0005 dejaba "$0.00" en NULL y abortaba con precios fuera de rango
+	5: {"97b1a86f609054b4b14ab0c4ddb6a0ba96f363371fcfcafb620a8206aef7d624"},
+}
+
+// matchesChecksum indica si el checksum registrado corresponde al script
+// embebido o a una versión anterior aceptada en legacyChecksums
+func matchesChecksum(migration Migration, applied string) bool {
+	if migration.Checksum == applied {
+		return true
+	}
+	for _, legacy := range legacyChecksums[migration.Version] {
+		if legacy == applied {
+			return true
+		}
+	}
+	return false
+}
+
+// Migrator aplica y revierte migraciones sobre una base de datos
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []Migration
+}
+
+// New crea un Migrator con las migraciones embebidas
+func New(db *sqlx.DB) (*Migrator, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Up aplica todas las migraciones pendientes en orden y devuelve las aplicadas
+func Up(ctx context.Context, db *sqlx.DB) ([]Migration, error) {
+	m, err := New(db)
+	if err != nil {
+		return nil, err
+	}
+	return m.Up(ctx)
+}
+
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT8 PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`)
+	if err != nil {
+		return fmt.Errorf("error creando tabla schema_migrations: %w", err)
+	}
+	return nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]AppliedMigration, error) {
+	var rows []AppliedMigration
+	err := m.db.SelectContext(ctx, &rows,
+		`SELECT version, name, checksum, applied_at FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo schema_migrations: %w", err)
+	}
+
+	applied := make(map[int]AppliedMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// verify comprueba que las migraciones ya aplicadas coincidan con las embebidas
+func (m *Migrator) verify(applied map[int]AppliedMigration) error {
+	known := make(map[int]Migration, len(m.migrations))
+	for _, migration := range m.migrations {
+		known[migration.Version] = migration
+	}
+
+	for version, row := range applied {
+		migration, ok := known[version]
+		if !ok {
+			return fmt.Errorf("la migración %d (%s) está aplicada pero no existe en este binario", version, row.Name)
+		}
+		if !matchesChecksum(migration, row.Checksum) {
+			return fmt.Errorf("checksum distinto para la migración %04d_%s: aplicada %s, embebida %s",
+				version, migration.Name, row.Checksum, migration.Checksum)
+		}
+	}
+	return nil
+}
+
+// Up aplica las migraciones pendientes en orden, cada una en su transacción.
+// Mientras tanto tiene el candado de migraciones (ver lock).
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.verify(applied); err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		if err := m.apply(ctx, migration); err != nil {
+			return done, err
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+func (m *Migrator) apply(ctx context.Context, migration Migration) error {
+	if !inTransaction(migration.Up) {
+		if err := m.execStatements(ctx, migration.Up); err != nil {
+			return fmt.Errorf("error aplicando migración %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		_, err := m.db.ExecContext(ctx,
+			`INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`,
+			migration.Version, migration.Name, migration.Checksum)
+		if err != nil {
+			return fmt.Errorf("error registrando migración %d: %v", migration.Version, err)
+		}
+		return nil
+	}
+
+	return store.RunInTx(ctx, m.db, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+			return fmt.Errorf("error aplicando migración %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`,
+			migration.Version, migration.Name, migration.Checksum)
+		if err != nil {
+			return fmt.Errorf("error registrando migración %d: %w", migration.Version, err)
+		}
+		return nil
+	})
+}
+
+// Down revierte las últimas `steps` migraciones aplicadas con el candado de
+// migraciones tomado
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.verify(applied); err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if strings.TrimSpace(migration.Down) == "" {
+			return done, fmt.Errorf("la migración %04d_%s no es reversible", migration.Version, migration.Name)
+		}
+		if err := m.revert(ctx, migration); err != nil {
+			return done, err
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+func (m *Migrator) revert(ctx context.Context, migration Migration) error {
+	if !inTransaction(migration.Down) {
+		if err := m.execStatements(ctx, migration.Down); err != nil {
+			return fmt.Errorf("error revirtiendo migración %04d_%s: %v", migration.Version, migration.Name, err)
+		}
+		_, err := m.db.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+		if err != nil {
+			return fmt.Errorf("error eliminando registro de la migración %d: %v", migration.Version, err)
+		}
+		return nil
+	}
+
+	return store.RunInTx(ctx, m.db, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, migration.Down); err != nil {
+			return fmt.Errorf("error revirtiendo migración %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+
+		_, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+		if err != nil {
+			return fmt.Errorf("error eliminando registro de la migración %d: %w", migration.Version, err)
+		}
+		return nil
+	})
+}
+
+// execStatements ejecuta cada sentencia del script por separado
+func (m *Migrator) execStatements(ctx context.Context, script string) error {
+	for _, statement := range splitStatements(script) {
+		if _, err := m.db.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("%w (sentencia: %s)", err, firstLine(statement))
+		}
+	}
+	return nil
+}
+
+// inTransaction indica si el script debe ejecutarse dentro de una transacción
+func inTransaction(script string) bool {
+	return !strings.HasPrefix(strings.TrimSpace(script), noTransactionDirective)
+}
+
+// splitStatements separa un script en sentencias terminadas en ";" al final
+// de una línea; las líneas de comentario se descartan
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
+
+func firstLine(statement string) string {
+	line, _, _ := strings.Cut(statement, "\n")
+	return line
+}
+
+// Status devuelve todas las migraciones conocidas indicando si están aplicadas
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.verify(applied); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		row, ok := applied[migration.Version]
+		statuses = append(statuses, Status{
+			Migration: migration,
+			Applied:   ok,
+			AppliedAt: row.AppliedAt,
+		})
+	}
+	return statuses, nil
+}
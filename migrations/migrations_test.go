@@ -0,0 +1,114 @@
+package migrations
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLoadEmbedded verifica que las migraciones embebidas se puedan cargar
+func TestLoadEmbedded(t *testing.T) {
+	migrations, err := Load()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, m := range migrations {
+		assert.NotEmpty(t, m.Checksum)
+		assert.NotEmpty(t, m.Down, "la migración %d debería ser reversible", m.Version)
+		if i > 0 {
+			assert.Greater(t, m.Version, migrations[i-1].Version)
+		}
+	}
+}
+
+// TestLoadOrderAndChecksum verifica el orden y el checksum de las migraciones
+func TestLoadOrderAndChecksum(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0002_add_index.up.sql":      {Data: []byte("CREATE INDEX a ON t (b);")},
+		"0001_create_table.up.sql":   {Data: []byte("CREATE TABLE t (b TEXT);")},
+		"0001_create_table.down.sql": {Data: []byte("DROP TABLE t;")},
+		"README.md":                  {Data: []byte("ignorado")},
+	}
+
+	migrations, err := load(fsys)
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+
+	assert.Equal(t, 1, migrations[0].Version)
+	assert.Equal(t, "create_table", migrations[0].Name)
+	assert.Equal(t, "DROP TABLE t;", migrations[0].Down)
+	assert.Equal(t, checksum("CREATE TABLE t (b TEXT);"), migrations[0].Checksum)
+
+	// Corregir el down no invalida una migración ya aplicada
+	fsys["0001_create_table.down.sql"] = &fstest.MapFile{Data: []byte("DROP TABLE IF EXISTS t;")}
+	edited, err := load(fsys)
+	require.NoError(t, err)
+	assert.Equal(t, migrations[0].Checksum, edited[0].Checksum)
+
+	assert.Equal(t, 2, migrations[1].Version)
+	assert.Empty(t, migrations[1].Down)
+}
+
+// TestLoadInvalidFiles verifica los errores de archivos mal nombrados
+func TestLoadInvalidFiles(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{"Sin dirección", fstest.MapFS{"0001_a.sql": {Data: []byte("SELECT 1;")}}},
+		{"Sin versión", fstest.MapFS{"abc_a.up.sql": {Data: []byte("SELECT 1;")}}},
+		{"Sin script up", fstest.MapFS{"0001_a.down.sql": {Data: []byte("SELECT 1;")}}},
+		{"Nombres distintos", fstest.MapFS{
+			"0001_a.up.sql":   {Data: []byte("SELECT 1;")},
+			"0001_b.down.sql": {Data: []byte("SELECT 1;")},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := load(tt.fsys)
+			assert.Error(t, err)
+		})
+	}
+}
+
+// TestVerifyChecksumMismatch verifica que se detecten migraciones modificadas
+func TestVerifyChecksumMismatch(t *testing.T) {
+	m := &Migrator{migrations: []Migration{{Version: 1, Name: "a", Checksum: "nuevo"}}}
+
+	assert.NoError(t, m.verify(map[int]AppliedMigration{1: {Version: 1, Name: "a", Checksum: "nuevo"}}))
+	assert.Error(t, m.verify(map[int]AppliedMigration{1: {Version: 1, Name: "a", Checksum: "viejo"}}))
+	assert.Error(t, m.verify(map[int]AppliedMigration{2: {Version: 2, Name: "b", Checksum: "x"}}))
+}
+
+// TestVerifyLegacyChecksum verifica que se acepte la versión anterior de 0005
+func TestVerifyLegacyChecksum(t *testing.T) {
+	migrations, err := Load()
+	assert.NoError(t, err)
+	m := &Migrator{migrations: migrations}
+
+	legacy := legacyChecksums[5][0]
+	assert.NoError(t, m.verify(map[int]AppliedMigration{5: {Version: 5, Checksum: legacy}}))
+	assert.Error(t, m.verify(map[int]AppliedMigration{4: {Version: 4, Checksum: legacy}}))
+}
+
+// TestSplitStatements verifica la separación de scripts sin transacción
+func TestSplitStatements(t *testing.T) {
+	script := `-- migrate:no-transaction
+-- Comentario
+ALTER TABLE t ADD COLUMN c INT;
+
+UPDATE t
+SET c = 1;
+DROP TABLE x`
+
+	assert.False(t, inTransaction(script))
+	assert.True(t, inTransaction("CREATE TABLE t (a INT);"))
+	assert.Equal(t, []string{
+		"ALTER TABLE t ADD COLUMN c INT;",
+		"UPDATE t\nSET c = 1;",
+		"DROP TABLE x",
+	}, splitStatements(script))
+}
@@ -0,0 +1,16 @@
+-- Tabla principal de recomendaciones. Se usa IF NOT EXISTS para adoptar
+-- bases de datos creadas antes de que existieran las migraciones.
+CREATE TABLE IF NOT EXISTS stocks (
+    ticker TEXT NOT NULL,
+    company TEXT,
+    brokerage TEXT,
+    action TEXT,
+    rating_from TEXT,
+    rating_to TEXT,
+    target_from TEXT,
+    target_to TEXT,
+    time TEXT NOT NULL,
+    PRIMARY KEY (ticker, time)
+);
+
+CREATE INDEX IF NOT EXISTS idx_stocks_ticker ON stocks (ticker);
@@ -0,0 +1,9 @@
+-- Cursor de paginación confirmado por cada fuente para poder reanudar
+-- una sincronización interrumpida desde la última página guardada.
+CREATE TABLE IF NOT EXISTS sync_state (
+    source TEXT PRIMARY KEY,
+    next_page TEXT NOT NULL DEFAULT '',
+    pages_committed INT8 NOT NULL DEFAULT 0,
+    completed BOOL NOT NULL DEFAULT false,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
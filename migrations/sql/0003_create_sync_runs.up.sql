@@ -0,0 +1,17 @@
+-- Historial de ejecuciones del proceso save (sync e import).
+CREATE TABLE IF NOT EXISTS sync_runs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    kind TEXT NOT NULL,
+    source TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'running',
+    started_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    finished_at TIMESTAMPTZ,
+    pages_fetched INT8 NOT NULL DEFAULT 0,
+    rows_inserted INT8 NOT NULL DEFAULT 0,
+    rows_updated INT8 NOT NULL DEFAULT 0,
+    rows_failed INT8 NOT NULL DEFAULT 0,
+    retries INT8 NOT NULL DEFAULT 0,
+    error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_sync_runs_started_at ON sync_runs (started_at DESC);
@@ -0,0 +1,15 @@
+-- Registros de lotes que agotaron sus reintentos, para reprocesarlos con
+-- el subcomando requeue.
+CREATE TABLE IF NOT EXISTS dead_letters (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    run_id UUID,
+    ticker TEXT,
+    time TEXT,
+    payload JSONB NOT NULL,
+    error TEXT NOT NULL,
+    attempts INT8 NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    requeued_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_dead_letters_created_at ON dead_letters (created_at);
@@ -0,0 +1,15 @@
+-- migrate:no-transaction
+-- Vuelve a guardar los precios como TEXT con el formato de la API ("$135.00").
+ALTER TABLE stocks ADD COLUMN IF NOT EXISTS target_from_text TEXT;
+ALTER TABLE stocks ADD COLUMN IF NOT EXISTS target_to_text TEXT;
+
+UPDATE stocks SET
+    target_from_text = COALESCE('$' || target_from::TEXT, ''),
+    target_to_text = COALESCE('$' || target_to::TEXT, '');
+
+ALTER TABLE stocks DROP COLUMN target_from;
+ALTER TABLE stocks DROP COLUMN target_to;
+ALTER TABLE stocks RENAME COLUMN target_from_text TO target_from;
+ALTER TABLE stocks RENAME COLUMN target_to_text TO target_to;
+
+DROP TABLE IF EXISTS price_conversion_errors;
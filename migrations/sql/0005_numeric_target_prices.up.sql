@@ -0,0 +1,62 @@
+-- migrate:no-transaction
+-- Convierte target_from/target_to de TEXT ("$135.00") a NUMERIC con las
+-- mismas reglas que domain.ParsePriceString:
+--   * sin precio: NULL o, sin espacios al inicio y al final y sin distinguir
+--     mayúsculas, '', 'null' o 'N/A' (domain.missingPrice); queda en NULL.
+--   * precio: sin esos espacios y sin '$' ni ',', un número que redondeado a
+--     dos decimales entra en NUMERIC(14,2); '$0.00' es un precio de cero.
+-- El resto, incluidos los números fuera de rango, queda en NULL y se registra
+-- en price_conversion_errors para revisarlo. El rango se verifica antes del
+-- cast: un desborde abortaría la migración a mitad de camino.
+CREATE TABLE IF NOT EXISTS price_conversion_errors (
+    ticker TEXT NOT NULL,
+    time TEXT NOT NULL,
+    column_name TEXT NOT NULL,
+    raw_value TEXT,
+    detected_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (ticker, time, column_name)
+);
+
+ALTER TABLE stocks ADD COLUMN IF NOT EXISTS target_from_num NUMERIC(14, 2);
+ALTER TABLE stocks ADD COLUMN IF NOT EXISTS target_to_num NUMERIC(14, 2);
+
+INSERT INTO price_conversion_errors (ticker, time, column_name, raw_value)
+SELECT ticker, time, 'target_from', target_from
+FROM stocks
+WHERE target_from IS NOT NULL
+  AND upper(regexp_replace(target_from, '^[[:space:]]+|[[:space:]]+$', '', 'g')) NOT IN ('', 'NULL', 'N/A')
+  AND NOT CASE
+      WHEN regexp_replace(regexp_replace(target_from, '^[[:space:]]+|[[:space:]]+$', '', 'g'), '[$,]', '', 'g') ~ '^-?[0-9]+(\.[0-9]+)?$'
+      THEN abs(round(regexp_replace(regexp_replace(target_from, '^[[:space:]]+|[[:space:]]+$', '', 'g'), '[$,]', '', 'g')::NUMERIC, 2)) <= 999999999999.99
+      ELSE false
+  END
+ON CONFLICT DO NOTHING;
+
+INSERT INTO price_conversion_errors (ticker, time, column_name, raw_value)
+SELECT ticker, time, 'target_to', target_to
+FROM stocks
+WHERE target_to IS NOT NULL
+  AND upper(regexp_replace(target_to, '^[[:space:]]+|[[:space:]]+$', '', 'g')) NOT IN ('', 'NULL', 'N/A')
+  AND NOT CASE
+      WHEN regexp_replace(regexp_replace(target_to, '^[[:space:]]+|[[:space:]]+$', '', 'g'), '[$,]', '', 'g') ~ '^-?[0-9]+(\.[0-9]+)?$'
+      THEN abs(round(regexp_replace(regexp_replace(target_to, '^[[:space:]]+|[[:space:]]+$', '', 'g'), '[$,]', '', 'g')::NUMERIC, 2)) <= 999999999999.99
+      ELSE false
+  END
+ON CONFLICT DO NOTHING;
+
+UPDATE stocks SET
+    target_from_num = CASE
+        WHEN regexp_replace(regexp_replace(target_from, '^[[:space:]]+|[[:space:]]+$', '', 'g'), '[$,]', '', 'g') !~ '^-?[0-9]+(\.[0-9]+)?$' THEN NULL
+        WHEN abs(round(regexp_replace(regexp_replace(target_from, '^[[:space:]]+|[[:space:]]+$', '', 'g'), '[$,]', '', 'g')::NUMERIC, 2)) > 999999999999.99 THEN NULL
+        ELSE regexp_replace(regexp_replace(target_from, '^[[:space:]]+|[[:space:]]+$', '', 'g'), '[$,]', '', 'g')::NUMERIC(14, 2)
+    END,
+    target_to_num = CASE
+        WHEN regexp_replace(regexp_replace(target_to, '^[[:space:]]+|[[:space:]]+$', '', 'g'), '[$,]', '', 'g') !~ '^-?[0-9]+(\.[0-9]+)?$' THEN NULL
+        WHEN abs(round(regexp_replace(regexp_replace(target_to, '^[[:space:]]+|[[:space:]]+$', '', 'g'), '[$,]', '', 'g')::NUMERIC, 2)) > 999999999999.99 THEN NULL
+        ELSE regexp_replace(regexp_replace(target_to, '^[[:space:]]+|[[:space:]]+$', '', 'g'), '[$,]', '', 'g')::NUMERIC(14, 2)
+    END;
+
+ALTER TABLE stocks DROP COLUMN target_from;
+ALTER TABLE stocks DROP COLUMN target_to;
+ALTER TABLE stocks RENAME COLUMN target_from_num TO target_from;
+ALTER TABLE stocks RENAME COLUMN target_to_num TO target_to;
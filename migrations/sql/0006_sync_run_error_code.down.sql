@@ -0,0 +1,2 @@
+ALTER TABLE sync_runs DROP COLUMN IF EXISTS error_class;
+ALTER TABLE sync_runs DROP COLUMN IF EXISTS error_code;
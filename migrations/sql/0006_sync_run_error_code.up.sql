@@ -0,0 +1,4 @@
+-- SQLSTATE y clase (retryable, connection, permanent) del último error de
+-- base de datos de cada ejecución
+ALTER TABLE sync_runs ADD COLUMN IF NOT EXISTS error_code TEXT;
+ALTER TABLE sync_runs ADD COLUMN IF NOT EXISTS error_class TEXT;
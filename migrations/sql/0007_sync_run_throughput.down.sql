@@ -0,0 +1,2 @@
+ALTER TABLE sync_runs DROP COLUMN IF EXISTS rows_per_second;
+ALTER TABLE sync_runs DROP COLUMN IF EXISTS rows_copied;
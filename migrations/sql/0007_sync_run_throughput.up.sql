@@ -0,0 +1,3 @@
+-- Filas cargadas por COPY y throughput de escritura de cada ejecución
+ALTER TABLE sync_runs ADD COLUMN IF NOT EXISTS rows_copied INT8 NOT NULL DEFAULT 0;
+ALTER TABLE sync_runs ADD COLUMN IF NOT EXISTS rows_per_second FLOAT8;
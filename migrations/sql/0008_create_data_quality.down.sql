@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS data_quality_issues;
+DROP TABLE IF EXISTS data_quality_reports;
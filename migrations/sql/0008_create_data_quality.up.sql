@@ -0,0 +1,22 @@
+-- Reporte de calidad de datos de cada ejecución: totales por ejecución y
+-- conteo por regla con algunos registros de ejemplo.
+CREATE TABLE IF NOT EXISTS data_quality_reports (
+    run_id UUID PRIMARY KEY,
+    source TEXT NOT NULL,
+    checked INT8 NOT NULL DEFAULT 0,
+    accepted INT8 NOT NULL DEFAULT 0,
+    rejected INT8 NOT NULL DEFAULT 0,
+    flagged INT8 NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_data_quality_reports_created_at ON data_quality_reports (created_at DESC);
+
+CREATE TABLE IF NOT EXISTS data_quality_issues (
+    run_id UUID NOT NULL REFERENCES data_quality_reports (run_id) ON DELETE CASCADE,
+    rule TEXT NOT NULL,
+    severity TEXT NOT NULL,
+    count INT8 NOT NULL DEFAULT 0,
+    samples JSONB NOT NULL DEFAULT '[]',
+    PRIMARY KEY (run_id, rule)
+);
@@ -0,0 +1,6 @@
+-- migrate:no-transaction
+ALTER TABLE stocks DROP COLUMN IF EXISTS normalized_action;
+ALTER TABLE stocks DROP COLUMN IF EXISTS normalized_rating_from;
+ALTER TABLE stocks DROP COLUMN IF EXISTS normalized_rating_to;
+
+DROP TABLE IF EXISTS vocabulary;
@@ -0,0 +1,68 @@
+-- migrate:no-transaction
+-- Vocabulario de ratings y acciones: traduce los textos de cada bróker
+-- ("Overweight", "Sector Perform", "upgraded by") a valores canónicos con su
+-- nivel numérico. raw_value se guarda en minúsculas y con espacios simples.
+-- stocks guarda los valores canónicos calculados al ingerir; vacío si el
+-- texto no está en el vocabulario.
+CREATE TABLE IF NOT EXISTS vocabulary (
+    kind TEXT NOT NULL,
+    raw_value TEXT NOT NULL,
+    canonical TEXT NOT NULL,
+    level INT8,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (kind, raw_value)
+);
+
+INSERT INTO vocabulary (kind, raw_value, canonical, level) VALUES
+    ('rating', 'strong-buy', 'strong_buy', 4),
+    ('rating', 'strong buy', 'strong_buy', 4),
+    ('rating', 'conviction buy', 'strong_buy', 4),
+    ('rating', 'top pick', 'strong_buy', 4),
+    ('rating', 'buy', 'buy', 3),
+    ('rating', 'speculative buy', 'buy', 3),
+    ('rating', 'moderate buy', 'buy', 3),
+    ('rating', 'accumulate', 'buy', 3),
+    ('rating', 'add', 'buy', 3),
+    ('rating', 'outperform', 'buy', 3),
+    ('rating', 'market outperform', 'buy', 3),
+    ('rating', 'sector outperform', 'buy', 3),
+    ('rating', 'outperformer', 'buy', 3),
+    ('rating', 'overweight', 'buy', 3),
+    ('rating', 'positive', 'buy', 3),
+    ('rating', 'hold', 'hold', 2),
+    ('rating', 'neutral', 'hold', 2),
+    ('rating', 'market perform', 'hold', 2),
+    ('rating', 'sector perform', 'hold', 2),
+    ('rating', 'peer perform', 'hold', 2),
+    ('rating', 'equal weight', 'hold', 2),
+    ('rating', 'sector weight', 'hold', 2),
+    ('rating', 'in-line', 'hold', 2),
+    ('rating', 'underperform', 'underperform', 1),
+    ('rating', 'market underperform', 'underperform', 1),
+    ('rating', 'sector underperform', 'underperform', 1),
+    ('rating', 'underweight', 'underperform', 1),
+    ('rating', 'reduce', 'underperform', 1),
+    ('rating', 'negative', 'underperform', 1),
+    ('rating', 'moderate sell', 'underperform', 1),
+    ('rating', 'sell', 'sell', 0),
+    ('rating', 'strong sell', 'sell', 0),
+    ('action', 'upgraded by', 'upgrade', NULL),
+    ('action', 'downgraded by', 'downgrade', NULL),
+    ('action', 'initiated by', 'initiate', NULL),
+    ('action', 'reiterated by', 'reiterate', NULL),
+    ('action', 'target raised by', 'target_raised', NULL),
+    ('action', 'target lowered by', 'target_lowered', NULL),
+    ('action', 'target set by', 'target_set', NULL)
+ON CONFLICT (kind, raw_value) DO NOTHING;
+
+ALTER TABLE stocks ADD COLUMN IF NOT EXISTS normalized_action TEXT NOT NULL DEFAULT '';
+ALTER TABLE stocks ADD COLUMN IF NOT EXISTS normalized_rating_from TEXT NOT NULL DEFAULT '';
+ALTER TABLE stocks ADD COLUMN IF NOT EXISTS normalized_rating_to TEXT NOT NULL DEFAULT '';
+
+UPDATE stocks SET
+    normalized_action = COALESCE((SELECT canonical FROM vocabulary v
+        WHERE v.kind = 'action' AND v.raw_value = lower(trim(stocks.action))), ''),
+    normalized_rating_from = COALESCE((SELECT canonical FROM vocabulary v
+        WHERE v.kind = 'rating' AND v.raw_value = lower(trim(stocks.rating_from))), ''),
+    normalized_rating_to = COALESCE((SELECT canonical FROM vocabulary v
+        WHERE v.kind = 'rating' AND v.raw_value = lower(trim(stocks.rating_to))), '');
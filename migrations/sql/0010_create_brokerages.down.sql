@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS brokerage_aliases;
+DROP TABLE IF EXISTS brokerages;
@@ -0,0 +1,49 @@
+-- Brókers con su nombre canónico y reputación. brokerage_aliases guarda cada
+-- nombre con el que aparece un bróker en las fuentes; alias_key es la clave
+-- de domain.BrokerageKey (sin mayúsculas, puntuación ni sufijos como "Inc.").
+-- El proceso save agrega los brókers nuevos al ingerir.
+CREATE TABLE IF NOT EXISTS brokerages (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name TEXT NOT NULL UNIQUE,
+    reputation FLOAT8 NOT NULL DEFAULT 0.9,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS brokerage_aliases (
+    alias_key TEXT PRIMARY KEY,
+    alias TEXT NOT NULL,
+    brokerage_id UUID NOT NULL REFERENCES brokerages (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_brokerage_aliases_brokerage_id ON brokerage_aliases (brokerage_id);
+
+INSERT INTO brokerages (name, reputation) VALUES
+    ('The Goldman Sachs Group', 1.2),
+    ('Morgan Stanley', 1.1),
+    ('JPMorgan Chase & Co.', 1.15),
+    ('Citigroup', 1.05),
+    ('Benchmark', 1.0),
+    ('Needham & Company LLC', 0.95),
+    ('Wedbush', 0.98),
+    ('Truist Financial', 0.97)
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO brokerage_aliases (alias_key, alias, brokerage_id)
+SELECT a.alias_key, a.alias, b.id
+FROM (VALUES
+    ('goldmansachs', 'The Goldman Sachs Group', 'The Goldman Sachs Group'),
+    ('morganstanley', 'Morgan Stanley', 'Morgan Stanley'),
+    ('jpmorganchase', 'JPMorgan Chase & Co.', 'JPMorgan Chase & Co.'),
+    ('jpmorgan', 'JP Morgan', 'JPMorgan Chase & Co.'),
+    ('citigroup', 'Citigroup', 'Citigroup'),
+    ('citi', 'Citi', 'Citigroup'),
+    ('benchmark', 'Benchmark', 'Benchmark'),
+    ('needham', 'Needham & Company LLC', 'Needham & Company LLC'),
+    ('wedbush', 'Wedbush', 'Wedbush'),
+    ('truistfinancial', 'Truist Financial', 'Truist Financial'),
+    ('truist', 'Truist Securities', 'Truist Financial')
+) AS a (alias_key, alias, name)
+JOIN brokerages b ON b.name = a.name
+ON CONFLICT (alias_key) DO NOTHING;
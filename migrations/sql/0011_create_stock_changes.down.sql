@@ -0,0 +1,3 @@
+ALTER TABLE stocks DROP COLUMN IF EXISTS disappeared_at;
+
+DROP TABLE IF EXISTS stock_changes;
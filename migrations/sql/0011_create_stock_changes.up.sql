@@ -0,0 +1,17 @@
+-- Cambios detectados por cada sincronización: registros nuevos, registros
+-- actualizados con el detalle por campo (diff: {"campo": {"old": ..., "new": ...}})
+-- y registros que desaparecieron de la fuente en una sincronización completa.
+CREATE TABLE IF NOT EXISTS stock_changes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    run_id UUID,
+    ticker TEXT NOT NULL,
+    time TEXT NOT NULL,
+    change_type TEXT NOT NULL,
+    diff JSONB,
+    detected_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_changes_detected_at ON stock_changes (detected_at);
+CREATE INDEX IF NOT EXISTS idx_stock_changes_ticker ON stock_changes (ticker, time);
+
+ALTER TABLE stocks ADD COLUMN IF NOT EXISTS disappeared_at TIMESTAMPTZ;
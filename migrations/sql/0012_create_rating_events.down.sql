@@ -0,0 +1,36 @@
+-- migrate:no-transaction
+-- Devuelve a stocks lo escrito en rating_events después de la migración.
+-- stocks tiene una fila por ticker y fecha: si varios brókers publicaron a la
+-- vez se conserva uno.
+INSERT INTO stocks (
+    ticker, company, brokerage, action, rating_from, rating_to,
+    target_from, target_to, time, normalized_action,
+    normalized_rating_from, normalized_rating_to, disappeared_at
+)
+SELECT DISTINCT ON (e.ticker, e.time)
+    e.ticker, c.name, e.brokerage, e.action, e.rating_from, e.rating_to,
+    e.target_from, e.target_to, e.time, e.normalized_action,
+    e.normalized_rating_from, e.normalized_rating_to, e.disappeared_at
+FROM rating_events e
+JOIN companies c ON c.ticker = e.ticker
+ORDER BY e.ticker, e.time, e.updated_at DESC
+ON CONFLICT (ticker, time) DO UPDATE SET
+    company = EXCLUDED.company,
+    brokerage = EXCLUDED.brokerage,
+    action = EXCLUDED.action,
+    rating_from = EXCLUDED.rating_from,
+    rating_to = EXCLUDED.rating_to,
+    target_from = EXCLUDED.target_from,
+    target_to = EXCLUDED.target_to,
+    normalized_action = EXCLUDED.normalized_action,
+    normalized_rating_from = EXCLUDED.normalized_rating_from,
+    normalized_rating_to = EXCLUDED.normalized_rating_to,
+    disappeared_at = EXCLUDED.disappeared_at;
+
+ALTER TABLE stock_changes DROP COLUMN IF EXISTS brokerage_id;
+
+DROP TABLE IF EXISTS rating_events;
+
+DROP TABLE IF EXISTS companies;
+
+DELETE FROM brokerages WHERE name = 'Unknown';
@@ -0,0 +1,53 @@
+-- migrate:no-transaction
+-- Modelo normalizado: companies tiene una fila por ticker y rating_events un
+-- evento por ticker, bróker canónico (brokerages, 0010) y fecha. El evento
+-- guarda además el nombre del bróker tal como lo publicó la fuente.
+--
+-- Las filas de stocks se copian a rating_events con store.BackfillRatingEvents
+-- (lo ejecutan save y la API al aplicar esta migración) porque resolver el
+-- bróker necesita domain.BrokerageKey. stocks deja de escribirse y se
+-- conserva para poder revertir.
+CREATE TABLE IF NOT EXISTS companies (
+    ticker TEXT PRIMARY KEY,
+    name TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Bróker de los registros que llegan sin nombre (domain.UnknownBrokerage)
+INSERT INTO brokerages (name) VALUES ('Unknown') ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO brokerage_aliases (alias_key, alias, brokerage_id)
+SELECT 'unknown', 'Unknown', id FROM brokerages WHERE name = 'Unknown'
+ON CONFLICT (alias_key) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS rating_events (
+    ticker TEXT NOT NULL REFERENCES companies (ticker),
+    brokerage_id UUID NOT NULL REFERENCES brokerages (id),
+    time TEXT NOT NULL,
+    brokerage TEXT NOT NULL DEFAULT '',
+    action TEXT NOT NULL DEFAULT '',
+    rating_from TEXT NOT NULL DEFAULT '',
+    rating_to TEXT NOT NULL DEFAULT '',
+    target_from NUMERIC(14, 2),
+    target_to NUMERIC(14, 2),
+    normalized_action TEXT NOT NULL DEFAULT '',
+    normalized_rating_from TEXT NOT NULL DEFAULT '',
+    normalized_rating_to TEXT NOT NULL DEFAULT '',
+    disappeared_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (ticker, brokerage_id, time)
+);
+
+CREATE INDEX IF NOT EXISTS idx_rating_events_time ON rating_events (time DESC);
+CREATE INDEX IF NOT EXISTS idx_rating_events_brokerage_id ON rating_events (brokerage_id);
+
+-- La empresa toma el nombre del registro más reciente de cada ticker
+INSERT INTO companies (ticker, name)
+SELECT DISTINCT ON (ticker) ticker, COALESCE(company, '')
+FROM stocks
+ORDER BY ticker, time DESC
+ON CONFLICT (ticker) DO NOTHING;
+
+ALTER TABLE stock_changes ADD COLUMN IF NOT EXISTS brokerage_id UUID;
@@ -0,0 +1,7 @@
+-- migrate:no-transaction
+ALTER TABLE sync_runs DROP COLUMN IF EXISTS rows_skipped;
+
+ALTER TABLE rating_events DROP COLUMN IF EXISTS page_ref;
+ALTER TABLE rating_events DROP COLUMN IF EXISTS fetched_at;
+ALTER TABLE rating_events DROP COLUMN IF EXISTS source_priority;
+ALTER TABLE rating_events DROP COLUMN IF EXISTS source_id;
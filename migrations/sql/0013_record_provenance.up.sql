@@ -0,0 +1,12 @@
+-- migrate:no-transaction
+-- Origen de cada evento: la fuente que lo escribió (source_id; vacío en los
+-- eventos anteriores), la prioridad que tenía la fuente en ese momento,
+-- cuándo se leyó y la página de la fuente donde venía. Un evento escrito por
+-- una fuente solo lo reemplaza otra fuente de prioridad igual o mayor.
+ALTER TABLE rating_events ADD COLUMN IF NOT EXISTS source_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE rating_events ADD COLUMN IF NOT EXISTS source_priority INT8 NOT NULL DEFAULT 0;
+ALTER TABLE rating_events ADD COLUMN IF NOT EXISTS fetched_at TIMESTAMPTZ;
+ALTER TABLE rating_events ADD COLUMN IF NOT EXISTS page_ref TEXT NOT NULL DEFAULT '';
+
+-- Registros que no se escribieron porque otra fuente con más prioridad ya los tenía
+ALTER TABLE sync_runs ADD COLUMN IF NOT EXISTS rows_skipped INT8 NOT NULL DEFAULT 0;
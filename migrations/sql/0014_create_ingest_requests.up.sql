@@ -0,0 +1,14 @@
+-- Claves de idempotencia de POST /api/ingest, por fuente. Mientras la
+-- petición se procesa status_code es NULL; al terminar se guarda la
+-- respuesta para devolverla igual si el cliente reintenta con la misma clave.
+CREATE TABLE IF NOT EXISTS ingest_requests (
+    source TEXT NOT NULL,
+    idempotency_key TEXT NOT NULL,
+    request_hash TEXT NOT NULL,
+    run_id UUID,
+    status_code INT8,
+    response JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    completed_at TIMESTAMPTZ,
+    PRIMARY KEY (source, idempotency_key)
+);
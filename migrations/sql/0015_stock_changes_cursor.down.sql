@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_stock_changes_cursor;
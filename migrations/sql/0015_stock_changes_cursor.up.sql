@@ -0,0 +1,3 @@
+-- GET /api/changes pagina con el cursor (detected_at, id); el índice sigue
+-- ese orden.
+CREATE INDEX IF NOT EXISTS idx_stock_changes_cursor ON stock_changes (detected_at, id);
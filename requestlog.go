@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// requestIDHeader es el encabezado con el id de la petición; si el
+	// cliente o un proxy lo envía se conserva
+	requestIDHeader = "X-Request-ID"
+	// requestLoggerKey guarda en el contexto de gin el logger de la petición
+	requestLoggerKey = "requestLogger"
+)
+
+// newRequestID genera un id aleatorio de 16 caracteres hexadecimales
+func newRequestID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(buf)
+}
+
+// requestLogger asigna un request_id a cada petición, lo devuelve en
+// X-Request-ID y registra el resultado con el método, la ruta, el estado y
+// la duración. Los handlers obtienen el logger con el request_id con requestLog.
+func requestLogger(c *gin.Context) {
+	start := time.Now()
+	requestID := c.GetHeader(requestIDHeader)
+	if requestID == "" || len(requestID) > 64 {
+		requestID = newRequestID()
+	}
+	c.Header(requestIDHeader, requestID)
+
+	logger := slog.Default().With("request_id", requestID)
+	c.Set(requestLoggerKey, logger)
+	c.Next()
+
+	attrs := []any{
+		"method", c.Request.Method,
+		"path", c.Request.URL.Path,
+		"query", c.Request.URL.RawQuery,
+		"status", c.Writer.Status(),
+		"duration_ms", time.Since(start).Milliseconds(),
+		"client_ip", c.ClientIP(),
+		"bytes", c.Writer.Size(),
+	}
+	if errs := c.Errors.ByType(gin.ErrorTypeAny); len(errs) > 0 {
+		attrs = append(attrs, "errors", errs.String())
+	}
+	switch status := c.Writer.Status(); {
+	case status >= 500:
+		logger.Error("petición atendida", attrs...)
+	case status >= 400:
+		logger.Warn("petición atendida", attrs...)
+	default:
+		logger.Info("petición atendida", attrs...)
+	}
+}
+
+// requestLog devuelve el logger de la petición, con su request_id
+func requestLog(c *gin.Context) *slog.Logger {
+	if logger, ok := c.Get(requestLoggerKey); ok {
+		if l, ok := logger.(*slog.Logger); ok {
+			return l
+		}
+	}
+	return slog.Default()
+}
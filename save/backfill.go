@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/JuanVel1/stock-api/migrations"
+	"github.com/JuanVel1/stock-api/store"
+)
+
+// runBackfill implementa el subcomando `backfill`: repite la copia de stocks a
+// rating_events que hace la migración create_rating_events. Es idempotente,
+// así que sirve para completar una copia que falló después de registrar la
+// migración.
+func runBackfill(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	registerDBFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := dbConfig.validate(); err != nil {
+		return err
+	}
+
+	if err := connectDB(ctx); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+	for _, s := range statuses {
+		if s.Name == store.RatingEventsMigration && !s.Applied {
+			return fmt.Errorf("la migración %s no está aplicada; ejecutar antes `save migrate up`", s.Name)
+		}
+	}
+
+	loadReferenceData()
+	return backfillRatingEvents(ctx)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/JuanVel1/stock-api/domain"
+	"github.com/JuanVel1/stock-api/logging"
+	"github.com/JuanVel1/stock-api/store"
+)
+
+// brokerages es el directorio de brókers conocidos; se carga en initDB y se
+// recarga cuando resolveBrokerages agrega nombres nuevos
+var brokerages = domain.DefaultBrokerageDirectory()
+
+// loadBrokerages lee el directorio de brókers de la base de datos
+func loadBrokerages() error {
+	directory, err := store.LoadBrokerageDirectory(context.Background(), db)
+	if err != nil {
+		return fmt.Errorf("error leyendo brokerages: %w", err)
+	}
+	brokerages = directory
+	return nil
+}
+
+// resolveBrokerages agrega a la tabla brokerages los nombres de bróker que
+// no coinciden con ningún alias conocido y completa el BrokerageID de cada
+// registro. Un fallo al registrar solo se informa: los registros de brókers
+// desconocidos quedan sin id y sus lotes fallan.
+func resolveBrokerages(stocks []domain.Stock) {
+	directory, registered, err := store.ResolveBrokerages(context.Background(), db, brokerages, stocks)
+	if err != nil {
+		slog.Warn("Error registrando brókers nuevos", logging.Err(err))
+	}
+	if len(registered) > 0 {
+		slog.Info("Brókers nuevos registrados", "count", len(registered), "brokerages", registered)
+	}
+	brokerages = directory
+}
+
+// markSeen agrega a seen las claves de los registros de una página. Debe
+// llamarse después de resolveBrokerages: los brókers que no están en el
+// directorio no tienen eventos guardados.
+func markSeen(seen map[store.StockKey]bool, page []domain.RawStock) {
+	for _, raw := range page {
+		if b, ok := brokerages.Resolve(domain.BrokerageName(raw.Brokerage)); ok {
+			seen[store.StockKey{Ticker: raw.Ticker, BrokerageID: b.ID, Time: raw.Time}] = true
+		}
+	}
+}
+
+// backfillRatingEvents copia a rating_events los registros de stocks
+// guardados antes del modelo normalizado. Si falla, la migración ya quedó
+// registrada y no se vuelve a intentar sola: se repite con `save backfill`.
+func backfillRatingEvents(ctx context.Context) error {
+	copied, err := store.BackfillRatingEvents(ctx, db)
+	if err != nil {
+		return fmt.Errorf("%w; se puede reintentar con `save backfill`", err)
+	}
+	slog.Info("Registros de stocks copiados a rating_events", "count", copied)
+	if err := loadBrokerages(); err != nil {
+		slog.Warn("Error recargando brókers", logging.Err(err))
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JuanVel1/stock-api/domain"
+	"github.com/JuanVel1/stock-api/store"
+)
+
+// TestMarkSeen verifica la resolución de brókers y las claves vistas
+func TestMarkSeen(t *testing.T) {
+	previous := brokerages
+	t.Cleanup(func() { brokerages = previous })
+	brokerages = domain.NewBrokerageDirectory([]domain.Brokerage{
+		{ID: "citi-id", Name: "Citigroup", Aliases: []string{"Citi"}},
+		{ID: "unknown-id", Name: domain.UnknownBrokerage},
+	})
+
+	stocks := []domain.Stock{
+		{Ticker: "AAPL", Brokerage: "Citi", Time: "t1"},
+		{Ticker: "AAPL", Brokerage: "", Time: "t1"},
+		{Ticker: "AAPL", Brokerage: "Nuevo Bróker", Time: "t1"},
+	}
+	brokerages.AssignIDs(stocks)
+	assert.Equal(t, "citi-id", stocks[0].BrokerageID)
+	assert.Equal(t, "unknown-id", stocks[1].BrokerageID)
+	assert.Empty(t, stocks[2].BrokerageID)
+
+	seen := make(map[store.StockKey]bool)
+	markSeen(seen, []domain.RawStock{
+		{Ticker: "AAPL", Brokerage: "Citigroup Inc.", Time: "t1"},
+		{Ticker: "AAPL", Brokerage: "Nuevo Bróker", Time: "t1"},
+	})
+	assert.Equal(t, map[store.StockKey]bool{{Ticker: "AAPL", BrokerageID: "citi-id", Time: "t1"}: true}, seen)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/JuanVel1/stock-api/domain"
+	"github.com/JuanVel1/stock-api/logging"
+	"github.com/JuanVel1/stock-api/store"
+)
+
+// stagingTable es la tabla temporal donde COPY deja los registros antes de
+// mezclarlos con rating_events
+const stagingTable = "stocks_staging"
+
+// stagingColumns son las columnas en el orden en que se envían por COPY
+var stagingColumns = []string{
+	"ticker", "brokerage_id", "time", "brokerage", "action",
+	"rating_from", "rating_to", "target_from", "target_to",
+	"normalized_action", "normalized_rating_from", "normalized_rating_to",
+	"source_id", "source_priority", "fetched_at", "page_ref",
+}
+
+// useBulkLoad indica si una carga de n registros va por COPY en lugar de upserts
+func (o writerOptions) useBulkLoad(n int) bool {
+	return o.CopyThreshold > 0 && n >= o.CopyThreshold
+}
+
+// attemptCopy carga el lote con pq.CopyIn en una tabla temporal y lo mezcla
+// con rating_events en un único INSERT ... ON CONFLICT. Es mucho más rápido que los
+// upserts por lotes para cargas completas de miles de registros.
+func attemptCopy(ctx context.Context, runID string, batch []domain.Stock) (batchResult, error) {
+	var result batchResult
+	retries := 0
+
+	dialect, err := store.DetectDialect(ctx, db)
+	if err != nil {
+		return result, err
+	}
+
+	opts := store.TxOptions{
+		OnRetry: func(retry int, err error) {
+			retries = retry
+			recordDBRetry("copy", err)
+			logging.FromContext(ctx).Warn("Conflicto en la carga por COPY, se reintenta", "retry", retry,
+				"error_class", store.ClassifyError(err).String(), logging.Err(err))
+		},
+	}
+	// Las claves repetidas dentro del lote se cargan y se cuentan una sola
+	// vez; vale la última aparición
+	deduped := store.DedupeStocks(batch)
+	err = store.RunInTxWithOptions(ctx, db, opts, func(tx *sqlx.Tx) error {
+		result = batchResult{}
+
+		existing, err := store.ExistingStocks(ctx, tx, deduped)
+		if err != nil {
+			return fmt.Errorf("error consultando claves existentes: %w", err)
+		}
+		// Los registros que otra fuente con más prioridad ya escribió no se cargan
+		winners, skipped := store.FilterByPriority(deduped, existing)
+		result.Skipped = skipped
+		if len(winners) == 0 {
+			return nil
+		}
+
+		if err := createStagingTable(ctx, tx, dialect); err != nil {
+			return err
+		}
+		if err := copyToStaging(ctx, tx, winners); err != nil {
+			return err
+		}
+
+		changes := store.DetectChanges(runID, winners, existing)
+		result.Inserted, result.Updated = store.CountChanges(changes)
+		result.Copied = len(winners)
+
+		// Las empresas son pocas: se guardan con upserts antes de los eventos
+		if err := store.UpsertCompanies(ctx, tx, winners); err != nil {
+			return err
+		}
+
+		// El lote ya viene sin claves repetidas; DISTINCT ON es una red de
+		// seguridad para no actualizar dos veces la misma fila en un mismo INSERT
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO rating_events (
+				ticker, brokerage_id, time, brokerage, action,
+				rating_from, rating_to, target_from, target_to,
+				normalized_action, normalized_rating_from, normalized_rating_to,
+				source_id, source_priority, fetched_at, page_ref
+			)
+			SELECT DISTINCT ON (ticker, brokerage_id, time)
+				ticker, brokerage_id, time, brokerage, action,
+				rating_from, rating_to, target_from, target_to,
+				normalized_action, normalized_rating_from, normalized_rating_to,
+				source_id, source_priority, fetched_at, page_ref
+			FROM `+stagingTable+`
+			ORDER BY ticker, brokerage_id, time
+			ON CONFLICT (ticker, brokerage_id, time) DO UPDATE SET
+				brokerage = EXCLUDED.brokerage,
+				action = EXCLUDED.action,
+				rating_from = EXCLUDED.rating_from,
+				rating_to = EXCLUDED.rating_to,
+				target_from = EXCLUDED.target_from,
+				target_to = EXCLUDED.target_to,
+				normalized_action = EXCLUDED.normalized_action,
+				normalized_rating_from = EXCLUDED.normalized_rating_from,
+				normalized_rating_to = EXCLUDED.normalized_rating_to,
+				source_id = EXCLUDED.source_id,
+				source_priority = EXCLUDED.source_priority,
+				fetched_at = EXCLUDED.fetched_at,
+				page_ref = EXCLUDED.page_ref,
+				disappeared_at = NULL,
+				updated_at = now()
+			WHERE rating_events.source_id = EXCLUDED.source_id
+			   OR rating_events.source_priority <= EXCLUDED.source_priority`)
+		if err != nil {
+			return fmt.Errorf("error mezclando %s con rating_events: %w", stagingTable, err)
+		}
+		if err := store.InsertStockChanges(ctx, tx, changes); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `DROP TABLE `+stagingTable); err != nil {
+			return fmt.Errorf("error eliminando %s: %w", stagingTable, err)
+		}
+		return nil
+	})
+	result.Retries = retries
+	if err != nil {
+		return batchResult{Retries: retries}, err
+	}
+	return result, nil
+}
+
+// createStagingTable crea la tabla temporal de la transacción. CockroachDB
+// necesita habilitar las tablas temporales en la sesión.
+func createStagingTable(ctx context.Context, tx *sqlx.Tx, dialect store.Dialect) error {
+	if dialect == store.DialectCockroach {
+		if _, err := tx.ExecContext(ctx, `SET experimental_enable_temp_tables = 'on'`); err != nil {
+			return fmt.Errorf("error habilitando tablas temporales: %w", err)
+		}
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		CREATE TEMP TABLE IF NOT EXISTS `+stagingTable+` (
+			ticker TEXT NOT NULL,
+			brokerage_id UUID NOT NULL,
+			time TEXT NOT NULL,
+			brokerage TEXT NOT NULL,
+			action TEXT NOT NULL,
+			rating_from TEXT NOT NULL,
+			rating_to TEXT NOT NULL,
+			target_from NUMERIC(14, 2),
+			target_to NUMERIC(14, 2),
+			normalized_action TEXT NOT NULL,
+			normalized_rating_from TEXT NOT NULL,
+			normalized_rating_to TEXT NOT NULL,
+			source_id TEXT NOT NULL,
+			source_priority INT8 NOT NULL,
+			fetched_at TIMESTAMPTZ,
+			page_ref TEXT NOT NULL
+		)`)
+	if err != nil {
+		return fmt.Errorf("error creando %s: %w", stagingTable, err)
+	}
+	// Puede quedar de un intento anterior en la misma conexión
+	if _, err := tx.ExecContext(ctx, `DELETE FROM `+stagingTable); err != nil {
+		return fmt.Errorf("error vaciando %s: %w", stagingTable, err)
+	}
+	return nil
+}
+
+// copyToStaging envía el lote a la tabla temporal con el protocolo COPY
+func copyToStaging(ctx context.Context, tx *sqlx.Tx, batch []domain.Stock) error {
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(stagingTable, stagingColumns...))
+	if err != nil {
+		return fmt.Errorf("error iniciando COPY: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, stock := range batch {
+		_, err := stmt.ExecContext(ctx,
+			stock.Ticker, stock.BrokerageID, stock.Time, stock.Brokerage, stock.Action,
+			stock.RatingFrom, stock.RatingTo, stock.TargetFrom, stock.TargetTo,
+			stock.NormalizedAction, stock.NormalizedRatingFrom, stock.NormalizedRatingTo,
+			stock.SourceID, stock.SourcePriority, stock.FetchedAt, stock.PageRef)
+		if err != nil {
+			return fmt.Errorf("error enviando registros por COPY: %w", err)
+		}
+	}
+	// Exec sin argumentos termina el COPY y devuelve los errores del servidor
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return fmt.Errorf("error terminando COPY: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// command es un subcomando de save
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(ctx context.Context, args []string) error
+	// metrics indica si al terminar se exportan las métricas (ver exportMetrics)
+	metrics bool
+}
+
+// legacyCommand es el nombre con el que se registra una ejecución sin
+// subcomando (`save [flags]`), que conserva el comportamiento anterior a los
+// subcomandos: lectura completa salvo con -resume
+const legacyCommand = "save"
+
+// commands devuelve los subcomandos en el orden en que se muestran en la ayuda
+func commands() []command {
+	return []command{
+		{name: "sync", usage: "sync [flags]", metrics: true,
+			summary: "sincronización incremental: continúa desde el checkpoint de cada fuente si la última quedó a medias",
+			run:     func(ctx context.Context, args []string) error { return runSync(ctx, "sync", args) }},
+		{name: "full", usage: "full [flags]", metrics: true,
+			summary: "relee cada fuente desde la primera página y marca como desaparecido lo que ya no está",
+			run:     func(ctx context.Context, args []string) error { return runSync(ctx, "full", args) }},
+		{name: "verify", usage: "verify [-output f] [-max-records n]",
+			summary: "concilia la fuente con la base de datos; sale con 3 si encuentra diferencias",
+			run:     runVerify},
+		{name: "reset", usage: "reset [-data -yes] [-all | fuente...]",
+			summary: "borra los checkpoints (y con -data los eventos) de las fuentes",
+			run:     runReset},
+		{name: "import", usage: "import [-format f] [-map campo=columna,...] archivo...", metrics: true,
+			summary: "importa archivos CSV, JSON o JSON Lines",
+			run:     runImport},
+		{name: "status", usage: "status",
+			summary: "muestra migraciones pendientes, checkpoints y la última ejecución de cada fuente",
+			run:     runStatus},
+		{name: "requeue", usage: "requeue [-file f] [-limit n]", metrics: true,
+			summary: "reprocesa los dead letters",
+			run:     runRequeue},
+		{name: "backfill", usage: "backfill",
+			summary: "copia a rating_events los registros de stocks que falten; se puede repetir",
+			run:     runBackfill},
+		{name: "migrate", usage: "migrate up|down [n]|status",
+			summary: "aplica, revierte o lista las migraciones",
+			run:     runMigrate},
+	}
+}
+
+// parseCommand elige el subcomando de args. Sin subcomando, o si args empieza
+// con un flag, es una sincronización como antes de los subcomandos.
+func parseCommand(args []string) (command, []string, error) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		legacy := command{name: legacyCommand, metrics: true, run: func(ctx context.Context, args []string) error {
+			return runSync(ctx, legacyCommand, args)
+		}}
+		return legacy, args, nil
+	}
+	for _, cmd := range commands() {
+		if cmd.name == args[0] {
+			return cmd, args[1:], nil
+		}
+	}
+	if args[0] == "help" {
+		return command{}, nil, flag.ErrHelp
+	}
+	return command{}, nil, fmt.Errorf("subcomando desconocido: %s", args[0])
+}
+
+// printUsage muestra los subcomandos
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "uso: save <subcomando> [flags]")
+	fmt.Fprintln(w)
+	for _, cmd := range commands() {
+		fmt.Fprintf(w, "  %-55s %s\n", cmd.usage, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "`save <subcomando> -h` muestra los flags de cada uno.")
+}
+
+// dbOptions configura la conexión de connectDB
+type dbOptions struct {
+	// URL es la cadena de conexión; vacía usa defaultDBURL
+	URL string
+	// ConnectAttempts son los intentos de conexión antes de abandonar
+	ConnectAttempts int
+}
+
+// defaultDBURL es la base de datos local de desarrollo
+const defaultDBURL = "postgresql://root@localhost:26257/defaultdb?sslmode=disable"
+
+// dbConfig se lee de DB_URL y DB_CONNECT_ATTEMPTS al iniciar; los
+// subcomandos que usan la base de datos aceptan -db-url y -db-connect-attempts
+var dbConfig = dbOptions{ConnectAttempts: 5}
+
+// dbOptionsFromEnv lee la configuración de la base de datos del entorno
+func dbOptionsFromEnv() dbOptions {
+	return dbOptions{
+		URL:             os.Getenv("DB_URL"),
+		ConnectAttempts: envInt("DB_CONNECT_ATTEMPTS", dbConfig.ConnectAttempts),
+	}
+}
+
+// validate verifica que las opciones sean utilizables
+func (o dbOptions) validate() error {
+	if o.ConnectAttempts < 1 {
+		return fmt.Errorf("db-connect-attempts debe ser al menos 1 (recibido %d)", o.ConnectAttempts)
+	}
+	return nil
+}
+
+// registerDBFlags agrega los flags de la conexión a la base de datos
+func registerDBFlags(fs *flag.FlagSet) {
+	fs.StringVar(&dbConfig.URL, "db-url", dbConfig.URL, "cadena de conexión a la base de datos (DB_URL)")
+	fs.IntVar(&dbConfig.ConnectAttempts, "db-connect-attempts", dbConfig.ConnectAttempts, "intentos de conexión a la base de datos (DB_CONNECT_ATTEMPTS)")
+}
+
+// registerWriterFlags agrega los flags del pool de escritores (writeOptions)
+func registerWriterFlags(fs *flag.FlagSet) {
+	fs.IntVar(&writeOptions.Concurrency, "concurrency", envInt("SAVE_CONCURRENCY", writeOptions.Concurrency), "lotes que se escriben en paralelo")
+	fs.IntVar(&writeOptions.BatchSize, "batch-size", envInt("SAVE_BATCH_SIZE", writeOptions.BatchSize), "registros por transacción")
+	fs.IntVar(&writeOptions.MaxAttempts, "batch-attempts", envInt("SAVE_BATCH_ATTEMPTS", writeOptions.MaxAttempts), "intentos de cada lote ante errores reintentables (conexión, timeouts, locks)")
+	fs.IntVar(&writeOptions.CopyThreshold, "copy-threshold", envInt("SAVE_COPY_THRESHOLD", writeOptions.CopyThreshold), "registros a partir de los cuales se carga por COPY (0 lo desactiva)")
+	fs.IntVar(&writeOptions.CopyBatchSize, "copy-batch-size", envInt("SAVE_COPY_BATCH_SIZE", writeOptions.CopyBatchSize), "registros por transacción con COPY")
+}
+
+// registerSourceFlags agrega los flags de la fuente de datos; devuelve el
+// flag -sources con el archivo de la lista de fuentes
+func registerSourceFlags(fs *flag.FlagSet, cfg *sourceConfig) *string {
+	fs.StringVar(&cfg.Kind, "source", envOrDefault("STOCK_SOURCE", "http"), "fuente de datos: http, file o fixture")
+	fs.StringVar(&cfg.URL, "source-url", envOrDefault("SOURCE_URL", defaultSourceURL), "URL base de la fuente http")
+	fs.StringVar(&cfg.AuthHeader, "source-auth-header", envOrDefault("SOURCE_AUTH_HEADER", "Authorization"), "header donde se envía DB_API_KEY")
+	fs.StringVar(&cfg.File, "source-file", os.Getenv("SOURCE_FILE"), "archivo para la fuente file")
+	fs.StringVar(&cfg.Format, "source-format", "", "formato del archivo: json, jsonl o csv (por defecto según extensión)")
+	fs.IntVar(&cfg.PageSize, "page-size", 100, "registros por página para las fuentes file y fixture")
+	fs.Float64Var(&cfg.RateLimit, "rate-limit", envFloat("SOURCE_RATE_LIMIT", 2), "requests por segundo a la fuente http (0 sin límite)")
+	fs.IntVar(&cfg.RateBurst, "rate-burst", envInt("SOURCE_RATE_BURST", 1), "requests seguidos permitidos antes de aplicar el límite")
+	return fs.String("sources", os.Getenv("SOURCES_FILE"), "archivo JSON con la lista de fuentes (id, kind, priority, ...); reemplaza a -source")
+}
+
+// registerMetricsFlags agrega los flags de exportación de métricas (metricsConfig)
+func registerMetricsFlags(fs *flag.FlagSet) {
+	fs.StringVar(&metricsConfig.Textfile, "metrics-textfile", metricsConfig.Textfile, "archivo .prom donde escribir las métricas al terminar (textfile collector de node-exporter)")
+	fs.StringVar(&metricsConfig.PushURL, "metrics-push-url", metricsConfig.PushURL, "URL del Pushgateway donde publicar las métricas al terminar")
+	fs.StringVar(&metricsConfig.Job, "metrics-job", metricsConfig.Job, "job con el que se publican las métricas en el Pushgateway")
+}
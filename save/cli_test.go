@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JuanVel1/stock-api/store"
+)
+
+// TestParseCommand verifica la elección del subcomando y la ejecución sin
+// subcomando de antes
+func TestParseCommand(t *testing.T) {
+	cmd, args, err := parseCommand([]string{"sync", "-batch-size", "50"})
+	require.NoError(t, err)
+	assert.Equal(t, "sync", cmd.name)
+	assert.True(t, cmd.metrics)
+	assert.Equal(t, []string{"-batch-size", "50"}, args)
+
+	cmd, args, err = parseCommand([]string{"-resume"})
+	require.NoError(t, err)
+	assert.Equal(t, legacyCommand, cmd.name)
+	assert.Equal(t, []string{"-resume"}, args)
+
+	cmd, _, err = parseCommand(nil)
+	require.NoError(t, err)
+	assert.Equal(t, legacyCommand, cmd.name)
+
+	_, _, err = parseCommand([]string{"help"})
+	assert.ErrorIs(t, err, flag.ErrHelp)
+
+	_, _, err = parseCommand([]string{"rebuild"})
+	assert.ErrorContains(t, err, "rebuild")
+}
+
+// TestWriterFlags verifica que los flags reemplacen los valores por defecto
+// y que se validen
+func TestWriterFlags(t *testing.T) {
+	saved := writeOptions
+	defer func() { writeOptions = saved }()
+
+	fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+	registerWriterFlags(fs)
+	require.NoError(t, fs.Parse([]string{"-batch-size", "50", "-batch-attempts", "2"}))
+	assert.Equal(t, 50, writeOptions.BatchSize)
+	assert.Equal(t, 2, writeOptions.MaxAttempts)
+	assert.NoError(t, writeOptions.validate())
+
+	writeOptions.MaxAttempts = 0
+	assert.ErrorContains(t, writeOptions.validate(), "batch-attempts")
+}
+
+// TestPrintStatus verifica que el estado junte checkpoints, ejecuciones y
+// eventos por fuente
+func TestPrintStatus(t *testing.T) {
+	updated := time.Date(2025, 1, 17, 10, 0, 0, 0, time.UTC)
+	states := []syncState{{Source: "swechallenge", NextPage: "AAPL", PagesCommitted: 3, UpdatedAt: updated}}
+	runs := []store.SyncRun{
+		{Source: "file:backfill.csv", Kind: "import", Status: store.RunSucceeded, StartedAt: updated, RowsInserted: 10},
+		{Source: "swechallenge", Kind: "sync", Status: store.RunInterrupted, StartedAt: updated, PagesFetched: 3, RowsInserted: 250},
+	}
+	counts := map[string]int{"swechallenge": 250, "file:backfill.csv": 10, "": 4}
+
+	statuses := mergeSourceStatuses(states, runs, counts)
+	require.Len(t, statuses, 3)
+	assert.Equal(t, "", statuses[0].Source)
+	assert.Equal(t, "swechallenge", statuses[2].Source)
+	assert.Equal(t, 250, statuses[2].Events)
+	require.NotNil(t, statuses[2].State)
+	require.NotNil(t, statuses[2].LastRun)
+
+	var out strings.Builder
+	printStatus(&out, 0, statuses)
+	assert.Contains(t, out.String(), "(sin fuente)")
+	assert.Contains(t, out.String(), `3 páginas, next_page "AAPL", incompleta`)
+	assert.Contains(t, out.String(), "sync interrupted")
+
+	out.Reset()
+	printStatus(&out, 2, nil)
+	assert.Contains(t, out.String(), "Migraciones pendientes: 2")
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/JuanVel1/stock-api/domain"
+	"github.com/JuanVel1/stock-api/logging"
+	"github.com/JuanVel1/stock-api/store"
+)
+
+// deadLetterRecord es un stock que no se pudo guardar junto con su error
+type deadLetterRecord struct {
+	ID        string       `json:"-"`
+	RunID     string       `json:"run_id,omitempty"`
+	Stock     domain.Stock `json:"payload"`
+	Error     string       `json:"error"`
+	Attempts  int          `json:"attempts"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// deadLetterFile es el archivo NDJSON usado cuando la base de datos no responde
+func deadLetterFile() string {
+	return envOrDefault("DEAD_LETTER_FILE", "dead_letters.ndjson")
+}
+
+// deadLetterBatch guarda los registros de un lote fallido en la tabla
+// dead_letters o, si la base de datos no está disponible, en el archivo local
+func deadLetterBatch(runID string, batch []domain.Stock, batchErr error, attempts int) {
+	if len(batch) == 0 {
+		return
+	}
+
+	now := time.Now().UTC()
+	records := make([]deadLetterRecord, len(batch))
+	for i, stock := range batch {
+		records[i] = deadLetterRecord{
+			RunID:     runID,
+			Stock:     stock,
+			Error:     batchErr.Error(),
+			Attempts:  attempts,
+			CreatedAt: now,
+		}
+	}
+
+	logger := slog.With("run_id", runID)
+	err := insertDeadLetters(records)
+	if err == nil {
+		deadLettersTotal.Add(float64(len(records)), "table")
+		logger.Warn("Registros enviados a dead_letters", "count", len(records))
+		return
+	}
+	logger.Warn("No se pudo escribir en dead_letters, se usa el archivo", "file", deadLetterFile(), logging.Err(err))
+
+	if err := appendDeadLetterFile(deadLetterFile(), records); err != nil {
+		deadLettersTotal.Add(float64(len(records)), "lost")
+		logger.Error("Error escribiendo dead letters en el archivo", "file", deadLetterFile(), logging.Err(err))
+		return
+	}
+	deadLettersTotal.Add(float64(len(records)), "file")
+	logger.Warn("Registros enviados al archivo de dead letters", "count", len(records), "file", deadLetterFile())
+}
+
+func insertDeadLetters(records []deadLetterRecord) error {
+	if db == nil {
+		return fmt.Errorf("sin conexión a la base de datos")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return store.RunInTx(ctx, db, func(tx *sqlx.Tx) error {
+		for _, record := range records {
+			payload, err := json.Marshal(record.Stock)
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO dead_letters (run_id, ticker, time, payload, error, attempts, created_at)
+				VALUES (NULLIF($1, '')::UUID, $2, $3, $4, $5, $6, $7)`,
+				record.RunID, record.Stock.Ticker, record.Stock.Time, string(payload),
+				record.Error, record.Attempts, record.CreatedAt)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func appendDeadLetterFile(path string, records []deadLetterRecord) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	return file.Sync()
+}
+
+func readDeadLetterFile(path string) ([]deadLetterRecord, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []deadLetterRecord
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record deadLetterRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("%s línea %d: %v", path, line, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// writeDeadLetterFile reemplaza el archivo con los registros que siguen pendientes
+func writeDeadLetterFile(path string, records []deadLetterRecord) error {
+	if len(records) == 0 {
+		err := os.Remove(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	encoder := json.NewEncoder(tmp)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// loadPendingDeadLetters lee de la tabla los registros que no se han reprocesado
+func loadPendingDeadLetters(limit int) ([]deadLetterRecord, error) {
+	rows, err := db.Queryx(`
+		SELECT id, COALESCE(run_id::TEXT, ''), payload, error, attempts, created_at
+		FROM dead_letters
+		WHERE requeued_at IS NULL
+		ORDER BY created_at
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo dead_letters: %v", err)
+	}
+	defer rows.Close()
+
+	var records []deadLetterRecord
+	for rows.Next() {
+		var record deadLetterRecord
+		var payload []byte
+		if err := rows.Scan(&record.ID, &record.RunID, &payload, &record.Error,
+			&record.Attempts, &record.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(payload, &record.Stock); err != nil {
+			return nil, fmt.Errorf("payload inválido en dead letter %s: %v", record.ID, err)
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// runRequeue implementa el subcomando `requeue`: reprocesa los dead letters de
+// la tabla y del archivo local con el mismo camino de upsert que la
+// sincronización. Si ctx se cancela termina el lote en curso y deja los
+// demás pendientes.
+func runRequeue(ctx context.Context, args []string) (err error) {
+	fs := flag.NewFlagSet("requeue", flag.ContinueOnError)
+	file := fs.String("file", deadLetterFile(), "archivo NDJSON de dead letters")
+	limit := fs.Int("limit", 1000, "máximo de registros a reprocesar desde la tabla")
+	fs.IntVar(&writeOptions.BatchSize, "batch-size", envInt("SAVE_BATCH_SIZE", writeOptions.BatchSize), "registros por transacción")
+	fs.IntVar(&writeOptions.MaxAttempts, "batch-attempts", envInt("SAVE_BATCH_ATTEMPTS", writeOptions.MaxAttempts), "intentos de cada lote ante errores reintentables (conexión, timeouts, locks)")
+	registerDBFlags(fs)
+	registerMetricsFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := writeOptions.validate(); err != nil {
+		return err
+	}
+	if err := dbConfig.validate(); err != nil {
+		return err
+	}
+
+	if err := initDB(ctx); err != nil {
+		return fmt.Errorf("error inicializando DB: %v", err)
+	}
+	defer db.Close()
+
+	run, err := startSyncRun("requeue", "dead_letters")
+	if err != nil {
+		return err
+	}
+	defer func() { finishSyncRun(run, err) }()
+
+	pending, err := loadPendingDeadLetters(*limit)
+	if err != nil {
+		return err
+	}
+	slog.Info("Dead letters pendientes en la tabla", "run_id", run.ID, "count", len(pending))
+
+	interrupted := requeueInBatches(ctx, run, pending, func(batch []deadLetterRecord, batchErr error) error {
+		ids := make([]string, len(batch))
+		for i, record := range batch {
+			ids[i] = record.ID
+		}
+		return store.RunInTx(context.Background(), db, func(tx *sqlx.Tx) error {
+			if batchErr == nil {
+				_, err := tx.Exec(`UPDATE dead_letters SET requeued_at = now() WHERE id = ANY($1)`, pq.Array(ids))
+				return err
+			}
+			_, err := tx.Exec(`UPDATE dead_letters SET attempts = attempts + 1, error = $2 WHERE id = ANY($1)`,
+				pq.Array(ids), batchErr.Error())
+			return err
+		})
+	})
+
+	if interrupted != nil {
+		return interrupted
+	}
+
+	fileRecords, err := readDeadLetterFile(*file)
+	if err != nil {
+		return err
+	}
+	if len(fileRecords) > 0 {
+		slog.Info("Dead letters pendientes en el archivo", "run_id", run.ID, "count", len(fileRecords), "file", *file)
+
+		var remaining []deadLetterRecord
+		processed := 0
+		interrupted = requeueInBatches(ctx, run, fileRecords, func(batch []deadLetterRecord, batchErr error) error {
+			processed += len(batch)
+			if batchErr != nil {
+				for _, record := range batch {
+					record.Attempts++
+					record.Error = batchErr.Error()
+					remaining = append(remaining, record)
+				}
+			}
+			return nil
+		})
+		// Los registros que no llegaron a procesarse quedan en el archivo
+		remaining = append(remaining, fileRecords[processed:]...)
+		if err := writeDeadLetterFile(*file, remaining); err != nil {
+			return fmt.Errorf("error actualizando %s: %v", *file, err)
+		}
+		if interrupted != nil {
+			return interrupted
+		}
+	}
+
+	if run.RowsFailed > 0 {
+		return fmt.Errorf("%d registros siguen fallando", run.RowsFailed)
+	}
+	return nil
+}
+
+// requeueInBatches pasa los registros por processBatch en lotes e informa el
+// resultado de cada lote a done. Si ctx se cancela no empieza más lotes y
+// devuelve el error de la interrupción.
+func requeueInBatches(ctx context.Context, run *store.SyncRun, records []deadLetterRecord, done func([]deadLetterRecord, error) error) error {
+	batchSize := writeOptions.BatchSize
+	logger := slog.With("run_id", run.ID)
+	for i := 0; i < len(records); i += batchSize {
+		if ctx.Err() != nil {
+			logger.Warn("Reproceso interrumpido", "processed", i, "pending", len(records)-i)
+			return interruption(ctx)
+		}
+		batch := records[i:min(i+batchSize, len(records))]
+
+		stocks := make([]domain.Stock, len(batch))
+		for j, record := range batch {
+			// Los registros guardados antes del vocabulario no traen los valores canónicos
+			stocks[j] = record.Stock
+			vocabulary.Normalize(&stocks[j])
+		}
+		// Y los anteriores al modelo normalizado, el bróker canónico
+		resolveBrokerages(stocks)
+
+		// El intento en curso se termina aunque ctx se cancele mientras se
+		// guarda; la cancelación solo corta la espera entre reintentos
+		batchCtx := logging.NewContext(ctx, logger.With("batch", i/batchSize+1))
+		result, err := processBatch(batchCtx, run.ID, stocks)
+		run.Retries += result.Retries
+		if err != nil {
+			run.RowsFailed += len(batch)
+			run.RecordError(err)
+		} else {
+			run.RowsInserted += result.Inserted
+			run.RowsUpdated += result.Updated
+		}
+
+		if markErr := done(batch, err); markErr != nil {
+			logger.Warn("Error actualizando dead letters", logging.Err(markErr))
+		}
+	}
+	return nil
+}
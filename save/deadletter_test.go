@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDeadLetterFileRoundTrip verifica el respaldo NDJSON de dead letters
+func TestDeadLetterFileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead_letters.ndjson")
+	t.Setenv("DEAD_LETTER_FILE", path)
+
+	stocks, rejected := validateStocks(slog.Default(), nil, fixtureStocks)
+	require.Empty(t, rejected)
+
+	// Sin conexión a la base de datos los registros van al archivo
+	db = nil
+	deadLetterBatch("run-1", stocks[:2], errors.New("deadlock"), 5)
+	deadLetterBatch("run-2", stocks[2:3], errors.New("timeout"), 1)
+
+	records, err := readDeadLetterFile(path)
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, "run-1", records[0].RunID)
+	assert.Equal(t, "AAPL", records[0].Stock.Ticker)
+	assert.Equal(t, "deadlock", records[0].Error)
+	assert.Equal(t, 5, records[0].Attempts)
+	assert.Equal(t, "NVDA", records[2].Stock.Ticker)
+	assert.Equal(t, stocks[0].TargetTo, records[0].Stock.TargetTo)
+
+	require.NoError(t, writeDeadLetterFile(path, records[2:]))
+	records, err = readDeadLetterFile(path)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+
+	require.NoError(t, writeDeadLetterFile(path, nil))
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
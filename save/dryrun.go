@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/JuanVel1/stock-api/domain"
+	"github.com/JuanVel1/stock-api/migrations"
+	"github.com/JuanVel1/stock-api/store"
+)
+
+// dryRunSummary es el resultado de un dry-run: lo que haría una
+// sincronización con la fuente y el contenido actual de la base de datos
+type dryRunSummary struct {
+	Source      string               `json:"source"`
+	StartedAt   time.Time            `json:"started_at"`
+	FullSync    bool                 `json:"full_sync"`
+	Pages       int                  `json:"pages"`
+	Checked     int                  `json:"checked"`
+	Inserts     int                  `json:"inserts"`
+	Updates     int                  `json:"updates"`
+	Unchanged   int                  `json:"unchanged"`
+	Skipped     int                  `json:"skipped"`
+	Rejected    int                  `json:"rejected"`
+	Flagged     int                  `json:"flagged"`
+	Disappeared int                  `json:"disappeared"`
+	Quality     []store.QualityIssue `json:"quality"`
+	Rejects     []dryRunReject       `json:"rejects"`
+	Changes     []dryRunChange       `json:"changes"`
+}
+
+// dryRunReject es un registro que la validación descartaría
+type dryRunReject struct {
+	Ticker    string   `json:"ticker"`
+	Brokerage string   `json:"brokerage"`
+	Time      string   `json:"time"`
+	Issues    []string `json:"issues"`
+}
+
+// newDryRunReject arma el reporte de un registro descartado por validateStocks
+func newDryRunReject(r rejectedStock) dryRunReject {
+	reject := dryRunReject{Ticker: r.Raw.Ticker, Brokerage: r.Raw.Brokerage, Time: r.Raw.Time}
+	for _, issue := range r.Issues {
+		reject.Issues = append(reject.Issues, issue.String())
+	}
+	return reject
+}
+
+// dryRunChange es un cambio que se registraría en stock_changes
+type dryRunChange struct {
+	Ticker      string           `json:"ticker"`
+	BrokerageID *string          `json:"brokerage_id"`
+	Time        string           `json:"time"`
+	ChangeType  string           `json:"change_type"`
+	Diff        store.FieldDiffs `json:"diff,omitempty"`
+}
+
+// runDryRun lee cada fuente como syncStocks, valida y compara cada página con
+// la base de datos, y escribe el resumen JSON en output (o la salida
+// estándar): un objeto con una sola fuente y una lista con varias. No aplica
+// migraciones ni escribe en ninguna tabla. Si ctx se cancela no se escribe el
+// resumen.
+func runDryRun(ctx context.Context, sources []configuredSource, resume bool, output string) error {
+	if err := connectDB(ctx); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := checkPendingMigrations(); err != nil {
+		return err
+	}
+	loadReferenceData()
+
+	summaries := make([]*dryRunSummary, 0, len(sources))
+	for _, source := range sources {
+		startPage := ""
+		if resume {
+			state, err := loadSyncState(source.Name())
+			if err != nil {
+				return err
+			}
+			if state != nil && !state.Completed {
+				startPage = state.NextPage
+			}
+		}
+
+		summary, err := dryRunSync(ctx, source, startPage)
+		if err != nil {
+			return fmt.Errorf("fuente %s: %w", source.Name(), err)
+		}
+		summaries = append(summaries, summary)
+	}
+	return writeDryRunSummary(summaries, output)
+}
+
+// checkPendingMigrations falla si el esquema no está al día: el dry-run no
+// aplica migraciones y las consultas esperan el esquema actual
+func checkPendingMigrations() error {
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+	statuses, err := migrator.Status(context.Background())
+	if err != nil {
+		return err
+	}
+
+	pending := 0
+	for _, status := range statuses {
+		if !status.Applied {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return fmt.Errorf("hay %d migraciones pendientes; ejecute `save migrate up` antes del dry-run", pending)
+	}
+	return nil
+}
+
+// dryRunSync pide las páginas desde startPage y acumula lo que haría la
+// sincronización. Las páginas se comparan contra la base de datos más lo que
+// habrían escrito las páginas anteriores; lo que escribirían otras fuentes en
+// la misma sincronización no se tiene en cuenta.
+func dryRunSync(ctx context.Context, source configuredSource, startPage string) (*dryRunSummary, error) {
+	summary := &dryRunSummary{
+		Source:    source.Name(),
+		StartedAt: time.Now().UTC(),
+		FullSync:  startPage == "",
+		Rejects:   []dryRunReject{},
+		Changes:   []dryRunChange{},
+	}
+	logger := slog.With("source", source.Name())
+	report := store.NewQualityReport("", source.Name())
+	written := make(map[store.StockKey]domain.Stock)
+	seen := make(map[store.StockKey]bool)
+
+	cursor := startPage
+	err := fetchAllStocks(ctx, source, startPage, func(page []domain.RawStock, nextPage string) error {
+		summary.Pages++
+		provenance := source.Provenance(cursor)
+		cursor = nextPage
+
+		stocks, rejected := validateStocks(logger.With("page", summary.Pages), report, page)
+		for _, r := range rejected {
+			summary.Rejects = append(summary.Rejects, newDryRunReject(r))
+		}
+		setProvenance(stocks, provenance)
+		// Sin registrar brókers: los desconocidos quedan sin id y cuentan como nuevos
+		brokerages.AssignIDs(stocks)
+		markSeen(seen, page)
+
+		existing, err := previewExisting(stocks, written)
+		if err != nil {
+			return err
+		}
+		stocks, skipped := store.FilterByPriority(stocks, existing)
+		summary.Skipped += skipped
+
+		changes := store.DetectChanges("", stocks, existing)
+		keys := make(map[store.StockKey]bool, len(stocks))
+		for _, stock := range stocks {
+			key := store.KeyOf(stock)
+			keys[key] = true
+			written[key] = stock
+		}
+		summary.Unchanged += len(keys) - len(changes)
+		for _, change := range changes {
+			switch change.ChangeType {
+			case store.ChangeInserted:
+				summary.Inserts++
+			case store.ChangeUpdated:
+				summary.Updates++
+			}
+			summary.Changes = append(summary.Changes, dryRunChange{
+				Ticker: change.Ticker, BrokerageID: change.BrokerageID, Time: change.Time,
+				ChangeType: change.ChangeType, Diff: change.Diff,
+			})
+		}
+		slog.Info("Dry-run: página revisada", "source", source.Name(), "page", summary.Pages, "next_page", nextPage)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if summary.FullSync && len(seen) > 0 {
+		disappeared, err := store.FindDisappeared(context.Background(), db, "", source.Name(), seen)
+		if err != nil {
+			return nil, err
+		}
+		summary.Disappeared = len(disappeared)
+		for _, change := range disappeared {
+			summary.Changes = append(summary.Changes, dryRunChange{
+				Ticker: change.Ticker, BrokerageID: change.BrokerageID, Time: change.Time,
+				ChangeType: change.ChangeType,
+			})
+		}
+	}
+
+	summary.Checked = report.Checked
+	summary.Rejected = report.Rejected
+	summary.Flagged = report.Flagged
+	summary.Quality = report.Issues
+	if summary.Quality == nil {
+		summary.Quality = []store.QualityIssue{}
+	}
+	return summary, nil
+}
+
+// previewExisting lee las filas actuales del lote en una transacción de solo
+// lectura y les superpone lo que habrían escrito las páginas anteriores
+func previewExisting(stocks []domain.Stock, written map[store.StockKey]domain.Stock) (map[store.StockKey]domain.Stock, error) {
+	ctx := context.Background()
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	existing, err := store.ExistingStocks(ctx, tx, stocks)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando claves existentes: %w", err)
+	}
+	for _, stock := range stocks {
+		key := store.KeyOf(stock)
+		if previous, ok := written[key]; ok {
+			existing[key] = previous
+		}
+	}
+	return existing, nil
+}
+
+// writeDryRunSummary escribe los resúmenes en JSON en output o en la salida
+// estándar; con una sola fuente se escribe el objeto sin la lista
+func writeDryRunSummary(summaries []*dryRunSummary, output string) error {
+	var document any = summaries
+	if len(summaries) == 1 {
+		document = summaries[0]
+	}
+	data, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	for _, s := range summaries {
+		slog.Info("Dry-run terminado", "source", s.Source, "checked", s.Checked, "inserts", s.Inserts,
+			"updates", s.Updates, "unchanged", s.Unchanged, "skipped", s.Skipped, "rejected", s.Rejected,
+			"disappeared", s.Disappeared)
+	}
+	if output == "" {
+		fmt.Println(string(data))
+		return nil
+	}
+	if err := os.WriteFile(output, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("error escribiendo %s: %w", output, err)
+	}
+	slog.Info("Resumen del dry-run escrito", "file", output)
+	return nil
+}
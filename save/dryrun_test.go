@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JuanVel1/stock-api/store"
+)
+
+// TestWriteDryRunSummary verifica el archivo JSON del dry-run
+func TestWriteDryRunSummary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dry-run.json")
+	summary := &dryRunSummary{
+		Source:  "fixture",
+		Checked: 3,
+		Inserts: 1,
+		Updates: 1,
+		Rejects: []dryRunReject{{Ticker: "", Time: "t1", Issues: []string{`missing_ticker ticker=""`}}},
+		Changes: []dryRunChange{{Ticker: "AAPL", Time: "t1", ChangeType: store.ChangeInserted}},
+	}
+	require.NoError(t, writeDryRunSummary([]*dryRunSummary{summary}, path))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, "fixture", decoded["source"])
+	assert.EqualValues(t, 1, decoded["inserts"])
+	assert.Len(t, decoded["changes"], 1)
+	assert.Len(t, decoded["rejects"], 1)
+}
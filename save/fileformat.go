@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/JuanVel1/stock-api/domain"
+)
+
+// stockFields son los nombres de campo de domain.RawStock, iguales a los del JSON de la API
+var stockFields = []string{
+	"ticker", "company", "brokerage", "action",
+	"rating_from", "rating_to", "target_from", "target_to", "time",
+}
+
+// rawRecord es una fila leída de un archivo, con sus columnas como texto
+type rawRecord struct {
+	Line   int
+	Fields map[string]string
+}
+
+// columnMapping indica de qué columna del archivo sale cada campo del stock
+type columnMapping map[string]string
+
+// parseColumnMapping interpreta "campo=columna,campo=columna"; los campos no
+// mencionados se leen de la columna con su mismo nombre
+func parseColumnMapping(spec string) (columnMapping, error) {
+	mapping := make(columnMapping, len(stockFields))
+	for _, field := range stockFields {
+		mapping[field] = field
+	}
+
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return mapping, nil
+	}
+
+	for _, pair := range strings.Split(spec, ",") {
+		field, column, found := strings.Cut(pair, "=")
+		field = strings.ToLower(strings.TrimSpace(field))
+		column = strings.ToLower(strings.TrimSpace(column))
+		if !found || column == "" {
+			return nil, fmt.Errorf("mapeo de columnas inválido: %q (use campo=columna)", pair)
+		}
+		if _, ok := mapping[field]; !ok {
+			return nil, fmt.Errorf("campo desconocido en el mapeo: %s (campos válidos: %s)",
+				field, strings.Join(stockFields, ", "))
+		}
+		mapping[field] = column
+	}
+	return mapping, nil
+}
+
+// toRawStock construye un stock con las columnas indicadas por el mapeo
+func (m columnMapping) toRawStock(record rawRecord) domain.RawStock {
+	get := func(field string) string {
+		return strings.TrimSpace(record.Fields[m[field]])
+	}
+	return domain.RawStock{
+		Ticker:     get("ticker"),
+		Company:    get("company"),
+		Brokerage:  get("brokerage"),
+		Action:     get("action"),
+		RatingFrom: get("rating_from"),
+		RatingTo:   get("rating_to"),
+		TargetFrom: get("target_from"),
+		TargetTo:   get("target_to"),
+		Time:       get("time"),
+	}
+}
+
+// detectFormat deduce el formato (json, jsonl o csv) a partir de la extensión
+func detectFormat(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return "json", nil
+	case ".jsonl", ".ndjson":
+		return "jsonl", nil
+	case ".csv":
+		return "csv", nil
+	}
+	return "", fmt.Errorf("no se puede deducir el formato de %s (use json, jsonl o csv)", path)
+}
+
+// readStocksFile lee todos los stocks de un archivo local con el mapeo por defecto
+func readStocksFile(path, format string) ([]domain.RawStock, error) {
+	records, err := readRawRecords(path, format)
+	if err != nil {
+		return nil, err
+	}
+
+	mapping, _ := parseColumnMapping("")
+	stocks := make([]domain.RawStock, 0, len(records))
+	for _, record := range records {
+		stocks = append(stocks, mapping.toRawStock(record))
+	}
+	return stocks, nil
+}
+
+// readRawRecords lee las filas de un archivo JSON, JSONL o CSV sin interpretarlas
+func readRawRecords(path, format string) ([]rawRecord, error) {
+	if format == "" {
+		var err error
+		if format, err = detectFormat(path); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error abriendo %s: %v", path, err)
+	}
+	defer file.Close()
+
+	switch format {
+	case "json":
+		return decodeJSONRecords(file)
+	case "jsonl", "ndjson":
+		return decodeJSONLRecords(file)
+	case "csv":
+		return decodeCSVRecords(file)
+	}
+	return nil, fmt.Errorf("formato de archivo desconocido: %s", format)
+}
+
+// decodeJSONRecords acepta un arreglo de objetos o un objeto con la forma de domain.APIResponse
+func decodeJSONRecords(r io.Reader) ([]rawRecord, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo JSON: %v", err)
+	}
+
+	var items []map[string]any
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil, fmt.Errorf("error unmarshaling JSON: %v", err)
+		}
+	} else {
+		var response struct {
+			Items []map[string]any `json:"items"`
+		}
+		if err := json.Unmarshal(data, &response); err != nil {
+			return nil, fmt.Errorf("error unmarshaling JSON: %v", err)
+		}
+		items = response.Items
+	}
+
+	records := make([]rawRecord, 0, len(items))
+	for i, item := range items {
+		records = append(records, rawRecord{Line: i + 1, Fields: stringFields(item)})
+	}
+	return records, nil
+}
+
+// decodeJSONLRecords lee un objeto por línea, ignorando líneas vacías
+func decodeJSONLRecords(r io.Reader) ([]rawRecord, error) {
+	var records []rawRecord
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var item map[string]any
+		if err := json.Unmarshal([]byte(text), &item); err != nil {
+			return nil, fmt.Errorf("línea %d: error unmarshaling JSON: %v", line, err)
+		}
+		records = append(records, rawRecord{Line: line, Fields: stringFields(item)})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error leyendo JSONL: %v", err)
+	}
+	return records, nil
+}
+
+// decodeCSVRecords lee un CSV con encabezado; las columnas se indexan en minúsculas
+func decodeCSVRecords(r io.Reader) ([]rawRecord, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo encabezado CSV: %v", err)
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+
+	var records []rawRecord
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error leyendo CSV: %v", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		fields := make(map[string]string, len(header))
+		for i, name := range header {
+			if i < len(row) {
+				fields[name] = row[i]
+			}
+		}
+		records = append(records, rawRecord{Line: line, Fields: fields})
+	}
+	return records, nil
+}
+
+// stringFields convierte los valores de un objeto JSON a texto con claves en minúsculas
+func stringFields(item map[string]any) map[string]string {
+	fields := make(map[string]string, len(item))
+	for key, value := range item {
+		var text string
+		switch v := value.(type) {
+		case nil:
+			text = ""
+		case string:
+			text = v
+		case float64:
+			text = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			text = strconv.FormatBool(v)
+		default:
+			encoded, _ := json.Marshal(v)
+			text = string(encoded)
+		}
+		fields[strings.ToLower(key)] = text
+	}
+	return fields
+}
+
+// columnNames devuelve las columnas presentes en los registros, ordenadas
+func columnNames(records []rawRecord) []string {
+	seen := make(map[string]bool)
+	for _, record := range records {
+		for name := range record.Fields {
+			seen[name] = true
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/JuanVel1/stock-api/domain"
+	"github.com/JuanVel1/stock-api/store"
+)
+
+// importSummary es el resultado de importar un archivo
+type importSummary struct {
+	File     string
+	Read     int
+	Valid    int
+	Rejected int
+	Saved    int
+	Failed   int
+	Reasons  map[string]int
+	Samples  []string
+	Err      error
+	Duration time.Duration
+}
+
+// maxRejectSamples limita cuántas filas rechazadas se muestran por archivo
+const maxRejectSamples = 5
+
+// runImport implementa el subcomando `import [-format f] [-map campo=columna,...] archivos...`.
+// Si ctx se cancela no se empiezan más archivos.
+func runImport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := fs.String("format", "", "formato de los archivos: json, jsonl o csv (por defecto según extensión)")
+	priority := fs.Int("priority", 0, "prioridad de los registros importados frente a los de otras fuentes")
+	mapSpec := fs.String("map", "", "mapeo de columnas campo=columna separado por comas, ej. ticker=symbol,target_to=new_pt")
+	registerWriterFlags(fs)
+	registerDBFlags(fs)
+	registerMetricsFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := writeOptions.validate(); err != nil {
+		return err
+	}
+	if err := dbConfig.validate(); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("uso: save import [-format csv|jsonl|json] [-map campo=columna,...] archivo...")
+	}
+
+	mapping, err := parseColumnMapping(*mapSpec)
+	if err != nil {
+		return err
+	}
+
+	if err := initDB(ctx); err != nil {
+		return fmt.Errorf("error inicializando DB: %v", err)
+	}
+	defer db.Close()
+
+	var summaries []importSummary
+	var interrupted error
+	for i, path := range fs.Args() {
+		if ctx.Err() != nil {
+			interrupted = interruption(ctx)
+			slog.Warn("Importación interrumpida", "imported_files", i, "pending_files", fs.NArg()-i)
+			break
+		}
+		summaries = append(summaries, importFile(ctx, path, *format, mapping, *priority))
+	}
+
+	printImportSummaries(summaries)
+	if interrupted != nil {
+		return interrupted
+	}
+
+	for _, summary := range summaries {
+		if summary.Err != nil || summary.Failed > 0 {
+			return fmt.Errorf("la importación terminó con errores")
+		}
+	}
+	return nil
+}
+
+// importFile lee, valida y guarda los stocks de un archivo; el origen de cada
+// registro es el archivo con la línea y la prioridad indicada
+func importFile(ctx context.Context, path, format string, mapping columnMapping, priority int) (summary importSummary) {
+	start := time.Now()
+	summary = importSummary{File: path, Reasons: make(map[string]int)}
+	defer func() { summary.Duration = time.Since(start) }()
+
+	slog.Info("Importando archivo", "file", path)
+
+	records, err := readRawRecords(path, format)
+	if err != nil {
+		summary.Err = err
+		return summary
+	}
+	summary.Read = len(records)
+
+	if len(records) > 0 {
+		columns := make(map[string]bool)
+		for _, name := range columnNames(records) {
+			columns[name] = true
+		}
+		for _, field := range []string{"ticker", "time"} {
+			if !columns[mapping[field]] {
+				summary.Err = fmt.Errorf("el archivo no tiene la columna %q requerida para %s", mapping[field], field)
+				return summary
+			}
+		}
+	}
+
+	run, err := startSyncRun("import", "file:"+filepath.Base(path))
+	if err != nil {
+		summary.Err = err
+		return summary
+	}
+	report := store.NewQualityReport(run.ID, run.Source)
+
+	fetchedAt := time.Now().UTC()
+	var valid []domain.Stock
+	for _, record := range records {
+		raw := mapping.toRawStock(record)
+		stock, issues, err := normalizeImportedStock(raw)
+		report.Record(raw, issues)
+		if err != nil {
+			summary.Rejected++
+			summary.Reasons[rejectReason(err)]++
+			if len(summary.Samples) < maxRejectSamples {
+				summary.Samples = append(summary.Samples, fmt.Sprintf("línea %d: %v", record.Line, err))
+			}
+			continue
+		}
+		stock.Provenance = domain.Provenance{
+			SourceID:       run.Source,
+			SourcePriority: priority,
+			FetchedAt:      &fetchedAt,
+			PageRef:        fmt.Sprintf("%s:%d", path, record.Line),
+		}
+		valid = append(valid, stock)
+	}
+	summary.Valid = len(valid)
+	saveQualityReport(report)
+	resolveBrokerages(valid)
+
+	result, err := saveStocks(ctx, run.ID, valid)
+	recordSave(run, result)
+	run.RowsFailed += summary.Rejected
+	finishSyncRun(run, err)
+
+	summary.Saved = result.Saved
+	summary.Failed = result.Failed
+	if err != nil && result.Failed == 0 {
+		summary.Err = err
+	}
+	return summary
+}
+
+// importError es un rechazo de fila con una razón agrupable
+type importError struct {
+	reason string
+	detail string
+}
+
+func (e *importError) Error() string {
+	return e.reason + ": " + e.detail
+}
+
+func rejectReason(err error) string {
+	if ie, ok := err.(*importError); ok {
+		return ie.reason
+	}
+	return "error"
+}
+
+// importReasons agrupa los rechazos de la validación en el resumen de importación
+var importReasons = map[string]string{
+	domain.RuleMissingTicker:  "ticker vacío",
+	domain.RuleInvalidTime:    "hora inválida",
+	domain.RuleInvalidTarget:  "precio inválido",
+	domain.RuleNegativeTarget: "precio negativo",
+}
+
+// normalizeImportedStock normaliza una fila importada (ticker en mayúsculas,
+// hora RFC3339 en UTC como la API) y la valida con el vocabulario. Devuelve
+// los problemas encontrados para el reporte de calidad y un importError si la
+// fila se descarta.
+func normalizeImportedStock(raw domain.RawStock) (domain.Stock, []domain.Issue, error) {
+	raw.Ticker = strings.ToUpper(strings.TrimSpace(raw.Ticker))
+	if parsed, err := time.Parse(time.RFC3339, raw.Time); err == nil {
+		raw.Time = parsed.UTC().Format(time.RFC3339Nano)
+	}
+
+	stock, issues := vocabulary.Validate(raw)
+	for _, issue := range issues {
+		if issue.Severity != domain.SeverityReject {
+			continue
+		}
+		reason := importReasons[issue.Rule]
+		if issue.Rule == domain.RuleInvalidTime && issue.Value == "" {
+			reason = "hora vacía"
+		}
+		return domain.Stock{}, issues, &importError{reason, fmt.Sprintf("%s=%q", issue.Field, issue.Value)}
+	}
+	return stock, issues, nil
+}
+
+// printImportSummaries muestra el reporte por archivo
+func printImportSummaries(summaries []importSummary) {
+	fmt.Println("\nResumen de importación:")
+	for _, s := range summaries {
+		status := "OK"
+		if s.Err != nil || s.Failed > 0 {
+			status = "CON ERRORES"
+		}
+		fmt.Printf("- %s [%s] leídos=%d válidos=%d rechazados=%d guardados=%d fallidos=%d (%v)\n",
+			s.File, status, s.Read, s.Valid, s.Rejected, s.Saved, s.Failed, s.Duration.Round(time.Millisecond))
+		if s.Err != nil {
+			fmt.Printf("    error: %v\n", s.Err)
+		}
+
+		reasons := make([]string, 0, len(s.Reasons))
+		for reason := range s.Reasons {
+			reasons = append(reasons, reason)
+		}
+		sort.Strings(reasons)
+		for _, reason := range reasons {
+			fmt.Printf("    %s: %d\n", reason, s.Reasons[reason])
+		}
+		for _, sample := range s.Samples {
+			fmt.Printf("    %s\n", sample)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JuanVel1/stock-api/domain"
+)
+
+// TestParseColumnMapping verifica el mapeo de columnas del import
+func TestParseColumnMapping(t *testing.T) {
+	mapping, err := parseColumnMapping("ticker=Symbol, target_to=new_pt")
+	require.NoError(t, err)
+	assert.Equal(t, "symbol", mapping["ticker"])
+	assert.Equal(t, "new_pt", mapping["target_to"])
+	assert.Equal(t, "company", mapping["company"])
+
+	_, err = parseColumnMapping("precio=pt")
+	assert.Error(t, err)
+
+	_, err = parseColumnMapping("ticker")
+	assert.Error(t, err)
+}
+
+// TestNormalizeImportedStock verifica la validación de filas importadas
+func TestNormalizeImportedStock(t *testing.T) {
+	valid := domain.RawStock{Ticker: "aapl", TargetFrom: "1,234.5", TargetTo: "$180", Time: "2025-01-13T01:30:05+01:00"}
+	stock, issues, err := normalizeImportedStock(valid)
+	require.NoError(t, err)
+	assert.Equal(t, "AAPL", stock.Ticker)
+	assert.Equal(t, domain.Price(1234.5), stock.TargetFrom)
+	assert.Equal(t, domain.Price(180), stock.TargetTo)
+	assert.Equal(t, "2025-01-13T00:30:05Z", stock.Time)
+	assert.Empty(t, issues)
+
+	flagged := valid
+	flagged.RatingTo = "Mega Buy"
+	_, issues, err = normalizeImportedStock(flagged)
+	require.NoError(t, err)
+	require.Len(t, issues, 1)
+	assert.Equal(t, domain.RuleUnknownRating, issues[0].Rule)
+
+	tests := []struct {
+		name   string
+		stock  domain.RawStock
+		reason string
+	}{
+		{"Sin ticker", domain.RawStock{Time: "2025-01-13T00:30:05Z"}, "ticker vacío"},
+		{"Hora inválida", domain.RawStock{Ticker: "AAPL", Time: "13/01/2025"}, "hora inválida"},
+		{"Precio inválido", domain.RawStock{Ticker: "AAPL", Time: "2025-01-13T00:30:05Z", TargetTo: "$abc"}, "precio inválido"},
+		{"Precio negativo", domain.RawStock{Ticker: "AAPL", Time: "2025-01-13T00:30:05Z", TargetTo: "-5"}, "precio negativo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := normalizeImportedStock(tt.stock)
+			require.Error(t, err)
+			assert.Equal(t, tt.reason, rejectReason(err))
+		})
+	}
+}
+
+// TestReadRawRecordsWithMapping verifica la lectura de un CSV con columnas propias
+func TestReadRawRecordsWithMapping(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ratings.csv")
+	content := "Symbol,Broker,New PT,Date\nAAPL,Morgan Stanley,$180.00,2025-01-13T00:30:05Z\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+
+	records, err := readRawRecords(path, "")
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, 2, records[0].Line)
+
+	mapping, err := parseColumnMapping("ticker=symbol,brokerage=broker,target_to=new pt,time=date")
+	require.NoError(t, err)
+
+	stock := mapping.toRawStock(records[0])
+	assert.Equal(t, "AAPL", stock.Ticker)
+	assert.Equal(t, "Morgan Stanley", stock.Brokerage)
+	assert.Equal(t, "$180.00", stock.TargetTo)
+	assert.Equal(t, "2025-01-13T00:30:05Z", stock.Time)
+}
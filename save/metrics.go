@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JuanVel1/stock-api/logging"
+	"github.com/JuanVel1/stock-api/store"
+)
+
+// Tipos de métrica del formato de texto de Prometheus
+const (
+	metricCounter   = "counter"
+	metricGauge     = "gauge"
+	metricHistogram = "histogram"
+)
+
+// metric es una métrica con sus series por combinación de etiquetas. Se
+// escribe a mano en el formato de texto de Prometheus para no depender del
+// cliente oficial; lo usan varios escritores a la vez.
+type metric struct {
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	series map[string]*metricSeries
+}
+
+// metricSeries es el valor de una métrica para una combinación de etiquetas
+type metricSeries struct {
+	labelValues []string
+	value       float64
+	// Solo para histogramas: conteo por bucket (no acumulado), suma y total
+	bucketCounts []uint64
+	sum          float64
+	count        uint64
+}
+
+// Buckets de los histogramas de duración, en segundos
+var (
+	fetchBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+	batchBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+	saveBuckets  = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 900}
+)
+
+// Métricas del proceso save; se exportan al final con exportMetrics
+var (
+	pagesFetched = newMetric(metricCounter, "stock_saver_pages_fetched_total",
+		"Páginas leídas de la fuente.", "source")
+	itemsFetched = newMetric(metricCounter, "stock_saver_items_fetched_total",
+		"Registros leídos de la fuente, antes de validarlos.", "source")
+	pageFetchDuration = newHistogram("stock_saver_page_fetch_duration_seconds",
+		"Duración de la lectura de cada página, con sus reintentos.", fetchBuckets, "source")
+	fetchDuration = newMetric(metricGauge, "stock_saver_fetch_duration_seconds",
+		"Duración total de la lectura de la fuente en la última ejecución.", "source")
+	batchDuration = newHistogram("stock_saver_batch_duration_seconds",
+		"Duración de cada intento de guardar un lote.", batchBuckets, "mode", "outcome")
+	saveDuration = newHistogram("stock_saver_save_duration_seconds",
+		"Duración de cada llamada a saveStocks.", saveBuckets)
+	retriesTotal = newMetric(metricCounter, "stock_saver_retries_total",
+		"Reintentos por operación y motivo.", "operation", "reason")
+	rowsTotal = newMetric(metricCounter, "stock_saver_rows_total",
+		"Registros procesados por ejecución según su resultado (inserted, updated, skipped, failed, copied).",
+		"kind", "source", "result")
+	deadLettersTotal = newMetric(metricCounter, "stock_saver_dead_letters_total",
+		"Registros enviados a dead letters según dónde quedaron.", "destination")
+	runDuration = newMetric(metricGauge, "stock_saver_run_duration_seconds",
+		"Duración de la última ejecución.", "kind", "source")
+	runSuccess = newMetric(metricGauge, "stock_saver_run_success",
+		"1 si la última ejecución terminó bien, 0 si falló.", "kind", "source")
+	runFinished = newMetric(metricGauge, "stock_saver_run_finished_timestamp_seconds",
+		"Momento en que terminó la última ejecución (segundos desde epoch).", "kind", "source")
+	dbConnections = newMetric(metricGauge, "stock_saver_db_connections",
+		"Conexiones del pool de la base de datos por estado.", "state")
+	dbWaitCount = newMetric(metricGauge, "stock_saver_db_wait_count",
+		"Veces que se esperó una conexión libre del pool (acumulado del proceso).")
+	dbWaitDuration = newMetric(metricGauge, "stock_saver_db_wait_duration_seconds",
+		"Tiempo total esperando conexiones libres del pool (acumulado del proceso).")
+)
+
+// saverMetrics son las métricas que escribe exportMetrics, en ese orden
+var saverMetrics = []*metric{
+	pagesFetched, itemsFetched, pageFetchDuration, fetchDuration,
+	batchDuration, saveDuration, retriesTotal, rowsTotal, deadLettersTotal,
+	runDuration, runSuccess, runFinished,
+	dbConnections, dbWaitCount, dbWaitDuration,
+}
+
+func newMetric(kind, name, help string, labelNames ...string) *metric {
+	return &metric{name: name, help: help, kind: kind, labelNames: labelNames, series: make(map[string]*metricSeries)}
+}
+
+func newHistogram(name, help string, buckets []float64, labelNames ...string) *metric {
+	m := newMetric(metricHistogram, name, help, labelNames...)
+	m.buckets = buckets
+	return m
+}
+
+// get devuelve la serie de labelValues, creándola si no existe; requiere m.mu
+func (m *metric) get(labelValues []string) *metricSeries {
+	if len(labelValues) != len(m.labelNames) {
+		panic(fmt.Sprintf("métrica %s: se esperaban %d etiquetas, se recibieron %d", m.name, len(m.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := m.series[key]
+	if !ok {
+		s = &metricSeries{labelValues: append([]string(nil), labelValues...)}
+		if m.kind == metricHistogram {
+			s.bucketCounts = make([]uint64, len(m.buckets))
+		}
+		m.series[key] = s
+	}
+	return s
+}
+
+// Add suma v a un contador o gauge
+func (m *metric) Add(v float64, labelValues ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.get(labelValues).value += v
+}
+
+// Inc suma 1 a un contador
+func (m *metric) Inc(labelValues ...string) {
+	m.Add(1, labelValues...)
+}
+
+// Set fija el valor de un gauge
+func (m *metric) Set(v float64, labelValues ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.get(labelValues).value = v
+}
+
+// Observe registra v en un histograma
+func (m *metric) Observe(v float64, labelValues ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.get(labelValues)
+	for i, upper := range m.buckets {
+		if v <= upper {
+			s.bucketCounts[i]++
+			break
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+// ObserveSince registra en un histograma los segundos desde start
+func (m *metric) ObserveSince(start time.Time, labelValues ...string) {
+	m.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+// writeTo escribe la métrica en el formato de texto de Prometheus; las
+// métricas sin series no se escriben
+func (m *metric) writeTo(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.series) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# HELP %s %s\n", m.name, escapeHelp(m.help))
+	fmt.Fprintf(&b, "# TYPE %s %s\n", m.name, m.kind)
+	for _, key := range keys {
+		s := m.series[key]
+		if m.kind != metricHistogram {
+			fmt.Fprintf(&b, "%s%s %s\n", m.name, formatLabels(m.labelNames, s.labelValues, "", ""), formatValue(s.value))
+			continue
+		}
+		var cumulative uint64
+		for i, upper := range m.buckets {
+			cumulative += s.bucketCounts[i]
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", m.name, formatLabels(m.labelNames, s.labelValues, "le", formatValue(upper)), cumulative)
+		}
+		fmt.Fprintf(&b, "%s_bucket%s %d\n", m.name, formatLabels(m.labelNames, s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(&b, "%s_sum%s %s\n", m.name, formatLabels(m.labelNames, s.labelValues, "", ""), formatValue(s.sum))
+		fmt.Fprintf(&b, "%s_count%s %d\n", m.name, formatLabels(m.labelNames, s.labelValues, "", ""), s.count)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// formatLabels arma {a="1",b="2"}, con la etiqueta extra si extraName no es vacío
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	pairs := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+escapeLabelValue(values[i])+`"`)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+extraValue+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(v)
+}
+
+func escapeHelp(v string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(v)
+}
+
+// writeMetrics escribe las métricas en el formato de texto de Prometheus
+func writeMetrics(w io.Writer, metrics []*metric) error {
+	for _, m := range metrics {
+		if err := m.writeTo(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// metricsOptions configura dónde exportMetrics deja las métricas
+type metricsOptions struct {
+	// Textfile es el archivo .prom que lee el textfile collector de node-exporter
+	Textfile string
+	// PushURL es la URL base de un Pushgateway
+	PushURL string
+	// Job es el grupo (job) con el que se publican en el Pushgateway
+	Job string
+}
+
+// metricsConfig se lee de METRICS_TEXTFILE, METRICS_PUSH_URL y METRICS_JOB
+// al iniciar; la sincronización también acepta -metrics-textfile,
+// -metrics-push-url y -metrics-job
+var metricsConfig metricsOptions
+
+// metricsOptionsFromEnv lee la configuración de métricas del entorno
+func metricsOptionsFromEnv() metricsOptions {
+	return metricsOptions{
+		Textfile: os.Getenv("METRICS_TEXTFILE"),
+		PushURL:  os.Getenv("METRICS_PUSH_URL"),
+		Job:      envOrDefault("METRICS_JOB", "stock_saver"),
+	}
+}
+
+// recordDBRetry cuenta un reintento de operation por un error de base de
+// datos; el motivo es el de store.ClassifyError (ej. serialization_failure)
+func recordDBRetry(operation string, err error) {
+	retriesTotal.Inc(operation, store.ClassifyError(err).Reason)
+}
+
+// recordDBStats actualiza las métricas del pool de conexiones
+func recordDBStats() {
+	if db == nil {
+		return
+	}
+	stats := db.Stats()
+	dbConnections.Set(float64(stats.OpenConnections), "open")
+	dbConnections.Set(float64(stats.InUse), "in_use")
+	dbConnections.Set(float64(stats.Idle), "idle")
+	dbWaitCount.Set(float64(stats.WaitCount))
+	dbWaitDuration.Set(stats.WaitDuration.Seconds())
+}
+
+// recordRunMetrics suma a las métricas los contadores finales de una ejecución
+func recordRunMetrics(kind, source string, rows map[string]int, started time.Time, runErr error) {
+	for result, n := range rows {
+		rowsTotal.Add(float64(n), kind, source, result)
+	}
+	runDuration.Set(time.Since(started).Seconds(), kind, source)
+	success := 1.0
+	if runErr != nil {
+		success = 0
+	}
+	runSuccess.Set(success, kind, source)
+	runFinished.Set(float64(time.Now().Unix()), kind, source)
+}
+
+// exportMetrics escribe las métricas en el textfile y/o las publica en el
+// Pushgateway según metricsConfig. Un fallo solo se informa: las métricas no
+// cambian el resultado de la ejecución.
+func exportMetrics() {
+	if metricsConfig.Textfile == "" && metricsConfig.PushURL == "" {
+		return
+	}
+	recordDBStats()
+
+	var buf bytes.Buffer
+	if err := writeMetrics(&buf, saverMetrics); err != nil {
+		slog.Warn("Error generando las métricas", logging.Err(err))
+		return
+	}
+	if metricsConfig.Textfile != "" {
+		if err := writeTextfile(metricsConfig.Textfile, buf.Bytes()); err != nil {
+			slog.Warn("Error escribiendo las métricas", "file", metricsConfig.Textfile, logging.Err(err))
+		} else {
+			slog.Info("Métricas escritas", "file", metricsConfig.Textfile)
+		}
+	}
+	if metricsConfig.PushURL != "" {
+		if err := pushMetrics(pushClient, metricsConfig.PushURL, metricsConfig.Job, buf.Bytes()); err != nil {
+			slog.Warn("Error publicando las métricas", "url", metricsConfig.PushURL, logging.Err(err))
+		} else {
+			slog.Info("Métricas publicadas", "url", metricsConfig.PushURL, "job", metricsConfig.Job)
+		}
+	}
+}
+
+// writeTextfile escribe el archivo de forma atómica (archivo temporal y
+// rename) para que node-exporter nunca lea uno a medio escribir
+func writeTextfile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// pushTimeout acota la publicación en el Pushgateway: si no responde, el
+// proceso termina igual
+const pushTimeout = 10 * time.Second
+
+// pushClient es el cliente HTTP con el que se publica en el Pushgateway
+var pushClient = &http.Client{Timeout: pushTimeout}
+
+// pushMetrics reemplaza con PUT las métricas del grupo job en el Pushgateway
+func pushMetrics(client *http.Client, pushURL, job string, data []byte) error {
+	endpoint := strings.TrimSuffix(pushURL, "/") + "/metrics/job/" + url.PathEscape(job)
+	req, err := http.NewRequest(http.MethodPut, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("el Pushgateway respondió %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
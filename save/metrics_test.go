@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWriteMetrics verifica el formato de texto de Prometheus
+func TestWriteMetrics(t *testing.T) {
+	pages := newMetric(metricCounter, "test_pages_total", "Páginas leídas.", "source")
+	pages.Inc("http")
+	pages.Add(2, "http")
+	pages.Inc(`file:"a"`)
+
+	pool := newMetric(metricGauge, "test_pool", "Conexiones\nabiertas.")
+	pool.Set(4)
+
+	latency := newHistogram("test_latency_seconds", "Latencia.", []float64{0.1, 1}, "mode")
+	latency.Observe(0.05, "copy")
+	latency.Observe(0.5, "copy")
+	latency.Observe(3, "copy")
+
+	empty := newMetric(metricCounter, "test_empty_total", "Sin series.")
+
+	var buf bytes.Buffer
+	require.NoError(t, writeMetrics(&buf, []*metric{pages, pool, latency, empty}))
+	assert.Equal(t, `# HELP test_pages_total Páginas leídas.
+# TYPE test_pages_total counter
+test_pages_total{source="file:\"a\""} 1
+test_pages_total{source="http"} 3
+# HELP test_pool Conexiones\nabiertas.
+# TYPE test_pool gauge
+test_pool 4
+# HELP test_latency_seconds Latencia.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{mode="copy",le="0.1"} 1
+test_latency_seconds_bucket{mode="copy",le="1"} 2
+test_latency_seconds_bucket{mode="copy",le="+Inf"} 3
+test_latency_seconds_sum{mode="copy"} 3.55
+test_latency_seconds_count{mode="copy"} 3
+`, buf.String())
+
+	assert.Panics(t, func() { pages.Inc() }, "falta la etiqueta source")
+}
+
+// TestWriteTextfile verifica que el archivo se reemplace sin dejar temporales
+func TestWriteTextfile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "stock_saver.prom")
+
+	require.NoError(t, writeTextfile(path, []byte("a 1\n")))
+	require.NoError(t, writeTextfile(path, []byte("a 2\n")))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "a 2\n", string(data))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+// TestPushMetrics verifica el PUT al Pushgateway
+func TestPushMetrics(t *testing.T) {
+	var method, path, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		if r.URL.Path == "/metrics/job/roto" {
+			http.Error(w, "sin espacio", http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	require.NoError(t, pushMetrics(server.Client(), server.URL+"/", "stock_saver", []byte("a 1\n")))
+	assert.Equal(t, http.MethodPut, method)
+	assert.Equal(t, "/metrics/job/stock_saver", path)
+	assert.Equal(t, "a 1\n", body)
+
+	err := pushMetrics(server.Client(), server.URL, "roto", []byte("a 1\n"))
+	assert.ErrorContains(t, err, "500")
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+
+	"github.com/JuanVel1/stock-api/migrations"
+)
+
+// runMigrate implementa el subcomando `migrate [-db-url url] up|down [n]|status`
+func runMigrate(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	registerDBFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := dbConfig.validate(); err != nil {
+		return err
+	}
+	args = fs.Args()
+	if len(args) == 0 {
+		return fmt.Errorf("uso: save migrate up|down [n]|status")
+	}
+
+	if err := connectDB(ctx); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+	// Una migración sin transacción no debe quedar a mitad de camino: la
+	// interrupción solo corta la conexión
+	ctx = context.WithoutCancel(ctx)
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Printf("Migración aplicada: %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("No hay migraciones pendientes")
+		}
+		if err := afterMigrations(applied); err != nil {
+			return err
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				return fmt.Errorf("número de pasos inválido: %s", args[1])
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		for _, m := range reverted {
+			fmt.Printf("Migración revertida: %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			state := "pendiente"
+			if s.Applied {
+				state = "aplicada " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-40s %s\n", s.Version, s.Name, state)
+		}
+
+	default:
+		return fmt.Errorf("subcomando de migrate desconocido: %s", args[0])
+	}
+
+	return nil
+}
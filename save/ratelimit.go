@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenBucket limita la tasa de requests a la API: se recargan rate tokens
+// por segundo hasta burst y cada request consume uno
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	now   func() time.Time
+	sleep func(context.Context, time.Duration) error
+}
+
+// newTokenBucket crea un limitador lleno; rate <= 0 no limita
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+		now:    time.Now,
+		sleep:  sleepContext,
+	}
+}
+
+// Wait espera hasta que haya un token disponible y lo consume. Si ctx se
+// cancela antes devuelve el token y el error de ctx.
+func (b *tokenBucket) Wait(ctx context.Context) error {
+	if b == nil || b.rate <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	now := b.now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	// Se reserva el token aunque haya que esperarlo, para respetar el orden
+	b.tokens--
+	var wait time.Duration
+	if b.tokens < 0 {
+		wait = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+
+	if wait > 0 {
+		if err := b.sleep(ctx, wait); err != nil {
+			b.mu.Lock()
+			b.tokens++
+			b.mu.Unlock()
+			return err
+		}
+	}
+	return nil
+}
+
+// sleepContext espera d o hasta que se cancele ctx, lo que pase primero
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// errAuthRejected indica que la API rechazó DB_API_KEY; no tiene sentido reintentar
+var errAuthRejected = errors.New("la API rechazó las credenciales: revise DB_API_KEY y -source-auth-header")
+
+// httpStatusError es una respuesta distinta de 200 de la API
+type httpStatusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+	Body       string
+}
+
+func (e *httpStatusError) Error() string {
+	message := fmt.Sprintf("error de API: status code %d", e.StatusCode)
+	if e.Body != "" {
+		message += ": " + e.Body
+	}
+	return message
+}
+
+// Unwrap permite detectar los rechazos de credenciales con errors.Is
+func (e *httpStatusError) Unwrap() error {
+	if e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden {
+		return errAuthRejected
+	}
+	return nil
+}
+
+// Temporary indica si vale la pena repetir el request: 408, 425, 429 y 5xx.
+// El resto de los 4xx (400, 401, 403, 404...) son permanentes.
+func (e *httpStatusError) Temporary() bool {
+	switch e.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooEarly, http.StatusTooManyRequests:
+		return true
+	}
+	return e.StatusCode >= 500
+}
+
+// newHTTPStatusError arma el error con un extracto del cuerpo y el
+// Retry-After de las respuestas 429 y 503
+func newHTTPStatusError(resp *http.Response, body []byte) *httpStatusError {
+	excerpt := strings.TrimSpace(string(body))
+	if len(excerpt) > 200 {
+		excerpt = excerpt[:200] + "..."
+	}
+
+	statusErr := &httpStatusError{StatusCode: resp.StatusCode, Body: excerpt}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		statusErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+	return statusErr
+}
+
+// parseRetryAfter interpreta Retry-After en segundos o como fecha HTTP;
+// devuelve 0 si falta o no se entiende
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// fetchBackoff es la espera exponencial con jitter entre reintentos cuando la
+// API no indicó Retry-After
+func fetchBackoff(base time.Duration, attempt int) time.Duration {
+	wait := base << min(attempt, 6)
+	return wait/2 + time.Duration(rand.Int63n(int64(wait)/2+1))
+}
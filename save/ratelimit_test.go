@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestHTTPSource crea una fuente que registra las esperas en vez de dormir
+func newTestHTTPSource(url string, waits *[]time.Duration) *HTTPSource {
+	source := NewHTTPSource(url, "", "secreto")
+	source.sleep = func(ctx context.Context, d time.Duration) error {
+		*waits = append(*waits, d)
+		return nil
+	}
+	source.backoffBase = time.Millisecond
+	return source
+}
+
+// TestHTTPSourceRetryAfter verifica que se respete Retry-After en 429 y 503
+func TestHTTPSourceRetryAfter(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch requests {
+		case 1:
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.Header().Set("Retry-After", "600")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte(`{"items": [{"ticker": "AAPL"}], "next_page": ""}`))
+		}
+	}))
+	defer server.Close()
+
+	var waits []time.Duration
+	source := newTestHTTPSource(server.URL, &waits)
+	stocks, _, err := source.FetchPage(context.Background(), "")
+	require.NoError(t, err)
+	require.Len(t, stocks, 1)
+
+	assert.Equal(t, 3, requests)
+	// La segunda espera queda acotada por MaxRetryAfter
+	assert.Equal(t, []time.Duration{7 * time.Second, source.MaxRetryAfter}, waits)
+}
+
+// TestHTTPSourcePermanentErrors verifica que los 4xx permanentes no se reintenten
+func TestHTTPSourcePermanentErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		auth   bool
+	}{
+		{"No autorizado", http.StatusUnauthorized, true},
+		{"Prohibido", http.StatusForbidden, true},
+		{"No encontrado", http.StatusNotFound, false},
+		{"Request inválido", http.StatusBadRequest, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			var waits []time.Duration
+			_, _, err := newTestHTTPSource(server.URL, &waits).FetchPage(context.Background(), "")
+			require.Error(t, err)
+			assert.Equal(t, 1, requests)
+			assert.Empty(t, waits)
+			assert.Equal(t, tt.auth, errors.Is(err, errAuthRejected))
+		})
+	}
+}
+
+// TestHTTPSourceTransientErrors verifica los reintentos ante 5xx sin Retry-After
+func TestHTTPSourceTransientErrors(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	var waits []time.Duration
+	source := newTestHTTPSource(server.URL, &waits)
+	source.MaxAttempts = 3
+	_, _, err := source.FetchPage(context.Background(), "")
+	require.Error(t, err)
+
+	var statusErr *httpStatusError
+	require.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusBadGateway, statusErr.StatusCode)
+	assert.Equal(t, 3, requests)
+	assert.Len(t, waits, 2)
+}
+
+// TestParseRetryAfter verifica los dos formatos de Retry-After
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 13, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 30*time.Second, parseRetryAfter("30", now))
+	assert.Equal(t, 90*time.Second, parseRetryAfter("Mon, 13 Jan 2025 12:01:30 GMT", now))
+	assert.Zero(t, parseRetryAfter("Mon, 13 Jan 2025 11:00:00 GMT", now))
+	assert.Zero(t, parseRetryAfter("", now))
+	assert.Zero(t, parseRetryAfter("pronto", now))
+}
+
+// TestTokenBucket verifica el ritmo del limitador con un reloj simulado
+func TestTokenBucket(t *testing.T) {
+	now := time.Date(2025, 1, 13, 12, 0, 0, 0, time.UTC)
+	var waits []time.Duration
+
+	bucket := newTokenBucket(2, 2)
+	bucket.last = now
+	bucket.now = func() time.Time { return now }
+	bucket.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		now = now.Add(d)
+		return nil
+	}
+
+	// La ráfaga inicial no espera; luego un request cada 500ms
+	for i := 0; i < 4; i++ {
+		require.NoError(t, bucket.Wait(context.Background()))
+	}
+	assert.Equal(t, []time.Duration{500 * time.Millisecond, 500 * time.Millisecond}, waits)
+
+	var unlimited *tokenBucket
+	assert.NoError(t, unlimited.Wait(context.Background()))
+
+	// Cancelado mientras espera, devuelve el token reservado
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	bucket.sleep = sleepContext
+	bucket.last = now
+	before := bucket.tokens
+	assert.ErrorIs(t, bucket.Wait(ctx), context.Canceled)
+	assert.Equal(t, before, bucket.tokens)
+}
+
+// TestHTTPSourceCancelDuringRetryAfter verifica que una cancelación corte la
+// espera de Retry-After en vez de dormir hasta que venza
+func TestHTTPSourceCancelDuringRetryAfter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// La señal llega mientras se espera el Retry-After
+		cancel()
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	source := NewHTTPSource(server.URL, "", "secreto")
+	start := time.Now()
+	_, _, err := source.FetchPage(ctx, "")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), 10*time.Second)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"github.com/JuanVel1/stock-api/store"
+)
+
+// runReset implementa `reset [-data -yes] [-all | fuente...]`: borra los
+// checkpoints de las fuentes para que la próxima sincronización empiece
+// desde la primera página. Con -data borra también los eventos que
+// escribieron (con -all, todos los eventos), lo que pide confirmar con -yes.
+func runReset(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("reset", flag.ContinueOnError)
+	all := fs.Bool("all", false, "todas las fuentes en lugar de las indicadas")
+	data := fs.Bool("data", false, "borrar también los eventos de rating_events escritos por las fuentes")
+	yes := fs.Bool("yes", false, "confirmar el borrado de -data")
+	registerDBFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := dbConfig.validate(); err != nil {
+		return err
+	}
+
+	// nil significa todas las fuentes para deleteSyncStates y DeleteRatingEvents
+	var sources []string
+	switch {
+	case *all && fs.NArg() > 0:
+		return fmt.Errorf("use -all o una lista de fuentes, no ambos")
+	case !*all && fs.NArg() == 0:
+		return fmt.Errorf("uso: save reset [-data -yes] [-all | fuente...]")
+	case !*all:
+		sources = fs.Args()
+	}
+	if *data && !*yes {
+		return fmt.Errorf("-data borra los eventos de rating_events; confirme con -yes")
+	}
+
+	if err := initDB(ctx); err != nil {
+		return fmt.Errorf("error inicializando DB: %v", err)
+	}
+	defer db.Close()
+
+	states, err := deleteSyncStates(sources)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Checkpoints borrados: %d\n", states)
+
+	if *data {
+		events, err := store.DeleteRatingEvents(ctx, db, sources)
+		fmt.Printf("Eventos borrados: %d\n", events)
+		if err != nil {
+			return err
+		}
+		slog.Warn("Eventos borrados; la próxima sincronización completa los vuelve a cargar", "sources", sources, "count", events)
+	}
+	return nil
+}
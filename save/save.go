@@ -1,11 +1,12 @@
 package main
 
 import (
-	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
+	"log/slog"
 	"math"
-	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -15,113 +16,264 @@ import (
 	"github.com/joho/godotenv"
 
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
 	"context"
-)
-
-// Stock define la estructura de datos para cada acción
-type Stock struct {
-	Ticker     string `json:"ticker" db:"ticker"`
-	Company    string `json:"company" db:"company"`
-	Brokerage  string `json:"brokerage" db:"brokerage"`
-	Action     string `json:"action" db:"action"`
-	RatingFrom string `json:"rating_from" db:"rating_from"`
-	RatingTo   string `json:"rating_to" db:"rating_to"`
-	TargetFrom string `json:"target_from" db:"target_from"`
-	TargetTo   string `json:"target_to" db:"target_to"`
-	Time       string `json:"time" db:"time"`
-}
 
-// APIResponse estructura para parsear la respuesta JSON
-type APIResponse struct {
-	Items    []Stock `json:"items"`
-	NextPage string  `json:"next_page"`
-}
+	"github.com/JuanVel1/stock-api/domain"
+	"github.com/JuanVel1/stock-api/logging"
+	"github.com/JuanVel1/stock-api/migrations"
+	"github.com/JuanVel1/stock-api/store"
+)
 
 var db *sqlx.DB
 
+// vocabulary traduce ratings y acciones a valores canónicos al ingerir; se
+// carga de la tabla vocabulary en initDB
+var vocabulary = domain.DefaultVocabulary()
+
 func main() {
 	// Set up a recovery handler for panics
 	defer func() {
 		if r := recover(); r != nil {
-			fmt.Printf("Programa recuperado de pánico: %v\n", r)
 			// Get stack trace
 			buf := make([]byte, 4096)
 			n := runtime.Stack(buf, false)
-			fmt.Printf("Stack trace: %s\n", buf[:n])
+			slog.Error("Programa recuperado de pánico", "panic", r, "stack", string(buf[:n]))
 			os.Exit(1)
 		}
 	}()
-	
-	fmt.Println("Starting stock data fetcher...")
-	
+
 	// Cargar variables de entorno desde .env
-	err := godotenv.Load()
-	if err != nil {
-		fmt.Printf("Warning: Error loading .env file: %v\n", err)
+	envErr := godotenv.Load()
+	if _, err := logging.Setup(); err != nil {
+		slog.Warn("Configuración de logs inválida, se usa logfmt con nivel info", logging.Err(err))
 	}
-	
-	// Verificar que las variables de entorno necesarias estén presentes
-	apiKey := os.Getenv("DB_API_KEY")
-	if apiKey == "" {
-		fmt.Println("Error: DB_API_KEY environment variable is missing or empty")
-		os.Exit(1)
+	if envErr != nil {
+		slog.Debug("No se cargó el archivo .env", logging.Err(envErr))
 	}
-	
-	fmt.Println("Environment variables loaded successfully")
-	
-	// Inicializar base de datos
-	if err := initDB(); err != nil {
-		fmt.Printf("Error inicializando DB: %v\n", err)
-		fmt.Println("Trying once more with increased timeouts...")
-		// Try once more with a longer timeout before giving up
-		time.Sleep(5 * time.Second)
-		if err := initDB(); err != nil {
-			fmt.Printf("Error inicializando DB en segundo intento: %v\n", err)
-			os.Exit(1)
+	slog.Info("Iniciando el proceso save")
+	metricsConfig = metricsOptionsFromEnv()
+	dbConfig = dbOptionsFromEnv()
+
+	cmd, args, err := parseCommand(os.Args[1:])
+	if err != nil {
+		printUsage(os.Stderr)
+		if errors.Is(err, flag.ErrHelp) {
+			return
 		}
+		slog.Error("Subcomando inválido", logging.Err(err))
+		os.Exit(2)
 	}
-	defer func() {
-		if db != nil {
-			fmt.Println("Closing database connection...")
-			db.Close()
+
+	// SIGINT/SIGTERM detienen la lectura entre páginas y dejan terminar lo que
+	// se está guardando; el proceso sale con exitInterrupted
+	ctx, stop := signalContext()
+	defer stop()
+
+	err = cmd.run(ctx, args)
+	if cmd.metrics {
+		exportMetrics()
+	}
+	switch {
+	case err == nil:
+		slog.Info("Proceso completado", "command", cmd.name)
+		return
+	case errors.Is(err, flag.ErrHelp):
+		// -h ya mostró los flags del subcomando
+		return
+	case errors.Is(err, context.Canceled):
+		slog.Warn("Proceso interrumpido por una señal; `save sync` continúa desde los checkpoints",
+			"command", cmd.name, logging.Err(err))
+	case errors.Is(err, errDrift):
+		slog.Warn("La base de datos no coincide con la fuente; ver el reporte de verify", "command", cmd.name)
+	case errors.Is(err, errAuthRejected):
+		slog.Error("Error de autenticación con la API", "command", cmd.name, logging.Err(err))
+	default:
+		slog.Error("El proceso terminó con error", "command", cmd.name, logging.Err(err))
+	}
+	os.Exit(exitCode(err))
+}
+
+// runSync implementa `sync` (incremental: continúa desde el checkpoint si la
+// última sincronización de la fuente quedó a medias), `full` (desde la
+// primera página) y la ejecución sin subcomando, que lee todo salvo con
+// -resume.
+func runSync(ctx context.Context, name string, args []string) error {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	var sourceCfg sourceConfig
+	sourcesFile := registerSourceFlags(fs, &sourceCfg)
+	registerWriterFlags(fs)
+	registerDBFlags(fs)
+	registerMetricsFlags(fs)
+	resume := name == "sync"
+	if name == legacyCommand {
+		fs.BoolVar(&resume, "resume", false, "reanudar desde la última página confirmada")
+		fs.Usage = func() {
+			printUsage(fs.Output())
+			fmt.Fprintln(fs.Output(), "\nSin subcomando, save sincroniza con estos flags:")
+			fs.PrintDefaults()
 		}
+	}
+	dryRun := fs.Bool("dry-run", false, "leer la fuente y comparar con la base de datos sin escribir nada")
+	dryRunOutput := fs.String("dry-run-output", "", "archivo donde escribir el resumen JSON del dry-run (por defecto la salida estándar)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("argumentos inesperados: %s", strings.Join(fs.Args(), " "))
+	}
+	if err := writeOptions.validate(); err != nil {
+		return err
+	}
+	if err := dbConfig.validate(); err != nil {
+		return err
+	}
+
+	// Verificar que las fuentes estén bien configuradas (DB_API_KEY para http)
+	sourceConfigs, err := loadSourceConfigs(sourceCfg, *sourcesFile)
+	if err != nil {
+		return fmt.Errorf("configuración de fuentes inválida: %w", err)
+	}
+	sources, err := newConfiguredSources(sourceConfigs)
+	if err != nil {
+		return fmt.Errorf("configuración de fuentes inválida: %w", err)
+	}
+	for _, source := range sources {
+		slog.Info("Fuente configurada", "source", source.Name(), "priority", source.Priority)
+	}
+
+	if *dryRun {
+		return runDryRun(ctx, sources, resume, *dryRunOutput)
+	}
+
+	if err := initDBWithRetry(ctx); err != nil {
+		return err
+	}
+	defer func() {
+		slog.Debug("Cerrando la conexión a la base de datos")
+		db.Close()
 	}()
 
-	// Obtener todos los stocks
-	allStocks, err := fetchAllStocks()
+	// Obtener y guardar los stocks de cada fuente página por página
+	return syncSources(ctx, sources, resume)
+}
+
+// initDBWithRetry es initDB con un segundo intento, tras una pausa, si el
+// primer error es transitorio. Cancelar ctx corta la pausa.
+func initDBWithRetry(ctx context.Context) error {
+	err := initDB(ctx)
+	if err == nil {
+		return nil
+	}
+	decision := store.ClassifyError(err)
+	if !decision.Retry() {
+		return fmt.Errorf("error no recuperable inicializando la base de datos [%s]: %w", decision, err)
+	}
+	slog.Warn("Error transitorio inicializando la base de datos, se reintenta una vez", "error_class", decision.String(), logging.Err(err))
+	if err := sleepContext(ctx, 5*time.Second); err != nil {
+		return fmt.Errorf("inicialización de la base de datos interrumpida: %w", err)
+	}
+	if err := initDB(ctx); err != nil {
+		return fmt.Errorf("error inicializando la base de datos en el segundo intento: %w", err)
+	}
+	return nil
+}
+
+// initDB conecta a la base de datos y aplica las migraciones pendientes.
+// ctx solo corta la conexión: una migración sin transacción no debe quedar
+// a mitad de camino.
+func initDB(ctx context.Context) error {
+	if err := connectDB(ctx); err != nil {
+		return err
+	}
+
+	// Aplicar solo las migraciones pendientes; nunca se recrea la tabla
+	applied, err := migrations.Up(context.Background(), db)
 	if err != nil {
-		fmt.Printf("Error obteniendo stocks: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("error aplicando migraciones: %w", err)
+	}
+	loadReferenceData()
+
+	for _, m := range applied {
+		slog.Info("Migración aplicada", "version", m.Version, "name", m.Name)
 	}
+	return afterMigrations(applied)
+}
 
-	// Guardar en base de datos
-	if err := saveStocks(allStocks); err != nil {
-		fmt.Printf("Error guardando stocks: %v\n", err)
-		os.Exit(1)
+// afterMigrations hace lo que algunas migraciones dejan pendiente: informar
+// los precios que no se convirtieron y copiar stocks a rating_events. Un
+// error en la copia es fatal: sin ella rating_events queda incompleto.
+func afterMigrations(applied []migrations.Migration) error {
+	for _, m := range applied {
+		switch m.Name {
+		case store.PriceConversionMigration:
+			reportPriceConversionErrors()
+		case store.RatingEventsMigration:
+			if err := backfillRatingEvents(context.Background()); err != nil {
+				return err
+			}
+		}
 	}
+	return nil
+}
 
-	fmt.Println("Proceso completado exitosamente!")
+// loadReferenceData carga el vocabulario y el directorio de brókers; si no
+// se pueden leer se usan los valores por defecto
+func loadReferenceData() {
+	loaded, err := store.LoadVocabulary(context.Background(), db)
+	if err != nil {
+		slog.Warn("Error leyendo vocabulary, se usa el vocabulario por defecto", logging.Err(err))
+	} else {
+		vocabulary = loaded
+	}
+	if err := loadBrokerages(); err != nil {
+		slog.Warn("Error cargando brókers, se usa el directorio por defecto", logging.Err(err))
+	}
 }
 
-func initDB() error {
+// reportPriceConversionErrors informa los precios que la migración a NUMERIC
+// dejó en NULL por no poder interpretarlos
+func reportPriceConversionErrors() {
+	conversionErrors, err := store.ListPriceConversionErrors(context.Background(), db)
+	if err != nil {
+		slog.Warn("Error leyendo price_conversion_errors", logging.Err(err))
+		return
+	}
+	if len(conversionErrors) == 0 {
+		slog.Info("Todos los precios objetivo se convirtieron a NUMERIC")
+		return
+	}
+
+	slog.Warn("Precios objetivo que no se pudieron convertir (quedaron en NULL, ver price_conversion_errors)",
+		"count", len(conversionErrors))
+	for _, e := range conversionErrors[:min(10, len(conversionErrors))] {
+		raw := ""
+		if e.RawValue != nil {
+			raw = *e.RawValue
+		}
+		slog.Warn("Precio objetivo sin convertir", "ticker", e.Ticker, "time", e.Time, "column", e.ColumnName, "value", raw)
+	}
+}
+
+// connectDB abre la conexión a la base de datos sin tocar el esquema;
+// cancelar ctx corta los reintentos
+func connectDB(ctx context.Context) error {
 	var err error
-	// Get DB URL from environment or use default
-	dbURL := os.Getenv("DB_URL")
+	// Get DB URL from -db-url/DB_URL or use default
+	dbURL := dbConfig.URL
 	if dbURL == "" {
-		dbURL = "postgresql://root@localhost:26257/defaultdb?sslmode=disable"
-		fmt.Println("Using default database URL")
+		dbURL = defaultDBURL
+		slog.Debug("DB_URL no definido, se usa la base de datos local por defecto")
 	}
-	
-	fmt.Printf("Connecting to database: %s\n", dbURL)
+
+	slog.Info("Conectando a la base de datos", "url", redactURL(dbURL))
 	
 	// Try to connect to the database with retries
-	maxRetries := 5
+	maxRetries := dbConfig.ConnectAttempts
 	var lastErr error
 	
 	for attempt := 1; attempt <= maxRetries; attempt++ {
 		// Try to connect
-		db, err = sqlx.Connect("postgres", dbURL)
+		db, err = sqlx.ConnectContext(ctx, "postgres", dbURL)
 		if err == nil {
 			// Connection successful
 			break
@@ -129,68 +281,54 @@ func initDB() error {
 		
 		// Save the error and retry
 		lastErr = err
+		decision := store.ClassifyError(err)
+		if !decision.Retry() {
+			// Credenciales o base de datos inválidas: reintentar no ayuda
+			return fmt.Errorf("error conectando a la base de datos [%s]: %w", decision, err)
+		}
 		if attempt < maxRetries {
+			recordDBRetry("connect", err)
 			// Calculate backoff with a jitter to prevent thundering herd
 			backoff := time.Duration(math.Pow(2, float64(attempt-1))+float64(time.Now().UnixNano()%1000)/1000) * time.Second
-			fmt.Printf("Database connection attempt %d/%d failed: %v\nRetrying in %v...\n", 
-				attempt, maxRetries, err, backoff)
-			time.Sleep(backoff)
+			slog.Warn("Falló la conexión a la base de datos, se reintenta",
+				"attempt", attempt, "max_attempts", maxRetries, "backoff", backoff,
+				"error_class", decision.String(), logging.Err(err))
+			if err := sleepContext(ctx, backoff); err != nil {
+				return fmt.Errorf("conexión a la base de datos interrumpida: %w", lastErr)
+			}
 		}
 	}
 	
 	// If we still have an error after all retries, return it
 	if err != nil {
-		return fmt.Errorf("error conectando a la base de datos después de %d intentos: %v", maxRetries, lastErr)
+		return fmt.Errorf("error conectando a la base de datos después de %d intentos: %w", maxRetries, lastErr)
 	}
 	
 	// Verify connection with ping
-	fmt.Println("Database connection established, verifying with ping...")
-	err = db.Ping()
+	err = db.PingContext(ctx)
 	if err != nil {
-		return fmt.Errorf("error verificando conexión a la base de datos: %v", err)
+		return fmt.Errorf("error verificando conexión a la base de datos: %w", err)
 	}
-	fmt.Println("Database ping successful")
 
 	// Configurar conexión
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(25)
+	// Cada escritor usa una conexión; se dejan algunas más para checkpoints y dead letters
+	db.SetMaxOpenConns(max(25, writeOptions.Concurrency+2))
+	db.SetMaxIdleConns(max(25, writeOptions.Concurrency+2))
 	db.SetConnMaxLifetime(5 * time.Minute)
 	db.SetConnMaxIdleTime(1 * time.Minute)
 	
-	fmt.Println("Database connection pool configured")
+	slog.Info("Conexión a la base de datos establecida")
 
-	// Crear tabla si no existe
-	// Drop existing table if it exists with the old schema
-	_, err = db.Exec(`DROP TABLE IF EXISTS stocks`)
-	if err != nil {
-		return fmt.Errorf("error dropping existing table: %v", err)
-	}
-	
-	// Create table with composite primary key
-	_, err = db.Exec(`
-        CREATE TABLE IF NOT EXISTS stocks (
-            ticker TEXT NOT NULL,
-            company TEXT,
-            brokerage TEXT,
-            action TEXT,
-            rating_from TEXT,
-            rating_to TEXT,
-            target_from TEXT,
-            target_to TEXT,
-            time TEXT NOT NULL,
-            PRIMARY KEY (ticker, time)
-        )`)
-	if err != nil {
-		return fmt.Errorf("error creando tabla stocks: %v", err)
-	}
-	
-	// Create index on ticker for quick lookups
-	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_stocks_ticker ON stocks (ticker)`)
+	return nil
+}
+
+// redactURL oculta la contraseña de la URL de conexión para poder registrarla
+func redactURL(dbURL string) string {
+	u, err := url.Parse(dbURL)
 	if err != nil {
-		return fmt.Errorf("error creando índice en ticker: %v", err)
+		return "(URL inválida)"
 	}
-
-	return nil
+	return u.Redacted()
 }
 
 // checkDBConnection verifica que la conexión a la base de datos esté activa
@@ -198,8 +336,8 @@ func initDB() error {
 func checkDBConnection() error {
 	// Si la conexión es nil, intentar inicializar
 	if db == nil {
-		fmt.Println("Database connection is nil, trying to initialize...")
-		return initDB()
+		slog.Info("Sin conexión a la base de datos, se inicializa")
+		return initDB(context.Background())
 	}
 	
 	// Verificar conexión con ping usando un contexto con timeout
@@ -208,403 +346,448 @@ func checkDBConnection() error {
 	
 	err := db.PingContext(ctx)
 	if err != nil {
-		fmt.Printf("Database connection lost: %v\n", err)
-		fmt.Println("Attempting to reconnect...")
-		return initDB()
+		slog.Warn("Se perdió la conexión a la base de datos, se reconecta", logging.Err(err))
+		return initDB(context.Background())
 	}
 	
 	// Log connection pool stats
+	recordDBStats()
 	stats := db.Stats()
-	fmt.Printf("DB connection pool stats: Open=%d, InUse=%d, Idle=%d\n", 
-		stats.OpenConnections, stats.InUse, stats.Idle)
+	slog.Debug("Estado del pool de conexiones",
+		"open", stats.OpenConnections, "in_use", stats.InUse, "idle", stats.Idle)
 	
 	return nil
 }
-func fetchStocks(nextPage string) ([]Stock, string, error) {
-	// Create a function-scoped apiResponse that will be updated by the retry function
-	var apiResponse APIResponse
-	
-	err := retryWithBackoff(3, func() error {
-		url := "https://8j5baasof2.execute-api.us-west-2.amazonaws.com/production/swechallenge/list"
-		if nextPage != "" {
-			url += "?next_page=" + nextPage
-		}
-		
-		fmt.Printf("Fetching stocks from URL: %s\n", url)
-		
-		// Create the request
-		req, err := http.NewRequest("GET", url, nil)
-		if err != nil {
-			return fmt.Errorf("error creando request: %v", err)
-		}
-		
-		// Get API key and add headers
-		apiKey := os.Getenv("DB_API_KEY")
-		if apiKey == "" {
-			return fmt.Errorf("DB_API_KEY environment variable is missing or empty")
-		}
-		
-		// Use the API key as-is since it already includes "Bearer " prefix in the .env file
-		req.Header.Add("Authorization", apiKey)
-		req.Header.Add("Content-Type", "application/json")
-		fmt.Println("Request headers set: Content-Type=application/json, Authorization=[HIDDEN]")
-		
-		// Create client and make the request
-		client := &http.Client{Timeout: 10 * time.Second}
-		resp, err := client.Do(req)
-		if err != nil {
-			return fmt.Errorf("error haciendo request: %v", err)
-		}
-		defer resp.Body.Close()
-
-		// Check status code
-		if resp.StatusCode != http.StatusOK {
-			return fmt.Errorf("error de API: status code %d", resp.StatusCode)
-		}
-		
-		// Read the response body
-		responseBody, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("error leyendo response: %v", err)
-		}
-		
-		// Print response length for debugging
-		fmt.Printf("Received response with length: %d bytes\n", len(responseBody))
-		
-		// Create a local response object for unmarshaling
-		var localResponse APIResponse
-		
-		// Debug output to see the response body if unmarshaling fails
-		err = json.Unmarshal(responseBody, &localResponse)
-		if err != nil {
-			fmt.Printf("Error unmarshaling JSON: %v\n", err)
-			fmt.Printf("Response body: %s\n", string(responseBody))
-			return fmt.Errorf("error unmarshaling JSON: %v", err)
-		}
-		
-		// On success, update the function-scoped apiResponse
-		apiResponse = localResponse
-		
-		fmt.Printf("Successfully unmarshaled JSON with %d items\n", len(apiResponse.Items))
-		return nil
-	})
 
-	if err != nil {
-		return nil, "", err
-	}
+// batchResult cuenta lo que hizo la base de datos con un lote
+type batchResult struct {
+	Inserted int
+	Updated  int
+	Retries  int
+	// Copied son los registros cargados por COPY (ver attemptCopy)
+	Copied int
+	// Skipped son los registros que no se escribieron porque otra fuente con
+	// más prioridad ya los tenía
+	Skipped int
+}
 
-	return apiResponse.Items, apiResponse.NextPage, nil
+// attemptTransaction guarda el lote con store.UpsertStocks, que repite el
+// upsert ante conflictos de serialización y registra en stock_changes lo que
+// cambió respecto de las filas existentes
+func attemptTransaction(ctx context.Context, runID string, batch []domain.Stock) (batchResult, error) {
+	logger := logging.FromContext(ctx)
+	opts := store.TxOptions{
+		OnRetry: func(retry int, err error) {
+			recordDBRetry("transaction", err)
+			logger.Warn("Conflicto en la transacción, se reintenta", "retry", retry,
+				"error_class", store.ClassifyError(err).String(), logging.Err(err))
+		},
+	}
+	result, err := store.UpsertStocks(ctx, db, runID, batch, opts)
+	return batchResult{
+		Inserted: result.Inserted,
+		Updated:  result.Updated,
+		Skipped:  result.Skipped,
+		Retries:  result.Retries,
+	}, err
 }
 
-// attemptTransaction intenta ejecutar una transacción con el lote de stocks
-func attemptTransaction(ctx context.Context, batch []Stock) error {
-	// Begin transaction with default isolation level
-	tx, err := db.BeginTxx(ctx, nil)
-	if err != nil {
-		return fmt.Errorf("error iniciando transacción: %v", err)
-	}
-	
-	// Ensure transaction is rolled back if it fails
-	defer func() {
-		if tx != nil {
-			tx.Rollback()
-		}
-	}()
-	
-	// Usamos NamedExec para inserción por lotes
-	query := `
-		INSERT INTO stocks (
-			ticker, company, brokerage, action, 
-			rating_from, rating_to, target_from, target_to, time
-		) VALUES (
-			:ticker, :company, :brokerage, :action,
-			:rating_from, :rating_to, :target_from, :target_to, :time
-		) ON CONFLICT (ticker, time) DO UPDATE SET
-			company = EXCLUDED.company,
-			brokerage = EXCLUDED.brokerage,
-			action = EXCLUDED.action,
-			rating_from = EXCLUDED.rating_from,
-			rating_to = EXCLUDED.rating_to,
-			target_from = EXCLUDED.target_from,
-			target_to = EXCLUDED.target_to`
-	
-	// Execute the query with detailed error logging and context timeout
-	_, err = tx.NamedExecContext(ctx, query, batch)
-	if err != nil {
-		return fmt.Errorf("error ejecutando consulta: %v", err)
-	}
-	
-	// Commit transaction
-	err = tx.Commit()
-	if err != nil {
-		return fmt.Errorf("error confirmando transacción: %v", err)
-	}
-	
-	// Mark tx as nil so it doesn't get rolled back in the defer
-	tx = nil
-	return nil
+// processBatch procesa un lote de stocks y los guarda en la base de datos.
+// Los conflictos entre transacciones se reintentan dentro de
+// attemptTransaction; aquí solo se repite el lote cuando se perdió la
+// conexión o se agotó el tiempo. Lo llaman varios escritores a la vez, así
+// que no debe reemplazar db. Los mensajes usan el logger de ctx (ver
+// logging.NewContext).
+func processBatch(ctx context.Context, runID string, batch []domain.Stock) (batchResult, error) {
+	return retryBatch(ctx, "upsert", runID, batch, attemptTransaction)
 }
 
-// isRetryableError determina si un error de base de datos se puede reintentar
-func isRetryableError(err error) bool {
-	if err == nil {
-		return false
-	}
-	
-	errMsg := err.Error()
-	return contains(errMsg, "deadlock") ||
-		contains(errMsg, "timeout") ||
-		contains(errMsg, "connection") ||
-		contains(errMsg, "restart") ||
-		contains(errMsg, "try again") ||
-		contains(errMsg, "lock") ||
-		contains(errMsg, "concurrent") ||
-		contains(errMsg, "retry") ||
-		contains(errMsg, "conflict")
+// processBulkBatch es processBatch con la carga por COPY de attemptCopy
+func processBulkBatch(ctx context.Context, runID string, batch []domain.Stock) (batchResult, error) {
+	return retryBatch(ctx, "copy", runID, batch, attemptCopy)
 }
 
-// processBatch procesa un lote de stocks y los guarda en la base de datos
-func processBatch(batch []Stock) error {
+// batchBackoffBase es la primera espera de retryBatch; se duplica en cada intento
+var batchBackoffBase = 500 * time.Millisecond
+
+// retryBatch repite attempt sobre el lote ante los errores que
+// store.ClassifyError considera reintentables (conflictos, lock y statement
+// timeouts, too_many_connections, timeouts) o de conexión; mode (upsert o
+// copy) identifica la escritura en las métricas. Cancelar parent no corta el
+// intento en curso, pero sí la espera entre intentos: el lote falla con el
+// último error y va a dead letters.
+func retryBatch(parent context.Context, mode, runID string, batch []domain.Stock, write func(context.Context, string, []domain.Stock) (batchResult, error)) (batchResult, error) {
 	if len(batch) == 0 {
-		return nil
-	}
-	
-	fmt.Printf("Procesando lote de %d stocks...\n", len(batch))
-	
-	// Verificar conexión antes de procesar
-	if err := checkDBConnection(); err != nil {
-		return fmt.Errorf("error verificando conexión a la base de datos: %v", err)
+		return batchResult{}, nil
 	}
 	
-	// Retryable transaction logic
-	maxRetries := 5 // Increased from 3 to 5 for more resilience
+	maxAttempts := writeOptions.MaxAttempts
+	timeout := 30 * time.Second
 	var lastErr error
-	
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		// Create context with timeout for the transaction - increase timeout for each retry
-		// Use a shorter timeout for early attempts, longer for later attempts
-		timeout := time.Duration(10*attempt) * time.Second
-		ctx, cancel := context.WithTimeout(context.Background(), timeout)
-		
-		// Log the transaction attempt
-		fmt.Printf("Intentando transacción %d/%d con timeout de %v...\n", 
-			attempt, maxRetries, timeout)
-			
-		// Attempt the transaction
-		err := attemptTransaction(ctx, batch)
-		cancel() // cancel the context regardless of outcome
-		
-		// If successful, return
+	attempts := 0
+	retries := 0
+	
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		attempts = attempt
+		logger := logging.FromContext(parent).With("attempt", attempt)
+		ctx, cancel := context.WithTimeout(logging.NewContext(context.WithoutCancel(parent), logger), timeout)
+		start := time.Now()
+		result, err := write(ctx, runID, batch)
+		cancel()
+		retries += result.Retries
+
+		outcome := "ok"
+		if err != nil {
+			outcome = "error"
+		}
+		batchDuration.ObserveSince(start, mode, outcome)
+
 		if err == nil {
-			fmt.Printf("Lote de %d stocks guardado exitosamente (intento %d/%d)\n", 
-				len(batch), attempt, maxRetries)
-			return nil
+			logger.Debug("Lote guardado", "size", len(batch),
+				"inserted", result.Inserted, "updated", result.Updated, "skipped", result.Skipped)
+			result.Retries = retries
+			return result, nil
 		}
-		
-		// Log the error
-		// Log the error
-		fmt.Printf("Error en transacción (intento %d/%d): %v\n", attempt, maxRetries, err)
 		lastErr = err
+
+		decision := store.ClassifyError(err)
+		logger.Warn("Error guardando el lote", "max_attempts", maxAttempts,
+			"error_class", decision.String(), logging.Err(err))
 		
-		// Check if we should retry
-		if attempt < maxRetries && isRetryableError(err) {
-			// If it's a connection error, try to reconnect
-			if contains(err.Error(), "connection") || 
-			   contains(err.Error(), "broken") || 
-			   contains(err.Error(), "reset by peer") ||
-			   contains(err.Error(), "i/o timeout") {
-				fmt.Println("Error de conexión detectado, intentando reconectar...")
-				if reconnectErr := initDB(); reconnectErr != nil {
-					fmt.Printf("Error al reconectar: %v\n", reconnectErr)
-				} else {
-					fmt.Println("Reconexión exitosa, continuando con la transacción...")
-				}
-			}
-			// Exponential backoff between retries
-			backoff := time.Duration(math.Pow(2, float64(attempt-1))) * 500 * time.Millisecond
-			fmt.Printf("Reintentando en %v...\n", backoff)
-			time.Sleep(backoff)
-			continue
+		if !decision.Retry() {
+			break
+		}
+		if attempt == maxAttempts {
+			break
 		}
+		retries++
+		recordDBRetry("batch", err)
 		
-		// If we're here, it's either the last attempt or a non-retryable error
-		break
+		if decision.Reconnect() {
+			// El pool de database/sql descarta la conexión rota y el reintento
+			// abre una nueva; no se reemplaza db porque otros escritores la usan
+			logger.Info("Error de conexión, se reintenta con otra conexión del pool")
+		}
+		backoff := time.Duration(math.Pow(2, float64(attempt-1))) * batchBackoffBase
+		logger.Debug("Esperando antes de reintentar el lote", "backoff", backoff)
+		if err := sleepContext(parent, backoff); err != nil {
+			logger.Warn("Reintentos del lote interrumpidos", logging.Err(err))
+			break
+		}
 	}
-	
+
 	// If we get here, all attempts failed
-	fmt.Println("Muestra de registros en el lote:")
 	for i := 0; i < min(3, len(batch)); i++ {
 		stock := batch[i]
-		fmt.Printf("  - %d: ticker=%s, company=%s, time=%s\n", 
-			i, stock.Ticker, stock.Company, stock.Time)
+		logging.FromContext(parent).Debug("Registro del lote fallido", "index", i,
+			"ticker", stock.Ticker, "company", stock.Company, "time", stock.Time)
 	}
 	
-	// Return the last error
-	return fmt.Errorf("error insertando stocks después de %d intentos: %v", maxRetries, lastErr)
+	return batchResult{Retries: retries}, fmt.Errorf("error insertando stocks después de %d intentos: %w", attempts, lastErr)
 }
 
-// cleanupResources realiza una limpieza de recursos y fuerza la recolección de basura
-func cleanupResources() {
-	// Close and reopen idle connections to prevent stale connections
-	if db != nil {
-		fmt.Println("Cleaning up database connections...")
-		
-		// Force the database to clear idle connections by temporarily setting max idle to 0
-		// then back to our standard value
-		db.SetMaxIdleConns(0)
-		db.SetMaxIdleConns(25)
-		
-		// Log current connection stats
-		stats := db.Stats()
-		fmt.Printf("Connection pool after cleanup: Open=%d, InUse=%d, Idle=%d\n", 
-			stats.OpenConnections, stats.InUse, stats.Idle)
-	}
-	
-	// Run garbage collection to free memory
-	runtime.GC()
-	
-	// Force a short sleep to allow system to stabilize
-	time.Sleep(500 * time.Millisecond)
+// saveResult resume cuántos stocks se guardaron y cuántos fallaron
+type saveResult struct {
+	Saved    int
+	Failed   int
+	Inserted int
+	Updated  int
+	Retries  int
+	Copied   int
+	Skipped  int
+	// LastErr es el error del último lote fallido, para clasificarlo en la ejecución
+	LastErr error
 }
 
-func saveStocks(stocks []Stock) error {
+// saveStocks guarda los stocks en lotes con el pool de escritores; los lotes
+// que agotan sus reintentos se envían a dead letters con el id de la ejecución runID
+func saveStocks(ctx context.Context, runID string, stocks []domain.Stock) (saveResult, error) {
+	var result saveResult
 	if len(stocks) == 0 {
-		return nil
+		return result, nil
 	}
 	
-	fmt.Printf("Guardando %d stocks en la base de datos\n", len(stocks))
-	
+	start := time.Now()
+	defer func() { saveDuration.ObserveSince(start) }()
+
+	logger := slog.With("run_id", runID)
+	logger.Info("Guardando stocks", "count", len(stocks),
+		"concurrency", writeOptions.Concurrency, "batch_size", writeOptions.BatchSize)
+
 	// Verificar conexión a la base de datos antes de comenzar
 	if err := checkDBConnection(); err != nil {
-		return fmt.Errorf("error verificando conexión inicial: %v", err)
+		result.Failed = len(stocks)
+		result.LastErr = err
+		deadLetterBatch(runID, stocks, err, 0)
+		return result, fmt.Errorf("error verificando conexión inicial: %w", err)
 	}
 	
-	// Definir tamaño de lote - reducimos para evitar problemas de memoria
-	const batchSize = 25 // Reduced from 50 to 25 for smaller batches
-	var successCount int
-	var failedCount int
+	writer := newPageWriter(ctx, runID, writeOptions, func(_ any, pageResult saveResult, _ error) error {
+		result = pageResult
+		return nil
+	})
+	writer.SubmitPage(stocks, nil)
+	err := writer.Close()
 	
-	// Procesar en lotes
-	for i := 0; i < len(stocks); i += batchSize {
-		end := i + batchSize
-		if end > len(stocks) {
-			end = len(stocks)
-		}
-		
-		batch := stocks[i:end]
-		fmt.Printf("Procesando lote %d/%d (%d registros)\n", 
-			(i/batchSize)+1, (len(stocks)+batchSize-1)/batchSize, len(batch))
-		
-		// Procesar lote con manejo de errores
-		err := processBatch(batch)
+	logger.Info("Stocks guardados", "saved", result.Saved, "failed", result.Failed)
+	return result, err
+}
+
+// syncPage es lo que syncStocks necesita saber de una página cuando sus
+// lotes terminan de guardarse; varias páginas pueden guardarse juntas
+type syncPage struct {
+	NextPage string
+	Rejected int
+}
+
+// syncStocks recorre las páginas de la fuente guardando cada una en cuanto llega
+// y persistiendo el cursor de la siguiente página. Con resume=true continúa
+// desde el último checkpoint de una ejecución interrumpida.
+//
+// Las páginas se escriben con el pool de escritores mientras se piden las
+// siguientes; el checkpoint avanza en orden y solo sobre páginas confirmadas.
+// Si ctx se cancela no se piden más páginas, pero las ya leídas se terminan
+// de guardar para que el checkpoint quede lo más adelante posible.
+func syncStocks(ctx context.Context, source configuredSource, resume bool) (err error) {
+	run, err := startSyncRun("sync", source.Name())
+	if err != nil {
+		return err
+	}
+	defer func() { finishSyncRun(run, err) }()
+	logger := slog.With("run_id", run.ID, "source", source.Name())
+
+	report := store.NewQualityReport(run.ID, source.Name())
+	defer saveQualityReport(report)
+
+	startPage := ""
+	pagesCommitted := 0
+
+	if resume {
+		state, err := loadSyncState(source.Name())
 		if err != nil {
-			fmt.Printf("Error procesando lote %d: %v\n", (i/batchSize)+1, err)
-			failedCount += len(batch)
-		} else {
-			successCount += len(batch)
+			return err
 		}
-		
-		// Pequeña pausa entre lotes para evitar sobrecargar la BD
-		if end < len(stocks) {
-			time.Sleep(100 * time.Millisecond)
-			
-			// Verificar conexión periódicamente entre lotes
-			if (i/batchSize)%5 == 0 {
-				// Clean up resources periodically
-				cleanupResources()
-				
-				if err := checkDBConnection(); err != nil {
-					fmt.Printf("Warning: Error checking connection between batches: %v\n", err)
-				}
-			}
+		switch {
+		case state == nil:
+			logger.Info("No hay checkpoint previo, comenzando desde la primera página")
+		case state.Completed:
+			logger.Info("La última sincronización terminó completa, comenzando desde la primera página")
+		default:
+			startPage = state.NextPage
+			pagesCommitted = state.PagesCommitted
+			logger.Info("Reanudando sincronización", "page", pagesCommitted, "next_page", startPage)
 		}
 	}
-	
-	fmt.Printf("Proceso completado: %d stocks guardados exitosamente, %d fallidos\n", 
-		successCount, failedCount)
-	
-	if failedCount > 0 {
-		return fmt.Errorf("hubo errores al guardar %d stocks", failedCount)
+
+	if startPage == "" {
+		pagesCommitted = 0
+		if err := saveCheckpoint(source.Name(), "", 0, false); err != nil {
+			return err
+		}
 	}
-	
-	fmt.Println("Database transaction completed successfully")
-	return nil
-}
 
-func fetchAllStocks() ([]Stock, error) {
-	var allStocks []Stock
-	nextPage := ""
-	
-	for {
-		stocks, newNextPage, err := fetchStocks(nextPage)
+	// El registro de la ejecución solo se toca desde onPage hasta que Close termina
+	writer := newPageWriter(ctx, run.ID, writeOptions, func(meta any, result saveResult, writeErr error) error {
+		pages := meta.([]syncPage)
+		run.PagesFetched += len(pages)
+		for _, page := range pages {
+			run.RowsFailed += page.Rejected
+		}
+		recordSave(run, result)
+		if writeErr != nil {
+			// Una página anterior falló: el checkpoint queda en la última confirmada
+			return nil
+		}
+
+		last := pages[len(pages)-1]
+		pagesCommitted += len(pages)
+		if err := saveCheckpoint(source.Name(), last.NextPage, pagesCommitted, last.NextPage == ""); err != nil {
+			return err
+		}
+		logger.Info("Página confirmada", "page", pagesCommitted, "next_page", last.NextPage)
+		return nil
+	})
+
+	// Una sincronización completa ve todas las claves de la fuente; las que
+	// faltan al terminar desaparecieron
+	fullSync := startPage == ""
+	seen := make(map[store.StockKey]bool)
+
+	// En una sincronización completa se juntan páginas hasta el umbral de COPY
+	// para cargarlas de una vez; al reanudar se guarda página por página
+	bufferPages := fullSync && writeOptions.CopyThreshold > 0
+	var pending []domain.Stock
+	var pendingPages []syncPage
+	flush := func() error {
+		if len(pendingPages) == 0 {
+			return nil
+		}
+		stocks, pages := pending, pendingPages
+		pending, pendingPages = nil, nil
+		return writer.SubmitPage(stocks, pages)
+	}
+
+	cursor := startPage
+	fetched := pagesCommitted
+	fetchErr := fetchAllStocks(ctx, source, startPage, func(page []domain.RawStock, nextPage string) error {
+		provenance := source.Provenance(cursor)
+		cursor = nextPage
+		fetched++
+
+		stocks, rejected := validateStocks(logger.With("page", fetched), report, page)
+		setProvenance(stocks, provenance)
+		resolveBrokerages(stocks)
+		if fullSync {
+			markSeen(seen, page)
+		}
+		pending = append(pending, stocks...)
+		pendingPages = append(pendingPages, syncPage{NextPage: nextPage, Rejected: len(rejected)})
+		if bufferPages && len(pending) < writeOptions.CopyThreshold && nextPage != "" {
+			return nil
+		}
+		return flush()
+	})
+	interrupted := errors.Is(fetchErr, context.Canceled)
+	if fetchErr == nil || interrupted {
+		if err := flush(); err != nil && fetchErr == nil {
+			fetchErr = err
+		}
+	}
+	writeErr := writer.Close()
+	if interrupted && writeErr == nil {
+		logger.Warn("Sincronización interrumpida; reanudar con -resume", "page", pagesCommitted, "next_page", cursor)
+	}
+	if fetchErr != nil {
+		return fetchErr
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+
+	if fullSync && len(seen) > 0 {
+		disappeared, err := store.MarkDisappeared(context.Background(), db, run.ID, source.Name(), seen)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		allStocks = append(allStocks, stocks...)
-		
-		if newNextPage == "" {
+		logger.Info("Registros que ya no están en la fuente marcados como desaparecidos", "count", disappeared)
+	}
+	return nil
+}
+
+// syncSources sincroniza las fuentes una tras otra, de mayor a menor
+// prioridad. El error de una fuente no impide sincronizar las demás; se
+// devuelven todos juntos. Si ctx se cancela no se empiezan más fuentes.
+func syncSources(ctx context.Context, sources []configuredSource, resume bool) error {
+	var errs []error
+	for _, source := range sources {
+		if ctx.Err() != nil {
+			// Las fuentes que faltan se sincronizan en la próxima ejecución
+			errs = append(errs, fmt.Errorf("fuente %s: %w", source.Name(), interruption(ctx)))
 			break
 		}
-		
-		nextPage = newNextPage
-		time.Sleep(500 * time.Millisecond) // Espera para no saturar la API
+		slog.Info("Sincronizando fuente", "source", source.Name(), "priority", source.Priority)
+		if err := syncStocks(ctx, source, resume); err != nil {
+			slog.Error("Error sincronizando la fuente", "source", source.Name(), logging.Err(err))
+			errs = append(errs, fmt.Errorf("fuente %s: %w", source.Name(), err))
+		}
 	}
+	return errors.Join(errs...)
+}
 
-	return allStocks, nil
+// rejectedStock es un registro que la validación descartó, con sus problemas
+type rejectedStock struct {
+	Raw    domain.RawStock
+	Issues []domain.Issue
 }
 
-func retryWithBackoff(attempts int, fn func() error) error {
-	var err error
-	for i := 0; i < attempts; i++ {
-		if err = fn(); err == nil {
-			return nil
+// validateStocks valida y normaliza los registros de una página con el
+// vocabulario y los suma al reporte de calidad (si no es nil); devuelve los
+// aceptados y los descartados
+func validateStocks(logger *slog.Logger, report *store.QualityReport, page []domain.RawStock) ([]domain.Stock, []rejectedStock) {
+	stocks := make([]domain.Stock, 0, len(page))
+	var rejected []rejectedStock
+	for _, raw := range page {
+		stock, issues := vocabulary.Validate(raw)
+		if report != nil {
+			report.Record(raw, issues)
+		}
+		if domain.Rejected(issues) {
+			logger.Warn("Registro descartado", "ticker", raw.Ticker, "time", raw.Time, "issues", issues)
+			rejected = append(rejected, rejectedStock{Raw: raw, Issues: issues})
+			continue
+		}
+		stocks = append(stocks, stock)
+	}
+	return stocks, rejected
+}
+
+// fetchAllStocks pide las páginas desde nextPage y entrega cada una a
+// handlePage antes de pedir la siguiente. Si ctx se cancela deja de pedir
+// páginas; la que se está procesando termina antes.
+func fetchAllStocks(ctx context.Context, source StockSource, nextPage string, handlePage func(stocks []domain.RawStock, nextPage string) error) error {
+	// La duración total incluye el procesamiento de cada página en handlePage
+	start := time.Now()
+	defer func() { fetchDuration.Set(time.Since(start).Seconds(), source.Name()) }()
+
+	for {
+		if ctx.Err() != nil {
+			return fmt.Errorf("lectura detenida antes de la página %q: %w", nextPage, interruption(ctx))
+		}
+
+		pageStart := time.Now()
+		stocks, newNextPage, err := source.FetchPage(ctx, nextPage)
+		pageFetchDuration.ObserveSince(pageStart, source.Name())
+		if err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("lectura detenida en la página %q: %w", nextPage, interruption(ctx))
+			}
+			return err
+		}
+		pagesFetched.Inc(source.Name())
+		itemsFetched.Add(float64(len(stocks)), source.Name())
+
+		if err := handlePage(stocks, newNextPage); err != nil {
+			return err
 		}
-		if i == attempts-1 {
+
+		if newNextPage == "" {
 			break
 		}
-		// Espera exponencial: 1s, 2s, 4s, 8s, etc.
-		waitTime := time.Duration(math.Pow(2, float64(i))) * time.Second
-		fmt.Printf("Intento %d falló, reintentando en %v...\n", i+1, waitTime)
-		time.Sleep(waitTime)
+
+		// El ritmo de los requests lo controla el limitador de HTTPSource
+		nextPage = newNextPage
 	}
-	return err
+
+	return nil
 }
 
 // Helper functions
-func contains(s string, substr string) bool {
-	if s == "" {
-		return false
+func envOrDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
 	}
-	return strings.Contains(s, substr)
+	return fallback
 }
 
-func min(a, b int) int {
-	if a < b {
-		return a
+// envInt lee un entero de una variable de entorno o devuelve fallback
+func envInt(key string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
 	}
-	return b
+	return fallback
 }
 
-// ParsePriceString convierte un string de precio (ej. "$135.00") a float64
-func ParsePriceString(price string) (float64, error) {
-	// Si el precio está vacío o es nulo, retorna 0
-	if price == "" || price == "null" || price == "N/A" {
-		return 0, nil
+// envFloat lee un número de una variable de entorno o devuelve fallback
+func envFloat(key string, fallback float64) float64 {
+	if value, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return value
 	}
-	
-	// Eliminar el símbolo de dólar, espacios, y comas
-	price = strings.TrimSpace(price)
-	price = strings.ReplaceAll(price, "$", "")
-	price = strings.ReplaceAll(price, ",", "")
-	
-	// Convertir a float64
-	return strconv.ParseFloat(price, 64)
+	return fallback
 }
 
-// FormatPriceFloat formatea un float64 como un string de precio (ej. "$135.00")
-func FormatPriceFloat(price float64) string {
-	if price == 0 {
-		return ""
+func min(a, b int) int {
+	if a < b {
+		return a
 	}
-	return fmt.Sprintf("$%.2f", price)
+	return b
 }
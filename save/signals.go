@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// exitInterrupted es el código de salida cuando una señal detuvo el proceso
+// (128 + SIGINT, como en los shells); distingue una interrupción de un fallo
+const exitInterrupted = 130
+
+// errInterrupted es la causa con la que signalContext cancela el contexto
+var errInterrupted = errors.New("interrumpido por una señal")
+
+// signalContext devuelve un contexto que se cancela con SIGINT o SIGTERM.
+// Tras la primera señal se restaura el comportamiento por defecto, así que
+// una segunda señal termina el proceso sin esperar. stop deja de escuchar.
+func signalContext() (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-signals:
+			signal.Stop(signals)
+			slog.Warn("Señal recibida: se terminan los lotes en curso y se guarda el checkpoint; otra señal fuerza la salida",
+				"signal", sig.String())
+			cancel(fmt.Errorf("%w (%s)", errInterrupted, sig))
+		case <-done:
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		close(done)
+		cancel(nil)
+	}
+}
+
+// interruption devuelve el error de una operación detenida porque ctx se
+// canceló. Envuelve context.Canceled para que store.FinishSyncRun registre
+// la ejecución como interrumpida.
+func interruption(ctx context.Context) error {
+	err, cause := ctx.Err(), context.Cause(ctx)
+	if cause == nil || cause == err {
+		return err
+	}
+	return fmt.Errorf("%w: %w", cause, err)
+}
+
+// exitCode es el código de salida para err: exitInterrupted si una señal
+// canceló la operación, exitDrift si verify encontró diferencias y 1 para
+// cualquier otro error
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case errors.Is(err, errDrift):
+		return exitDrift
+	}
+	return 1
+}
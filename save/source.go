@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/JuanVel1/stock-api/domain"
+	"github.com/JuanVel1/stock-api/logging"
+)
+
+// defaultSourceURL es el endpoint de la API de recomendaciones usado por defecto
+const defaultSourceURL = "https://8j5baasof2.execute-api.us-west-2.amazonaws.com/production/swechallenge/list"
+
+// StockSource es una fuente paginada de recomendaciones de acciones
+type StockSource interface {
+	// Name identifica la fuente; se usa como clave del checkpoint en sync_state
+	Name() string
+	// FetchPage devuelve los stocks de la página indicada por cursor ("" es la
+	// primera) y el cursor de la siguiente página ("" cuando no hay más). Si
+	// ctx se cancela deja de esperar y devuelve su error.
+	FetchPage(ctx context.Context, cursor string) ([]domain.RawStock, string, error)
+}
+
+// HTTPSource lee las páginas desde la API HTTP de recomendaciones
+type HTTPSource struct {
+	BaseURL    string
+	AuthHeader string
+	APIKey     string
+	// MaxAttempts es la cantidad de intentos por página ante errores transitorios
+	MaxAttempts int
+	// MaxRetryAfter acota la espera pedida por la API con Retry-After
+	MaxRetryAfter time.Duration
+
+	client      *http.Client
+	limiter     *tokenBucket
+	backoffBase time.Duration
+	sleep       func(context.Context, time.Duration) error
+}
+
+// NewHTTPSource crea una fuente HTTP; authHeader vacío usa "Authorization"
+func NewHTTPSource(baseURL, authHeader, apiKey string) *HTTPSource {
+	if baseURL == "" {
+		baseURL = defaultSourceURL
+	}
+	if authHeader == "" {
+		authHeader = "Authorization"
+	}
+	return &HTTPSource{
+		BaseURL:       baseURL,
+		AuthHeader:    authHeader,
+		APIKey:        apiKey,
+		MaxAttempts:   5,
+		MaxRetryAfter: 2 * time.Minute,
+		client:        &http.Client{Timeout: 10 * time.Second},
+		backoffBase:   500 * time.Millisecond,
+		sleep:         sleepContext,
+	}
+}
+
+// SetRateLimit limita los requests a rate por segundo con ráfagas de burst;
+// rate <= 0 quita el límite
+func (s *HTTPSource) SetRateLimit(rate float64, burst int) {
+	s.limiter = newTokenBucket(rate, burst)
+}
+
+// Name usa "swechallenge" para la API por defecto para conservar los checkpoints existentes
+func (s *HTTPSource) Name() string {
+	if s.BaseURL == defaultSourceURL {
+		return "swechallenge"
+	}
+	return "http:" + s.BaseURL
+}
+
+// pageURL agrega el cursor next_page a la URL base
+func (s *HTTPSource) pageURL(cursor string) (string, error) {
+	u, err := url.Parse(s.BaseURL)
+	if err != nil {
+		return "", fmt.Errorf("URL de fuente inválida %q: %v", s.BaseURL, err)
+	}
+	if cursor != "" {
+		query := u.Query()
+		query.Set("next_page", cursor)
+		u.RawQuery = query.Encode()
+	}
+	return u.String(), nil
+}
+
+// PageRef es la URL de la página, sin la clave
+func (s *HTTPSource) PageRef(cursor string) string {
+	pageURL, err := s.pageURL(cursor)
+	if err != nil {
+		return cursor
+	}
+	return pageURL
+}
+
+// FetchPage pide la página respetando el límite de tasa. Reintenta los
+// errores de red, 408, 429 y 5xx (esperando lo que indique Retry-After); los
+// demás 4xx fallan de inmediato y 401/403 devuelven errAuthRejected. Las
+// esperas y el request se cortan si se cancela ctx.
+func (s *HTTPSource) FetchPage(ctx context.Context, cursor string) ([]domain.RawStock, string, error) {
+	if s.APIKey == "" {
+		return nil, "", fmt.Errorf("DB_API_KEY environment variable is missing or empty")
+	}
+	pageURL, err := s.pageURL(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	logger := slog.With("source", s.Name(), "cursor", cursor)
+	var lastErr error
+	for attempt := 1; attempt <= s.MaxAttempts; attempt++ {
+		if err := s.limiter.Wait(ctx); err != nil {
+			return nil, "", err
+		}
+
+		response, err := s.doRequest(ctx, logger.With("attempt", attempt), pageURL)
+		if err == nil {
+			return response.Items, response.NextPage, nil
+		}
+		if ctx.Err() != nil {
+			return nil, "", ctx.Err()
+		}
+		lastErr = err
+
+		var statusErr *httpStatusError
+		isStatus := errors.As(err, &statusErr)
+		if isStatus && !statusErr.Temporary() {
+			if errors.Is(err, errAuthRejected) {
+				return nil, "", fmt.Errorf("%w (%v)", errAuthRejected, err)
+			}
+			return nil, "", fmt.Errorf("error permanente pidiendo %s: %w", pageURL, err)
+		}
+		if attempt == s.MaxAttempts {
+			break
+		}
+
+		reason := "network"
+		if isStatus {
+			reason = "http_" + strconv.Itoa(statusErr.StatusCode)
+		}
+		retriesTotal.Inc("fetch", reason)
+
+		wait := fetchBackoff(s.backoffBase, attempt-1)
+		if isStatus && statusErr.RetryAfter > 0 {
+			wait = capDuration(statusErr.RetryAfter, s.MaxRetryAfter)
+			logger.Info("La API pidió esperar", "retry_after", statusErr.RetryAfter, "status", statusErr.StatusCode)
+		}
+		logger.Warn("Falló el pedido de la página, se reintenta", "attempt", attempt,
+			"max_attempts", s.MaxAttempts, "backoff", wait, logging.Err(err))
+		if err := s.sleep(ctx, wait); err != nil {
+			return nil, "", err
+		}
+	}
+	return nil, "", fmt.Errorf("error pidiendo %s después de %d intentos: %w", pageURL, s.MaxAttempts, lastErr)
+}
+
+// doRequest hace un único GET y decodifica la respuesta
+func (s *HTTPSource) doRequest(ctx context.Context, logger *slog.Logger, pageURL string) (domain.APIResponse, error) {
+	var apiResponse domain.APIResponse
+	logger.Debug("Pidiendo página", "url", pageURL)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
+	if err != nil {
+		return apiResponse, fmt.Errorf("error creando request: %v", err)
+	}
+
+	// Use the API key as-is since it already includes "Bearer " prefix in the .env file
+	req.Header.Add(s.AuthHeader, s.APIKey)
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return apiResponse, fmt.Errorf("error haciendo request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return apiResponse, fmt.Errorf("error leyendo response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return apiResponse, newHTTPStatusError(resp, responseBody)
+	}
+
+	if err := json.Unmarshal(responseBody, &apiResponse); err != nil {
+		logger.Debug("Respuesta inválida", "body", string(responseBody))
+		return apiResponse, fmt.Errorf("error unmarshaling JSON: %v", err)
+	}
+	logger.Debug("Página recibida", "bytes", len(responseBody), "items", len(apiResponse.Items))
+	return apiResponse, nil
+}
+
+// capDuration acota d a max; max <= 0 no acota
+func capDuration(d, max time.Duration) time.Duration {
+	if max > 0 && d > max {
+		return max
+	}
+	return d
+}
+
+// FileSource lee stocks desde un archivo local JSON, JSONL o CSV y los entrega
+// en páginas de PageSize registros; el cursor es el offset de la página
+type FileSource struct {
+	Path     string
+	Format   string
+	PageSize int
+	stocks   []domain.RawStock
+	loaded   bool
+}
+
+// NewFileSource crea una fuente de archivo; format vacío se deduce de la extensión
+func NewFileSource(path, format string, pageSize int) *FileSource {
+	return &FileSource{Path: path, Format: format, PageSize: pageSize}
+}
+
+// Name identifica la fuente por el nombre del archivo
+func (s *FileSource) Name() string {
+	return "file:" + filepath.Base(s.Path)
+}
+
+// PageRef es el archivo con el offset de la página
+func (s *FileSource) PageRef(cursor string) string {
+	if cursor == "" {
+		cursor = "0"
+	}
+	return s.Path + "#offset=" + cursor
+}
+
+// FetchPage lee el archivo la primera vez y devuelve la página pedida
+func (s *FileSource) FetchPage(ctx context.Context, cursor string) ([]domain.RawStock, string, error) {
+	if !s.loaded {
+		stocks, err := readStocksFile(s.Path, s.Format)
+		if err != nil {
+			return nil, "", err
+		}
+		s.stocks = stocks
+		s.loaded = true
+		slog.Info("Archivo de la fuente leído", "source", s.Name(), "count", len(stocks))
+	}
+	return pageSlice(s.stocks, cursor, s.PageSize)
+}
+
+// FixtureSource entrega un conjunto fijo de stocks en memoria
+type FixtureSource struct {
+	Stocks   []domain.RawStock
+	PageSize int
+}
+
+// NewFixtureSource crea una fuente en memoria; sin stocks usa fixtureStocks
+func NewFixtureSource(stocks []domain.RawStock, pageSize int) *FixtureSource {
+	if stocks == nil {
+		stocks = fixtureStocks
+	}
+	return &FixtureSource{Stocks: stocks, PageSize: pageSize}
+}
+
+// Name identifica la fuente en memoria
+func (s *FixtureSource) Name() string {
+	return "fixture"
+}
+
+// FetchPage devuelve la página pedida del conjunto fijo
+func (s *FixtureSource) FetchPage(ctx context.Context, cursor string) ([]domain.RawStock, string, error) {
+	return pageSlice(s.Stocks, cursor, s.PageSize)
+}
+
+// pageSlice pagina un slice en memoria usando el offset como cursor
+func pageSlice(stocks []domain.RawStock, cursor string, pageSize int) ([]domain.RawStock, string, error) {
+	if pageSize <= 0 {
+		pageSize = 10
+	}
+
+	offset := 0
+	if cursor != "" {
+		n, err := strconv.Atoi(cursor)
+		if err != nil || n < 0 {
+			return nil, "", fmt.Errorf("cursor inválido: %q", cursor)
+		}
+		offset = n
+	}
+	if offset >= len(stocks) {
+		return nil, "", nil
+	}
+
+	end := min(offset+pageSize, len(stocks))
+	next := ""
+	if end < len(stocks) {
+		next = strconv.Itoa(end)
+	}
+	return stocks[offset:end], next, nil
+}
+
+// fixtureStocks son datos de ejemplo para ejecutar el proceso sin red
+var fixtureStocks = []domain.RawStock{
+	{Ticker: "AAPL", Company: "Apple Inc.", Brokerage: "Morgan Stanley", Action: "upgraded by", RatingFrom: "Neutral", RatingTo: "Buy", TargetFrom: "$150.00", TargetTo: "$180.00", Time: "2025-01-13T00:30:05.813548892Z"},
+	{Ticker: "MSFT", Company: "Microsoft Corporation", Brokerage: "The Goldman Sachs Group", Action: "target raised by", RatingFrom: "Buy", RatingTo: "Buy", TargetFrom: "$420.00", TargetTo: "$450.00", Time: "2025-01-14T00:30:05.813548892Z"},
+	{Ticker: "NVDA", Company: "NVIDIA Corporation", Brokerage: "JPMorgan Chase & Co.", Action: "reiterated by", RatingFrom: "Outperform", RatingTo: "Outperform", TargetFrom: "$140.00", TargetTo: "$140.00", Time: "2025-01-15T00:30:05.813548892Z"},
+	{Ticker: "TSLA", Company: "Tesla, Inc.", Brokerage: "Wedbush", Action: "downgraded by", RatingFrom: "Buy", RatingTo: "Neutral", TargetFrom: "$400.00", TargetTo: "$350.00", Time: "2025-01-16T00:30:05.813548892Z"},
+	{Ticker: "AMZN", Company: "Amazon.com, Inc.", Brokerage: "Citigroup", Action: "initiated by", RatingFrom: "", RatingTo: "Buy", TargetFrom: "", TargetTo: "$250.00", Time: "2025-01-17T00:30:05.813548892Z"},
+}
+
+// sourceConfig son las opciones para crear una fuente: las de línea de
+// comandos o una entrada del archivo -sources
+type sourceConfig struct {
+	// ID identifica la fuente en el checkpoint y en el origen de cada registro;
+	// vacío usa el nombre de la fuente (ver StockSource.Name)
+	ID         string `json:"id"`
+	Kind       string `json:"kind"`
+	URL        string `json:"url"`
+	AuthHeader string `json:"auth_header"`
+	// APIKeyEnv es la variable de entorno con la clave de la fuente http;
+	// vacía usa DB_API_KEY
+	APIKeyEnv string `json:"api_key_env"`
+	File      string `json:"file"`
+	Format    string `json:"format"`
+	PageSize  int    `json:"page_size"`
+	// RateLimit son los requests por segundo a la fuente http (0 sin límite)
+	RateLimit float64 `json:"rate_limit"`
+	RateBurst int     `json:"rate_burst"`
+	// Priority resuelve los conflictos entre fuentes: un registro de otra
+	// fuente solo se reemplaza con prioridad igual o mayor
+	Priority int `json:"priority"`
+}
+
+// newStockSource crea la fuente indicada por cfg.Kind (http, file o fixture)
+func newStockSource(cfg sourceConfig) (StockSource, error) {
+	switch cfg.Kind {
+	case "", "http":
+		keyEnv := cfg.APIKeyEnv
+		if keyEnv == "" {
+			keyEnv = "DB_API_KEY"
+		}
+		apiKey := os.Getenv(keyEnv)
+		if apiKey == "" {
+			return nil, fmt.Errorf("%s environment variable is missing or empty", keyEnv)
+		}
+		source := NewHTTPSource(cfg.URL, cfg.AuthHeader, apiKey)
+		source.SetRateLimit(cfg.RateLimit, cfg.RateBurst)
+		return source, nil
+	case "file":
+		if cfg.File == "" {
+			return nil, fmt.Errorf("la fuente file requiere -source-file")
+		}
+		return NewFileSource(cfg.File, cfg.Format, cfg.PageSize), nil
+	case "fixture":
+		return NewFixtureSource(nil, cfg.PageSize), nil
+	}
+	return nil, fmt.Errorf("fuente desconocida: %s (use http, file o fixture)", cfg.Kind)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JuanVel1/stock-api/domain"
+)
+
+// collectPages recorre todas las páginas de una fuente
+func collectPages(t *testing.T, source StockSource) [][]domain.RawStock {
+	var pages [][]domain.RawStock
+	err := fetchAllStocks(context.Background(), source, "", func(stocks []domain.RawStock, nextPage string) error {
+		pages = append(pages, stocks)
+		return nil
+	})
+	require.NoError(t, err)
+	return pages
+}
+
+// TestFixtureSourcePaging verifica la paginación de la fuente en memoria
+func TestFixtureSourcePaging(t *testing.T) {
+	source := NewFixtureSource(nil, 2)
+	pages := collectPages(t, source)
+
+	require.Len(t, pages, 3)
+	assert.Len(t, pages[0], 2)
+	assert.Len(t, pages[2], 1)
+	assert.Equal(t, "AAPL", pages[0][0].Ticker)
+	assert.Equal(t, "fixture", source.Name())
+}
+
+// TestFetchAllStocksInterrupted verifica que al cancelar el contexto la
+// página en curso termine y no se pida la siguiente
+func TestFetchAllStocksInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	var cursors []string
+	err := fetchAllStocks(ctx, NewFixtureSource(nil, 2), "", func(stocks []domain.RawStock, nextPage string) error {
+		cursors = append(cursors, nextPage)
+		cancel(errInterrupted)
+		return nil
+	})
+
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, err, errInterrupted)
+	assert.Equal(t, []string{"2"}, cursors)
+	assert.Equal(t, exitInterrupted, exitCode(err))
+	assert.Equal(t, 1, exitCode(errors.New("otro error")))
+}
+
+// TestPageSliceInvalidCursor verifica que un cursor no numérico falle
+func TestPageSliceInvalidCursor(t *testing.T) {
+	_, _, err := pageSlice(fixtureStocks, "abc", 2)
+	assert.Error(t, err)
+}
+
+// TestFileSourceFormats verifica la lectura de archivos JSON, JSONL y CSV
+func TestFileSourceFormats(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"stocks.json": `{"items": [{"ticker": "AAPL", "target_to": "$180.00", "time": "2025-01-13T00:30:05Z"}], "next_page": ""}`,
+		"array.json":  `[{"ticker": "AAPL", "target_to": "$180.00", "time": "2025-01-13T00:30:05Z"}]`,
+		"stocks.jsonl": `{"ticker": "AAPL", "target_to": "$180.00", "time": "2025-01-13T00:30:05Z"}
+
+`,
+		"stocks.csv": "ticker,company,target_to,time\nAAPL,Apple Inc.,$180.00,2025-01-13T00:30:05Z\n",
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+
+			pages := collectPages(t, NewFileSource(path, "", 10))
+			require.Len(t, pages, 1)
+			require.Len(t, pages[0], 1)
+			assert.Equal(t, "AAPL", pages[0][0].Ticker)
+			assert.Equal(t, "$180.00", pages[0][0].TargetTo)
+			assert.Equal(t, "2025-01-13T00:30:05Z", pages[0][0].Time)
+		})
+	}
+}
+
+// TestHTTPSourceHeadersAndCursor verifica el header de autenticación y el cursor
+func TestHTTPSourceHeadersAndCursor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secreto", r.Header.Get("X-Api-Key"))
+		if r.URL.Query().Get("next_page") == "" {
+			w.Write([]byte(`{"items": [{"ticker": "AAPL"}], "next_page": "AAPL"}`))
+			return
+		}
+		assert.Equal(t, "AAPL", r.URL.Query().Get("next_page"))
+		w.Write([]byte(`{"items": [{"ticker": "MSFT"}], "next_page": ""}`))
+	}))
+	defer server.Close()
+
+	source := NewHTTPSource(server.URL, "X-Api-Key", "secreto")
+	stocks, next, err := source.FetchPage(context.Background(), "")
+	require.NoError(t, err)
+	assert.Equal(t, "AAPL", next)
+	require.Len(t, stocks, 1)
+
+	stocks, next, err = source.FetchPage(context.Background(), next)
+	require.NoError(t, err)
+	assert.Empty(t, next)
+	assert.Equal(t, "MSFT", stocks[0].Ticker)
+}
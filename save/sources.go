@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/JuanVel1/stock-api/domain"
+)
+
+// configuredSource es una fuente con el id y la prioridad de su configuración
+type configuredSource struct {
+	StockSource
+	ID       string
+	Priority int
+}
+
+// Name devuelve el id configurado o, si no hay, el nombre de la fuente
+func (s configuredSource) Name() string {
+	if s.ID != "" {
+		return s.ID
+	}
+	return s.StockSource.Name()
+}
+
+// PageRef describe la página del cursor; las fuentes que no saben
+// describirla usan el cursor tal cual
+func (s configuredSource) PageRef(cursor string) string {
+	if ref, ok := s.StockSource.(interface{ PageRef(string) string }); ok {
+		return ref.PageRef(cursor)
+	}
+	return cursor
+}
+
+// Provenance es el origen de los registros de la página del cursor, leídos ahora
+func (s configuredSource) Provenance(cursor string) domain.Provenance {
+	fetchedAt := time.Now().UTC()
+	return domain.Provenance{
+		SourceID:       s.Name(),
+		SourcePriority: s.Priority,
+		FetchedAt:      &fetchedAt,
+		PageRef:        s.PageRef(cursor),
+	}
+}
+
+// loadSourceConfigs devuelve la configuración de las fuentes: la de línea de
+// comandos (base) o, si path no está vacío, la lista del archivo JSON. Cada
+// entrada del archivo parte de base, así que solo necesita lo que cambia.
+func loadSourceConfigs(base sourceConfig, path string) ([]sourceConfig, error) {
+	if path == "" {
+		return []sourceConfig{base}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo %s: %w", path, err)
+	}
+	var entries []json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("error interpretando %s: %w", path, err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s no define ninguna fuente", path)
+	}
+
+	base.ID, base.File, base.Priority = "", "", 0
+	configs := make([]sourceConfig, len(entries))
+	for i, entry := range entries {
+		configs[i] = base
+		if err := json.Unmarshal(entry, &configs[i]); err != nil {
+			return nil, fmt.Errorf("fuente %d de %s: %w", i+1, path, err)
+		}
+	}
+	return configs, nil
+}
+
+// newConfiguredSources crea las fuentes, ordenadas de mayor a menor
+// prioridad; falla si dos fuentes terminan con el mismo id
+func newConfiguredSources(configs []sourceConfig) ([]configuredSource, error) {
+	sources := make([]configuredSource, 0, len(configs))
+	ids := make(map[string]bool, len(configs))
+	for _, cfg := range configs {
+		stockSource, err := newStockSource(cfg)
+		if err != nil {
+			return nil, err
+		}
+		source := configuredSource{StockSource: stockSource, ID: cfg.ID, Priority: cfg.Priority}
+		if ids[source.Name()] {
+			return nil, fmt.Errorf("fuente repetida: %s", source.Name())
+		}
+		ids[source.Name()] = true
+		sources = append(sources, source)
+	}
+
+	sort.SliceStable(sources, func(i, j int) bool {
+		return sources[i].Priority > sources[j].Priority
+	})
+	return sources, nil
+}
+
+// setProvenance asigna el mismo origen a todos los registros
+func setProvenance(stocks []domain.Stock, provenance domain.Provenance) {
+	for i := range stocks {
+		stocks[i].Provenance = provenance
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLoadSourceConfigs verifica que las entradas del archivo partan de la
+// configuración de línea de comandos
+func TestLoadSourceConfigs(t *testing.T) {
+	base := sourceConfig{Kind: "http", PageSize: 100, RateLimit: 2, RateBurst: 1}
+
+	configs, err := loadSourceConfigs(base, "")
+	require.NoError(t, err)
+	assert.Equal(t, []sourceConfig{base}, configs)
+
+	path := filepath.Join(t.TempDir(), "sources.json")
+	content := `[
+		{"id": "primary", "url": "https://example.com/list", "priority": 10},
+		{"id": "backup", "kind": "file", "file": "backup.jsonl", "page_size": 50}
+	]`
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+
+	configs, err = loadSourceConfigs(base, path)
+	require.NoError(t, err)
+	require.Len(t, configs, 2)
+	assert.Equal(t, "http", configs[0].Kind)
+	assert.Equal(t, 10, configs[0].Priority)
+	assert.Equal(t, 2.0, configs[0].RateLimit)
+	assert.Equal(t, "file", configs[1].Kind)
+	assert.Equal(t, 50, configs[1].PageSize)
+	assert.Equal(t, 0, configs[1].Priority)
+}
+
+// TestConfiguredSources verifica el orden por prioridad, los ids repetidos y
+// el origen de cada página
+func TestConfiguredSources(t *testing.T) {
+	sources, err := newConfiguredSources([]sourceConfig{
+		{Kind: "fixture", ID: "low", Priority: 1},
+		{Kind: "fixture", ID: "high", Priority: 5},
+		{Kind: "fixture"},
+	})
+	require.NoError(t, err)
+	require.Len(t, sources, 3)
+	assert.Equal(t, "high", sources[0].Name())
+	assert.Equal(t, "low", sources[1].Name())
+	assert.Equal(t, "fixture", sources[2].Name())
+
+	provenance := sources[0].Provenance("10")
+	assert.Equal(t, "high", provenance.SourceID)
+	assert.Equal(t, 5, provenance.SourcePriority)
+	assert.Equal(t, "10", provenance.PageRef)
+	assert.NotNil(t, provenance.FetchedAt)
+
+	file := configuredSource{StockSource: NewFileSource("data/stocks.csv", "", 10)}
+	assert.Equal(t, "data/stocks.csv#offset=0", file.PageRef(""))
+
+	_, err = newConfiguredSources([]sourceConfig{{Kind: "fixture"}, {Kind: "fixture"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/JuanVel1/stock-api/migrations"
+	"github.com/JuanVel1/stock-api/store"
+)
+
+// sourceStatus es lo que muestra `status` de una fuente
+type sourceStatus struct {
+	Source  string
+	State   *syncState
+	LastRun *store.SyncRun
+	Events  int
+}
+
+// runStatus implementa `status`: muestra las migraciones pendientes y, por
+// fuente, el checkpoint, la cantidad de eventos y la última ejecución. No
+// aplica migraciones ni escribe nada.
+func runStatus(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	registerDBFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := dbConfig.validate(); err != nil {
+		return err
+	}
+
+	if err := connectDB(ctx); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+	migrationStatuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+	pending := 0
+	for _, status := range migrationStatuses {
+		if !status.Applied {
+			pending++
+		}
+	}
+	if pending > 0 {
+		// Sin las últimas migraciones las consultas de abajo pueden fallar
+		printStatus(os.Stdout, pending, nil)
+		return nil
+	}
+
+	states, err := listSyncStates()
+	if err != nil {
+		return err
+	}
+	runs, err := store.LastSyncRuns(ctx, db)
+	if err != nil {
+		return fmt.Errorf("error leyendo sync_runs: %w", err)
+	}
+	counts, err := store.CountRatingEventsBySource(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	printStatus(os.Stdout, pending, mergeSourceStatuses(states, runs, counts))
+	return nil
+}
+
+// mergeSourceStatuses junta por fuente los checkpoints, las últimas
+// ejecuciones y los eventos; el resultado queda ordenado por fuente
+func mergeSourceStatuses(states []syncState, runs []store.SyncRun, counts map[string]int) []sourceStatus {
+	bySource := make(map[string]*sourceStatus)
+	get := func(source string) *sourceStatus {
+		status, ok := bySource[source]
+		if !ok {
+			status = &sourceStatus{Source: source}
+			bySource[source] = status
+		}
+		return status
+	}
+	for i := range states {
+		get(states[i].Source).State = &states[i]
+	}
+	for i := range runs {
+		get(runs[i].Source).LastRun = &runs[i]
+	}
+	for source, count := range counts {
+		get(source).Events = count
+	}
+
+	statuses := make([]sourceStatus, 0, len(bySource))
+	for _, status := range bySource {
+		statuses = append(statuses, *status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Source < statuses[j].Source })
+	return statuses
+}
+
+// printStatus escribe el estado en w
+func printStatus(w io.Writer, pending int, statuses []sourceStatus) {
+	if pending > 0 {
+		fmt.Fprintf(w, "Migraciones pendientes: %d (ejecute `save migrate up`)\n", pending)
+		return
+	}
+	fmt.Fprintln(w, "Migraciones: al día")
+	if len(statuses) == 0 {
+		fmt.Fprintln(w, "Todavía no hay sincronizaciones")
+		return
+	}
+
+	const timeFormat = "2006-01-02 15:04:05"
+	for _, s := range statuses {
+		name := s.Source
+		if name == "" {
+			name = "(sin fuente)"
+		}
+		fmt.Fprintf(w, "\n%s\n", name)
+		fmt.Fprintf(w, "  eventos:     %d\n", s.Events)
+		if s.State != nil {
+			state := "incompleta, `save sync` continúa desde next_page"
+			if s.State.Completed {
+				state = "completa"
+			}
+			fmt.Fprintf(w, "  checkpoint:  %d páginas, next_page %q, %s (%s)\n",
+				s.State.PagesCommitted, s.State.NextPage, state, s.State.UpdatedAt.Format(timeFormat))
+		}
+		if run := s.LastRun; run != nil {
+			fmt.Fprintf(w, "  ejecución:   %s %s, %s, %d páginas, %d insertados, %d actualizados, %d omitidos, %d fallidos\n",
+				run.Kind, run.Status, run.StartedAt.Format(timeFormat), run.PagesFetched,
+				run.RowsInserted, run.RowsUpdated, run.RowsSkipped, run.RowsFailed)
+			if run.Error != nil {
+				fmt.Fprintf(w, "  error:       %s\n", *run.Error)
+			}
+		}
+	}
+}
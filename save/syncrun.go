@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/JuanVel1/stock-api/logging"
+	"github.com/JuanVel1/stock-api/store"
+)
+
+// startSyncRun registra el inicio de una ejecución en sync_runs
+func startSyncRun(kind, source string) (*store.SyncRun, error) {
+	run, err := store.CreateSyncRun(context.Background(), db, kind, source)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("Ejecución iniciada", "run_id", run.ID, "kind", kind, "source", source)
+	return run, nil
+}
+
+// recordSave suma al registro de la ejecución el resultado de un saveStocks
+func recordSave(run *store.SyncRun, result saveResult) {
+	run.RowsInserted += result.Inserted
+	run.RowsUpdated += result.Updated
+	run.RowsFailed += result.Failed
+	run.Retries += result.Retries
+	run.RowsCopied += result.Copied
+	run.RowsSkipped += result.Skipped
+	if result.LastErr != nil {
+		decision := run.RecordError(result.LastErr)
+		slog.Warn("Lote fallido", "run_id", run.ID, "error_class", decision.String(), logging.Err(result.LastErr))
+	}
+}
+
+// finishSyncRun cierra la ejecución con su estado final; si no se puede
+// escribir el registro solo se informa para no ocultar runErr
+func finishSyncRun(run *store.SyncRun, runErr error) {
+	recordRunMetrics(run.Kind, run.Source, map[string]int{
+		"inserted": run.RowsInserted, "updated": run.RowsUpdated, "skipped": run.RowsSkipped,
+		"failed": run.RowsFailed, "copied": run.RowsCopied,
+	}, run.StartedAt, runErr)
+
+	logger := slog.With("run_id", run.ID)
+	if err := checkDBConnection(); err != nil {
+		logger.Warn("No se pudo cerrar la ejecución", logging.Err(err))
+		return
+	}
+	if err := store.FinishSyncRun(context.Background(), db, run, runErr); err != nil {
+		logger.Warn("No se pudo cerrar la ejecución", logging.Err(err))
+		return
+	}
+
+	// Las filas omitidas son las que otra fuente con más prioridad ya tenía
+	attrs := []any{
+		"status", run.Status, "pages", run.PagesFetched, "inserted", run.RowsInserted,
+		"updated", run.RowsUpdated, "failed", run.RowsFailed, "skipped", run.RowsSkipped,
+		"retries", run.Retries, "copied", run.RowsCopied,
+	}
+	if run.RowsPerSecond != nil {
+		attrs = append(attrs, "rows_per_second", *run.RowsPerSecond)
+	}
+	if run.ErrorClass == nil {
+		logger.Info("Ejecución terminada", attrs...)
+		return
+	}
+	attrs = append(attrs, "error_class", *run.ErrorClass)
+	if run.ErrorCode != nil {
+		attrs = append(attrs, "error_code", *run.ErrorCode)
+	}
+	logger.Error("Ejecución terminada con error", append(attrs, logging.Err(runErr))...)
+}
+
+// saveQualityReport guarda el reporte de calidad de la ejecución y muestra
+// el resumen; un fallo al guardarlo no cambia el resultado de la ejecución
+func saveQualityReport(report *store.QualityReport) {
+	logger := slog.With("run_id", report.RunID)
+	logger.Info("Calidad de datos", "checked", report.Checked, "accepted", report.Accepted,
+		"rejected", report.Rejected, "flagged", report.Flagged)
+	for _, issue := range report.Issues {
+		logger.Info("Regla de calidad", "rule", issue.Rule, "severity", issue.Severity, "count", issue.Count)
+	}
+	if err := checkDBConnection(); err != nil {
+		logger.Warn("No se pudo guardar el reporte de calidad", logging.Err(err))
+		return
+	}
+	if err := store.SaveQualityReport(context.Background(), db, report); err != nil {
+		logger.Warn("No se pudo guardar el reporte de calidad", logging.Err(err))
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/JuanVel1/stock-api/store"
+)
+
+// syncState es el checkpoint persistido de una sincronización por fuente
+type syncState struct {
+	Source         string    `db:"source"`
+	NextPage       string    `db:"next_page"`
+	PagesCommitted int       `db:"pages_committed"`
+	Completed      bool      `db:"completed"`
+	UpdatedAt      time.Time `db:"updated_at"`
+}
+
+// loadSyncState devuelve el último checkpoint de la fuente, o nil si no existe
+func loadSyncState(source string) (*syncState, error) {
+	var state syncState
+	err := db.Get(&state, `
+		SELECT source, next_page, pages_committed, completed, updated_at
+		FROM sync_state WHERE source = $1`, source)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo estado de sincronización: %v", err)
+	}
+	return &state, nil
+}
+
+// saveCheckpoint guarda el cursor de la siguiente página a pedir una vez que
+// la página actual quedó confirmada en la base de datos
+func saveCheckpoint(source, nextPage string, pagesCommitted int, completed bool) error {
+	err := store.RunInTx(context.Background(), db, func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(`
+			INSERT INTO sync_state (source, next_page, pages_committed, completed, updated_at)
+			VALUES ($1, $2, $3, $4, now())
+			ON CONFLICT (source) DO UPDATE SET
+				next_page = EXCLUDED.next_page,
+				pages_committed = EXCLUDED.pages_committed,
+				completed = EXCLUDED.completed,
+				updated_at = EXCLUDED.updated_at`,
+			source, nextPage, pagesCommitted, completed)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error guardando checkpoint de sincronización: %v", err)
+	}
+	return nil
+}
+
+// listSyncStates devuelve los checkpoints de todas las fuentes, por fuente
+func listSyncStates() ([]syncState, error) {
+	states := []syncState{}
+	err := db.Select(&states, `
+		SELECT source, next_page, pages_committed, completed, updated_at
+		FROM sync_state ORDER BY source`)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo estado de sincronización: %v", err)
+	}
+	return states, nil
+}
+
+// deleteSyncStates borra los checkpoints de las fuentes sources, o todos si
+// sources es nil; la próxima sincronización de esas fuentes empieza desde la
+// primera página
+func deleteSyncStates(sources []string) (int64, error) {
+	result, err := db.Exec(`
+		DELETE FROM sync_state WHERE $1::TEXT[] IS NULL OR source = ANY($1)`, pq.Array(sources))
+	if err != nil {
+		return 0, fmt.Errorf("error borrando estado de sincronización: %v", err)
+	}
+	return result.RowsAffected()
+}
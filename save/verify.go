@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/JuanVel1/stock-api/domain"
+	"github.com/JuanVel1/stock-api/store"
+)
+
+// exitDrift es el código de salida de `verify` cuando la base de datos no
+// coincide con la fuente; distingue la diferencia de un error (1)
+const exitDrift = 3
+
+// errDrift indica que verify encontró diferencias entre la fuente y la base de datos
+var errDrift = errors.New("la base de datos no coincide con la fuente")
+
+// verifyReport es la conciliación de una fuente con rating_events
+type verifyReport struct {
+	Source    string    `json:"source"`
+	StartedAt time.Time `json:"started_at"`
+	Pages     int       `json:"pages"`
+	// Checked son los registros leídos y Rejected los que la validación
+	// descarta, que no se esperan en la base de datos
+	Checked  int `json:"checked"`
+	Rejected int `json:"rejected"`
+	// Matched son los eventos iguales en la fuente y en la base de datos
+	Matched int `json:"matched"`
+	// Overridden son los eventos que guarda otra fuente con más prioridad
+	Overridden int `json:"overridden"`
+	// Tickers son los tickers comparados y DriftedTickers los que difieren
+	Tickers        int            `json:"tickers"`
+	DriftedTickers []tickerDrift  `json:"drifted_tickers"`
+	MissingCount   int            `json:"missing_count"`
+	ExtraCount     int            `json:"extra_count"`
+	MismatchCount  int            `json:"mismatched_count"`
+	Missing        []verifyRecord `json:"missing"`
+	Extra          []verifyRecord `json:"extra"`
+	Mismatched     []verifyRecord `json:"mismatched"`
+	Truncated      bool           `json:"truncated,omitempty"`
+	maxRecords     int
+}
+
+// tickerDrift compara la cantidad de eventos y el hash de su contenido de un
+// ticker en la fuente y en la base de datos
+type tickerDrift struct {
+	Ticker        string `json:"ticker"`
+	UpstreamCount int    `json:"upstream_count"`
+	StoredCount   int    `json:"stored_count"`
+	UpstreamHash  string `json:"upstream_hash"`
+	StoredHash    string `json:"stored_hash"`
+}
+
+// verifyRecord es un evento que falta, sobra o difiere en la base de datos
+type verifyRecord struct {
+	Ticker      string           `json:"ticker"`
+	BrokerageID string           `json:"brokerage_id"`
+	Brokerage   string           `json:"brokerage"`
+	Time        string           `json:"time"`
+	Diff        store.FieldDiffs `json:"diff,omitempty"`
+}
+
+// Drift indica si la base de datos no coincide con la fuente
+func (r *verifyReport) Drift() bool {
+	return r.MissingCount+r.ExtraCount+r.MismatchCount > 0
+}
+
+// add suma un registro a la lista; pasado maxRecords solo se cuenta
+func (r *verifyReport) add(list *[]verifyRecord, stock domain.Stock, diff store.FieldDiffs) {
+	if r.maxRecords > 0 && len(*list) >= r.maxRecords {
+		r.Truncated = true
+		return
+	}
+	*list = append(*list, verifyRecord{
+		Ticker: stock.Ticker, BrokerageID: stock.BrokerageID, Brokerage: stock.Brokerage,
+		Time: stock.Time, Diff: diff,
+	})
+}
+
+// runVerify implementa `verify [flags]`: lee todas las páginas de cada fuente
+// y concilia lo leído con rating_events. Escribe un reporte JSON con los
+// eventos que faltan, sobran o difieren y devuelve errDrift si hay alguno.
+// No aplica migraciones ni escribe en ninguna tabla.
+func runVerify(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	var sourceCfg sourceConfig
+	sourcesFile := registerSourceFlags(fs, &sourceCfg)
+	registerDBFlags(fs)
+	output := fs.String("output", "", "archivo donde escribir el reporte JSON (por defecto la salida estándar)")
+	maxRecords := fs.Int("max-records", 100, "registros que se listan por categoría (0 sin límite); los totales siempre están completos")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("argumentos inesperados: %s", strings.Join(fs.Args(), " "))
+	}
+	if err := dbConfig.validate(); err != nil {
+		return err
+	}
+
+	sourceConfigs, err := loadSourceConfigs(sourceCfg, *sourcesFile)
+	if err != nil {
+		return fmt.Errorf("configuración de fuentes inválida: %w", err)
+	}
+	sources, err := newConfiguredSources(sourceConfigs)
+	if err != nil {
+		return fmt.Errorf("configuración de fuentes inválida: %w", err)
+	}
+
+	if err := connectDB(ctx); err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := checkPendingMigrations(); err != nil {
+		return err
+	}
+	loadReferenceData()
+
+	reports := make([]*verifyReport, 0, len(sources))
+	for _, source := range sources {
+		report, err := verifySource(ctx, source, *maxRecords)
+		if err != nil {
+			return fmt.Errorf("fuente %s: %w", source.Name(), err)
+		}
+		reports = append(reports, report)
+	}
+	if err := writeVerifyReports(reports, *output); err != nil {
+		return err
+	}
+
+	for _, report := range reports {
+		if report.Drift() {
+			return errDrift
+		}
+	}
+	return nil
+}
+
+// verifySource lee las páginas de la fuente, las valida como la
+// sincronización y concilia los registros aceptados con la base de datos
+func verifySource(ctx context.Context, source configuredSource, maxRecords int) (*verifyReport, error) {
+	startedAt := time.Now().UTC()
+	quality := store.NewQualityReport("", source.Name())
+	logger := slog.With("source", source.Name())
+
+	var upstream []domain.Stock
+	pages := 0
+	cursor := ""
+	err := fetchAllStocks(ctx, source, "", func(page []domain.RawStock, nextPage string) error {
+		pages++
+		provenance := source.Provenance(cursor)
+		cursor = nextPage
+
+		stocks, _ := validateStocks(logger.With("page", pages), quality, page)
+		setProvenance(stocks, provenance)
+		// Sin registrar brókers: los desconocidos quedan sin id y faltan en la base de datos
+		brokerages.AssignIDs(stocks)
+		upstream = append(upstream, stocks...)
+		logger.Debug("Verify: página leída", "page", pages, "next_page", nextPage)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tickers := make(map[string]bool)
+	for _, stock := range upstream {
+		tickers[stock.Ticker] = true
+	}
+	tickerList := make([]string, 0, len(tickers))
+	for ticker := range tickers {
+		tickerList = append(tickerList, ticker)
+	}
+	stored, err := store.SourceStocks(ctx, db, source.Name(), tickerList)
+	if err != nil {
+		return nil, err
+	}
+
+	report := reconcile(source.Name(), upstream, stored, maxRecords)
+	report.StartedAt = startedAt
+	report.Pages = pages
+	report.Checked = quality.Checked
+	report.Rejected = quality.Rejected
+	logger.Info("Verify terminado", "pages", report.Pages, "checked", report.Checked,
+		"matched", report.Matched, "overridden", report.Overridden, "missing", report.MissingCount,
+		"extra", report.ExtraCount, "mismatched", report.MismatchCount,
+		"drifted_tickers", len(report.DriftedTickers))
+	return report, nil
+}
+
+// reconcile compara los registros leídos de la fuente source con los de la
+// base de datos (los de la fuente y los de sus tickers):
+//   - missing: están en la fuente y no en la base de datos;
+//   - mismatched: la base de datos tiene otro contenido (ver domain.DiffStocks);
+//   - extra: la fuente los escribió, no los marcó como desaparecidos y ya no
+//     los publica.
+//
+// Los eventos que guarda otra fuente con más prioridad no son diferencias.
+// Por ticker se comparan la cantidad de eventos y un hash de su contenido.
+func reconcile(source string, upstream, stored []domain.Stock, maxRecords int) *verifyReport {
+	report := &verifyReport{
+		Source: source, maxRecords: maxRecords, DriftedTickers: []tickerDrift{},
+		Missing: []verifyRecord{}, Extra: []verifyRecord{}, Mismatched: []verifyRecord{},
+	}
+
+	// Si una clave se repite en la fuente vale la última aparición, como al guardar
+	expected := make(map[store.StockKey]domain.Stock, len(upstream))
+	for _, stock := range upstream {
+		expected[store.KeyOf(stock)] = stock
+	}
+	actual := make(map[store.StockKey]domain.Stock, len(stored))
+	for _, stock := range stored {
+		actual[store.KeyOf(stock)] = stock
+	}
+
+	// Contenido comparable de cada lado, por ticker
+	upstreamByTicker := make(map[string][]domain.Stock)
+	storedByTicker := make(map[string][]domain.Stock)
+
+	for _, key := range sortedKeys(expected) {
+		stock := expected[key]
+		existing, found := actual[key]
+		if found && !stock.Overrides(existing.Provenance) {
+			report.Overridden++
+			continue
+		}
+		upstreamByTicker[key.Ticker] = append(upstreamByTicker[key.Ticker], stock)
+		if !found {
+			report.MissingCount++
+			report.add(&report.Missing, stock, nil)
+			continue
+		}
+		storedByTicker[key.Ticker] = append(storedByTicker[key.Ticker], existing)
+		if diff := domain.DiffStocks(existing, stock); diff != nil {
+			report.MismatchCount++
+			report.add(&report.Mismatched, stock, diff)
+			continue
+		}
+		report.Matched++
+	}
+
+	for _, key := range sortedKeys(actual) {
+		stock := actual[key]
+		if _, found := expected[key]; found || stock.SourceID != source || stock.DisappearedAt != nil {
+			continue
+		}
+		storedByTicker[key.Ticker] = append(storedByTicker[key.Ticker], stock)
+		report.ExtraCount++
+		report.add(&report.Extra, stock, nil)
+	}
+
+	tickers := make(map[string]bool)
+	for ticker := range upstreamByTicker {
+		tickers[ticker] = true
+	}
+	for ticker := range storedByTicker {
+		tickers[ticker] = true
+	}
+	report.Tickers = len(tickers)
+	for ticker := range tickers {
+		drift := tickerDrift{
+			Ticker:        ticker,
+			UpstreamCount: len(upstreamByTicker[ticker]),
+			StoredCount:   len(storedByTicker[ticker]),
+			UpstreamHash:  contentHash(upstreamByTicker[ticker]),
+			StoredHash:    contentHash(storedByTicker[ticker]),
+		}
+		if drift.UpstreamCount != drift.StoredCount || drift.UpstreamHash != drift.StoredHash {
+			report.DriftedTickers = append(report.DriftedTickers, drift)
+		}
+	}
+	sort.Slice(report.DriftedTickers, func(i, j int) bool {
+		return report.DriftedTickers[i].Ticker < report.DriftedTickers[j].Ticker
+	})
+	return report
+}
+
+// sortedKeys devuelve las claves ordenadas para que el reporte sea estable
+func sortedKeys(stocks map[store.StockKey]domain.Stock) []store.StockKey {
+	keys := make([]store.StockKey, 0, len(stocks))
+	for key := range stocks {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.Ticker != b.Ticker {
+			return a.Ticker < b.Ticker
+		}
+		if a.BrokerageID != b.BrokerageID {
+			return a.BrokerageID < b.BrokerageID
+		}
+		return a.Time < b.Time
+	})
+	return keys
+}
+
+// contentHash es el SHA-256 de los eventos con los campos que compara
+// domain.DiffStocks, sin depender de su orden; vacío si no hay eventos
+func contentHash(stocks []domain.Stock) string {
+	if len(stocks) == 0 {
+		return ""
+	}
+	lines := make([]string, len(stocks))
+	for i, s := range stocks {
+		lines[i] = strings.Join([]string{
+			s.Ticker, s.BrokerageID, s.Time, s.Brokerage, s.Action,
+			s.RatingFrom, s.RatingTo, moneyKey(s.TargetFrom), moneyKey(s.TargetTo),
+			s.NormalizedAction, s.NormalizedRatingFrom, s.NormalizedRatingTo, s.SourceID,
+			fmt.Sprint(s.DisappearedAt != nil),
+		}, "\x1f")
+	}
+	sort.Strings(lines)
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// moneyKey es el precio en centavos para contentHash; vacío si no hay precio
+func moneyKey(m *domain.Money) string {
+	if m == nil {
+		return ""
+	}
+	return fmt.Sprint(int64(*m))
+}
+
+// writeVerifyReports escribe los reportes en JSON en output o en la salida
+// estándar; con una sola fuente se escribe el objeto sin la lista
+func writeVerifyReports(reports []*verifyReport, output string) error {
+	var document any = reports
+	if len(reports) == 1 {
+		document = reports[0]
+	}
+	data, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		fmt.Println(string(data))
+		return nil
+	}
+	if err := os.WriteFile(output, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("error escribiendo %s: %w", output, err)
+	}
+	slog.Info("Reporte de verify escrito", "file", output)
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JuanVel1/stock-api/domain"
+)
+
+// verifyStock arma un evento de la fuente source para los tests de verify
+func verifyStock(ticker, brokerageID, time, ratingTo, source string, priority int) domain.Stock {
+	return domain.Stock{
+		Ticker: ticker, Company: ticker + " Inc.", Brokerage: "Broker " + brokerageID,
+		BrokerageID: brokerageID, Time: time, RatingTo: ratingTo,
+		Provenance: domain.Provenance{SourceID: source, SourcePriority: priority},
+	}
+}
+
+// TestReconcile verifica la clasificación de los eventos que faltan, sobran
+// o difieren, y que los de otra fuente con más prioridad no cuenten
+func TestReconcile(t *testing.T) {
+	disappeared := time.Now()
+	gone := verifyStock("MSFT", "b1", "t9", "Buy", "api", 1)
+	gone.DisappearedAt = &disappeared
+
+	upstream := []domain.Stock{
+		verifyStock("AAPL", "b1", "t1", "Buy", "api", 1),
+		verifyStock("AAPL", "b2", "t1", "Hold", "api", 1),
+		verifyStock("MSFT", "b1", "t2", "Buy", "api", 1),
+		verifyStock("TSLA", "b1", "t3", "Sell", "api", 1),
+	}
+	stored := []domain.Stock{
+		verifyStock("AAPL", "b1", "t1", "Buy", "api", 1),
+		verifyStock("AAPL", "b2", "t1", "Sell", "api", 1),
+		verifyStock("TSLA", "b1", "t3", "Buy", "partner", 5),
+		verifyStock("NVDA", "b1", "t4", "Buy", "api", 1),
+		verifyStock("NVDA", "b1", "t5", "Buy", "partner", 5),
+		gone,
+	}
+
+	report := reconcile("api", upstream, stored, 0)
+	assert.Equal(t, 1, report.Matched)
+	assert.Equal(t, 1, report.Overridden)
+	require.Equal(t, 1, report.MissingCount)
+	assert.Equal(t, "MSFT", report.Missing[0].Ticker)
+	require.Equal(t, 1, report.MismatchCount)
+	assert.Equal(t, "b2", report.Mismatched[0].BrokerageID)
+	assert.Contains(t, report.Mismatched[0].Diff, "rating_to")
+	require.Equal(t, 1, report.ExtraCount)
+	assert.Equal(t, "t4", report.Extra[0].Time)
+	assert.True(t, report.Drift())
+
+	assert.Equal(t, 3, report.Tickers)
+	require.Len(t, report.DriftedTickers, 3)
+	assert.Equal(t, "AAPL", report.DriftedTickers[0].Ticker)
+	assert.Equal(t, 2, report.DriftedTickers[0].UpstreamCount)
+	assert.Equal(t, 2, report.DriftedTickers[0].StoredCount)
+	assert.NotEqual(t, report.DriftedTickers[0].UpstreamHash, report.DriftedTickers[0].StoredHash)
+	assert.Equal(t, "MSFT", report.DriftedTickers[1].Ticker)
+	assert.Equal(t, 0, report.DriftedTickers[1].StoredCount)
+	assert.Equal(t, "NVDA", report.DriftedTickers[2].Ticker)
+	assert.Equal(t, 0, report.DriftedTickers[2].UpstreamCount)
+}
+
+// TestReconcileInSync verifica que sin diferencias no haya drift y que
+// -max-records solo acorte las listas
+func TestReconcileInSync(t *testing.T) {
+	upstream := []domain.Stock{
+		verifyStock("AAPL", "b1", "t1", "Buy", "api", 1),
+		verifyStock("AAPL", "b1", "t2", "Hold", "api", 1),
+	}
+	report := reconcile("api", upstream, upstream, 0)
+	assert.False(t, report.Drift())
+	assert.Equal(t, 2, report.Matched)
+	assert.Equal(t, 1, report.Tickers)
+	assert.Empty(t, report.DriftedTickers)
+
+	report = reconcile("api", upstream, nil, 1)
+	assert.Equal(t, 2, report.MissingCount)
+	assert.Len(t, report.Missing, 1)
+	assert.True(t, report.Truncated)
+	assert.Equal(t, exitDrift, exitCode(errDrift))
+}
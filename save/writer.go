@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/JuanVel1/stock-api/domain"
+	"github.com/JuanVel1/stock-api/logging"
+)
+
+// writerOptions configura el pool de escritores de saveStocks y syncStocks
+type writerOptions struct {
+	// Concurrency es la cantidad de lotes que se escriben a la vez
+	Concurrency int
+	// BatchSize es la cantidad de registros por transacción
+	BatchSize int
+	// MaxAttempts son los intentos de cada lote ante errores reintentables o
+	// de conexión (ver retryBatch)
+	MaxAttempts int
+	// CopyThreshold es la cantidad de registros a partir de la cual una carga
+	// usa COPY en lugar de upserts (0 lo desactiva)
+	CopyThreshold int
+	// CopyBatchSize es la cantidad de registros por transacción con COPY
+	CopyBatchSize int
+}
+
+// writeOptions se completa con los flags -concurrency, -batch-size,
+// -batch-attempts, -copy-threshold y -copy-batch-size (ver registerWriterFlags)
+var writeOptions = writerOptions{Concurrency: 4, BatchSize: 25, MaxAttempts: 5, CopyThreshold: 1000, CopyBatchSize: 5000}
+
+// validate verifica que las opciones sean utilizables
+func (o writerOptions) validate() error {
+	if o.Concurrency < 1 {
+		return fmt.Errorf("concurrency debe ser al menos 1 (recibido %d)", o.Concurrency)
+	}
+	if o.BatchSize < 1 {
+		return fmt.Errorf("batch-size debe ser al menos 1 (recibido %d)", o.BatchSize)
+	}
+	if o.MaxAttempts < 1 {
+		return fmt.Errorf("batch-attempts debe ser al menos 1 (recibido %d)", o.MaxAttempts)
+	}
+	if o.CopyThreshold < 0 {
+		return fmt.Errorf("copy-threshold no puede ser negativo (recibido %d)", o.CopyThreshold)
+	}
+	if o.CopyBatchSize < 1 {
+		return fmt.Errorf("copy-batch-size debe ser al menos 1 (recibido %d)", o.CopyBatchSize)
+	}
+	return nil
+}
+
+// writeBatch es la función con la que cada escritor guarda un lote
+var writeBatch = storeBatch
+
+// storeBatch guarda el lote por COPY o con upserts según bulk
+func storeBatch(ctx context.Context, runID string, batch []domain.Stock, bulk bool) (batchResult, error) {
+	if bulk {
+		return processBulkBatch(ctx, runID, batch)
+	}
+	return processBatch(ctx, runID, batch)
+}
+
+// writeJob es un lote de una página enviado a los escritores; index es su
+// posición dentro de la página
+type writeJob struct {
+	page  int
+	index int
+	batch []domain.Stock
+	bulk  bool
+}
+
+// writerEvent llega al reporter: el registro de una página nueva (batches
+// indica cuántos lotes esperar) o el resultado de uno de sus lotes
+type writerEvent struct {
+	page     int
+	register bool
+	batches  int
+	meta     any
+	result   batchResult
+	size     int
+	err      error
+}
+
+// pageProgress acumula los lotes terminados de una página
+type pageProgress struct {
+	meta    any
+	pending int
+	result  saveResult
+}
+
+// pageWriter guarda páginas de stocks con un pool acotado de escritores.
+// SubmitPage se bloquea cuando todos los escritores están ocupados, lo que
+// frena al fetcher; onPage se llama en el orden de envío de las páginas,
+// aunque sus lotes terminen desordenados, con el error de esa página o de
+// una anterior, para que el checkpoint solo avance sobre páginas confirmadas.
+type pageWriter struct {
+	ctx    context.Context
+	runID  string
+	opts   writerOptions
+	jobs   chan writeJob
+	events chan writerEvent
+	onPage func(meta any, result saveResult, err error) error
+
+	workers  sync.WaitGroup
+	reporter chan struct{}
+	pages    int
+
+	mu  sync.Mutex
+	err error
+}
+
+// newPageWriter arranca opts.Concurrency escritores para la ejecución runID.
+// Cancelar ctx no corta los lotes en curso, solo sus esperas entre reintentos
+// (ver retryBatch).
+func newPageWriter(ctx context.Context, runID string, opts writerOptions, onPage func(meta any, result saveResult, err error) error) *pageWriter {
+	w := &pageWriter{
+		ctx:      ctx,
+		runID:    runID,
+		opts:     opts,
+		jobs:     make(chan writeJob, opts.Concurrency),
+		events:   make(chan writerEvent, opts.Concurrency),
+		onPage:   onPage,
+		reporter: make(chan struct{}),
+	}
+
+	for i := 0; i < opts.Concurrency; i++ {
+		w.workers.Add(1)
+		go w.work(i + 1)
+	}
+	go w.report()
+	return w
+}
+
+// SubmitPage divide los stocks en lotes y los encola; las páginas grandes
+// (ver writerOptions.CopyThreshold) se cargan por COPY. Devuelve el error de
+// una página anterior para que el fetcher deje de pedir páginas.
+func (w *pageWriter) SubmitPage(stocks []domain.Stock, meta any) error {
+	if err := w.Err(); err != nil {
+		return err
+	}
+
+	batchSize, bulk := w.opts.BatchSize, false
+	if w.opts.useBulkLoad(len(stocks)) {
+		batchSize, bulk = w.opts.CopyBatchSize, true
+		slog.Info("Carga por COPY", "run_id", w.runID, "count", len(stocks), "batch_size", batchSize)
+	}
+
+	page := w.pages
+	w.pages++
+	batches := (len(stocks) + batchSize - 1) / batchSize
+	w.events <- writerEvent{page: page, register: true, batches: batches, meta: meta}
+
+	for i := 0; i < len(stocks); i += batchSize {
+		w.jobs <- writeJob{page: page, index: i / batchSize, batch: stocks[i:min(i+batchSize, len(stocks))], bulk: bulk}
+	}
+	return nil
+}
+
+// Close espera a que terminen los lotes encolados y devuelve el primer error
+func (w *pageWriter) Close() error {
+	close(w.jobs)
+	w.workers.Wait()
+	close(w.events)
+	<-w.reporter
+	return w.Err()
+}
+
+// Err devuelve el primer error de una página, si hubo
+func (w *pageWriter) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+func (w *pageWriter) fail(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+// work es un escritor: cada lote tiene sus propios reintentos en writeBatch
+// y, si los agota, se envía a dead letters sin frenar a los demás
+func (w *pageWriter) work(id int) {
+	defer w.workers.Done()
+	for job := range w.jobs {
+		// page y batch cuentan desde 1 dentro de esta ejecución del escritor
+		logger := slog.With("run_id", w.runID, "writer", id, "page", job.page+1, "batch", job.index+1)
+		logger.Debug("Escribiendo lote", "size", len(job.batch), "bulk", job.bulk)
+		result, err := writeBatch(logging.NewContext(w.ctx, logger), w.runID, job.batch, job.bulk)
+		if err != nil {
+			logger.Error("Error procesando el lote", logging.Err(err))
+			deadLetterBatch(w.runID, job.batch, err, result.Retries+1)
+		}
+		w.events <- writerEvent{page: job.page, result: result, size: len(job.batch), err: err}
+	}
+}
+
+// report junta los resultados por página y llama a onPage en orden
+func (w *pageWriter) report() {
+	defer close(w.reporter)
+
+	progress := make(map[int]*pageProgress)
+	next := 0
+	for event := range w.events {
+		p := progress[event.page]
+		if p == nil {
+			p = &pageProgress{}
+			progress[event.page] = p
+		}
+
+		// El registro de una página siempre llega antes que sus lotes
+		if event.register {
+			p.meta = event.meta
+			p.pending = event.batches
+		} else {
+			p.pending--
+			p.result.Retries += event.result.Retries
+			if event.err != nil {
+				p.result.Failed += event.size
+				p.result.LastErr = event.err
+			} else {
+				p.result.Saved += event.size
+				p.result.Inserted += event.result.Inserted
+				p.result.Updated += event.result.Updated
+				p.result.Copied += event.result.Copied
+				p.result.Skipped += event.result.Skipped
+			}
+		}
+
+		for {
+			done := progress[next]
+			if done == nil || done.pending != 0 {
+				break
+			}
+			delete(progress, next)
+			next++
+			if done.result.Failed > 0 {
+				w.fail(fmt.Errorf("hubo errores al guardar %d stocks de la página %d: %w",
+					done.result.Failed, next, done.result.LastErr))
+			}
+			if err := w.onPage(done.meta, done.result, w.Err()); err != nil {
+				w.fail(err)
+			}
+		}
+	}
+}
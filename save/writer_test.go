@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JuanVel1/stock-api/domain"
+)
+
+// fakeStocks genera n stocks distintos para los tests del pool
+func fakeStocks(ticker string, n int) []domain.Stock {
+	stocks := make([]domain.Stock, n)
+	for i := range stocks {
+		stocks[i] = domain.Stock{Ticker: ticker, Time: time.Unix(int64(i), 0).UTC().Format(time.RFC3339)}
+	}
+	return stocks
+}
+
+// TestPageWriterOrderedProgress verifica que las páginas se informen en orden
+// aunque sus lotes terminen desordenados
+func TestPageWriterOrderedProgress(t *testing.T) {
+	var inFlight, maxInFlight int32
+	writeBatch = func(_ context.Context, _ string, batch []domain.Stock, bulk bool) (batchResult, error) {
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			seen := atomic.LoadInt32(&maxInFlight)
+			if current <= seen || atomic.CompareAndSwapInt32(&maxInFlight, seen, current) {
+				break
+			}
+		}
+		// La primera página es la más lenta
+		if batch[0].Ticker == "P0" {
+			time.Sleep(30 * time.Millisecond)
+		}
+		return batchResult{Inserted: len(batch)}, nil
+	}
+	defer func() { writeBatch = storeBatch }()
+
+	var order []string
+	var total saveResult
+	writer := newPageWriter(context.Background(), "run", writerOptions{Concurrency: 3, BatchSize: 2, CopyBatchSize: 5000}, func(meta any, result saveResult, err error) error {
+		require.NoError(t, err)
+		order = append(order, meta.(string))
+		total.Saved += result.Saved
+		total.Inserted += result.Inserted
+		return nil
+	})
+
+	for _, page := range []string{"P0", "P1", "P2", "P3"} {
+		require.NoError(t, writer.SubmitPage(fakeStocks(page, 5), page))
+	}
+	require.NoError(t, writer.SubmitPage(nil, "vacía"))
+	require.NoError(t, writer.Close())
+
+	assert.Equal(t, []string{"P0", "P1", "P2", "P3", "vacía"}, order)
+	assert.Equal(t, 20, total.Saved)
+	assert.Equal(t, 20, total.Inserted)
+	assert.LessOrEqual(t, atomic.LoadInt32(&maxInFlight), int32(3))
+}
+
+// TestPageWriterFailure verifica que un lote fallido frene el checkpoint y
+// termine en dead letters
+func TestPageWriterFailure(t *testing.T) {
+	t.Setenv("DEAD_LETTER_FILE", filepath.Join(t.TempDir(), "dead_letters.ndjson"))
+	db = nil
+
+	writeBatch = func(_ context.Context, _ string, batch []domain.Stock, bulk bool) (batchResult, error) {
+		if batch[0].Ticker == "BAD" {
+			return batchResult{Retries: 2}, errors.New("violación de restricción")
+		}
+		return batchResult{Updated: len(batch)}, nil
+	}
+	defer func() { writeBatch = storeBatch }()
+
+	var committed []string
+	var failed int
+	writer := newPageWriter(context.Background(), "run", writerOptions{Concurrency: 1, BatchSize: 10, CopyBatchSize: 5000}, func(meta any, result saveResult, err error) error {
+		failed += result.Failed
+		if err == nil {
+			committed = append(committed, meta.(string))
+		}
+		return nil
+	})
+
+	require.NoError(t, writer.SubmitPage(fakeStocks("OK", 3), "ok"))
+	require.NoError(t, writer.SubmitPage(fakeStocks("BAD", 2), "bad"))
+	err := writer.Close()
+	require.Error(t, err)
+
+	assert.Equal(t, []string{"ok"}, committed)
+	assert.Equal(t, 2, failed)
+	assert.Error(t, writer.SubmitPage(fakeStocks("OK", 1), "después"))
+
+	records, err := readDeadLetterFile(deadLetterFile())
+	require.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, 3, records[0].Attempts)
+}
+
+// TestPageWriterBulkLoad verifica que las páginas grandes vayan por COPY
+func TestPageWriterBulkLoad(t *testing.T) {
+	var mu sync.Mutex
+	var sizes []int
+	bulkBatches := 0
+	writeBatch = func(_ context.Context, _ string, batch []domain.Stock, bulk bool) (batchResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		sizes = append(sizes, len(batch))
+		if bulk {
+			bulkBatches++
+			return batchResult{Inserted: len(batch), Copied: len(batch)}, nil
+		}
+		return batchResult{Inserted: len(batch)}, nil
+	}
+	defer func() { writeBatch = storeBatch }()
+
+	var total saveResult
+	opts := writerOptions{Concurrency: 2, BatchSize: 2, CopyThreshold: 10, CopyBatchSize: 4}
+	writer := newPageWriter(context.Background(), "run", opts, func(meta any, result saveResult, err error) error {
+		total.Inserted += result.Inserted
+		total.Copied += result.Copied
+		return nil
+	})
+
+	require.NoError(t, writer.SubmitPage(fakeStocks("BIG", 10), "grande"))
+	require.NoError(t, writer.SubmitPage(fakeStocks("SMALL", 3), "chica"))
+	require.NoError(t, writer.Close())
+
+	assert.Equal(t, 3, bulkBatches)
+	assert.ElementsMatch(t, []int{4, 4, 2, 2, 1}, sizes)
+	assert.Equal(t, 13, total.Inserted)
+	assert.Equal(t, 10, total.Copied)
+	assert.False(t, writerOptions{CopyThreshold: 0}.useBulkLoad(1_000_000))
+}
+
+// TestRetryBatchRetryableCodes verifica que un lock timeout (55P03) se
+// reintente y que un error permanente no
+func TestRetryBatchRetryableCodes(t *testing.T) {
+	savedBackoff, savedOptions := batchBackoffBase, writeOptions
+	defer func() { batchBackoffBase, writeOptions = savedBackoff, savedOptions }()
+	batchBackoffBase = time.Millisecond
+	writeOptions.MaxAttempts = 3
+
+	attempts := 0
+	result, err := retryBatch(context.Background(), "upsert", "run", fakeStocks("A", 2),
+		func(_ context.Context, _ string, batch []domain.Stock) (batchResult, error) {
+			attempts++
+			if attempts == 1 {
+				return batchResult{}, &pq.Error{Code: "55P03"}
+			}
+			return batchResult{Inserted: len(batch)}, nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, 2, result.Inserted)
+	assert.Equal(t, 1, result.Retries)
+
+	attempts = 0
+	_, err = retryBatch(context.Background(), "upsert", "run", fakeStocks("A", 2),
+		func(context.Context, string, []domain.Stock) (batchResult, error) {
+			attempts++
+			return batchResult{}, &pq.Error{Code: "23505"}
+		})
+	require.Error(t, err)
+	assert.Equal(t, 1, attempts)
+}
+
+// TestRetryBatchCanceledBackoff verifica que cancelar ctx corte la espera
+// entre reintentos pero no el intento en curso
+func TestRetryBatchCanceledBackoff(t *testing.T) {
+	savedBackoff, savedOptions := batchBackoffBase, writeOptions
+	defer func() { batchBackoffBase, writeOptions = savedBackoff, savedOptions }()
+	batchBackoffBase = time.Hour
+	writeOptions.MaxAttempts = 3
+
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	start := time.Now()
+	_, err := retryBatch(ctx, "upsert", "run", fakeStocks("A", 2),
+		func(ctx context.Context, _ string, _ []domain.Stock) (batchResult, error) {
+			attempts++
+			cancel()
+			// El intento en curso no ve la cancelación
+			assert.NoError(t, ctx.Err())
+			return batchResult{}, &pq.Error{Code: "40001"}
+		})
+	require.Error(t, err)
+	assert.Equal(t, 1, attempts)
+	assert.Less(t, time.Since(start), time.Minute)
+}
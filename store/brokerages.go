@@ -0,0 +1,326 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/JuanVel1/stock-api/domain"
+)
+
+var (
+	// ErrBrokerageNotFound indica que uno de los brókers de la operación no existe
+	ErrBrokerageNotFound = errors.New("bróker no encontrado")
+	// ErrInvalidMerge indica una fusión sin nada que fusionar o de un bróker consigo mismo
+	ErrInvalidMerge = errors.New("fusión de brókers inválida")
+)
+
+// ListBrokerages devuelve los brókers ordenados por nombre, con sus alias
+func ListBrokerages(ctx context.Context, db *sqlx.DB) ([]domain.Brokerage, error) {
+	brokerages := []domain.Brokerage{}
+	err := db.SelectContext(ctx, &brokerages, `
+		SELECT id, name, reputation, created_at, updated_at
+		FROM brokerages ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+
+	var aliases []struct {
+		BrokerageID string `db:"brokerage_id"`
+		Alias       string `db:"alias"`
+	}
+	err = db.SelectContext(ctx, &aliases, `
+		SELECT brokerage_id, alias FROM brokerage_aliases ORDER BY alias`)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string][]string)
+	for _, a := range aliases {
+		byID[a.BrokerageID] = append(byID[a.BrokerageID], a.Alias)
+	}
+	for i := range brokerages {
+		brokerages[i].Aliases = byID[brokerages[i].ID]
+		if brokerages[i].Aliases == nil {
+			brokerages[i].Aliases = []string{}
+		}
+	}
+	return brokerages, nil
+}
+
+// LoadBrokerageDirectory arma el directorio de brókers desde la base de
+// datos; si las tablas están vacías usa domain.DefaultBrokerages
+func LoadBrokerageDirectory(ctx context.Context, db *sqlx.DB) (*domain.BrokerageDirectory, error) {
+	brokerages, err := ListBrokerages(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if len(brokerages) == 0 {
+		return domain.DefaultBrokerageDirectory(), nil
+	}
+	return domain.NewBrokerageDirectory(brokerages), nil
+}
+
+// EnsureBrokerages registra como brókers nuevos los nombres cuya clave no
+// tiene alias todavía. Es idempotente: otro proceso puede registrar los
+// mismos nombres a la vez.
+func EnsureBrokerages(ctx context.Context, db *sqlx.DB, names []string) error {
+	err := RunInTx(ctx, db, func(tx *sqlx.Tx) error {
+		for _, name := range names {
+			key := domain.BrokerageKey(name)
+			if key == "" {
+				continue
+			}
+
+			var exists bool
+			err := tx.GetContext(ctx, &exists, `
+				SELECT EXISTS (SELECT 1 FROM brokerage_aliases WHERE alias_key = $1)`, key)
+			if err != nil {
+				return err
+			}
+			if exists {
+				continue
+			}
+
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO brokerages (name, reputation) VALUES ($1, $2)
+				ON CONFLICT (name) DO NOTHING`, name, domain.DefaultReputation)
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO brokerage_aliases (alias_key, alias, brokerage_id)
+				SELECT $1, $2, id FROM brokerages WHERE name = $2
+				ON CONFLICT (alias_key) DO NOTHING`, key, name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error registrando brókers: %w", err)
+	}
+	return nil
+}
+
+// ResolveBrokerages registra los brókers de stocks que no están en
+// directory y completa el BrokerageID de cada registro. Devuelve el
+// directorio a usar desde ahora (recargado si hubo brókers nuevos) y los
+// nombres registrados. Si falla, los ids se completan con directory.
+func ResolveBrokerages(ctx context.Context, db *sqlx.DB, directory *domain.BrokerageDirectory, stocks []domain.Stock) (*domain.BrokerageDirectory, []string, error) {
+	seen := make(map[string]bool)
+	var unknown []string
+	for _, stock := range stocks {
+		name := domain.BrokerageName(stock.Brokerage)
+		key := domain.BrokerageKey(name)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if _, ok := directory.Resolve(name); !ok {
+			unknown = append(unknown, name)
+		}
+	}
+
+	if len(unknown) > 0 {
+		err := EnsureBrokerages(ctx, db, unknown)
+		if err == nil {
+			var loaded *domain.BrokerageDirectory
+			loaded, err = LoadBrokerageDirectory(ctx, db)
+			if err == nil {
+				directory = loaded
+			} else {
+				err = fmt.Errorf("error leyendo brokerages: %w", err)
+			}
+		}
+		if err != nil {
+			directory.AssignIDs(stocks)
+			return directory, nil, err
+		}
+	}
+	directory.AssignIDs(stocks)
+	return directory, unknown, nil
+}
+
+// MergeBrokerages fusiona en targetID los brókers sourceIDs (sus alias y
+// eventos pasan a targetID y los registros se eliminan) y apunta a targetID
+// los nombres de aliases junto con los eventos publicados con esos nombres.
+// Si targetID ya tiene un evento con la misma clave se conserva ese. Los
+// brókers que quedan sin alias ni eventos se eliminan. Devuelve el bróker
+// resultante.
+func MergeBrokerages(ctx context.Context, db *sqlx.DB, targetID string, sourceIDs, aliases []string) (*domain.Brokerage, error) {
+	if len(sourceIDs) == 0 && len(aliases) == 0 {
+		return nil, ErrInvalidMerge
+	}
+	for _, id := range sourceIDs {
+		if id == targetID {
+			return nil, ErrInvalidMerge
+		}
+	}
+
+	var merged *domain.Brokerage
+	err := RunInTx(ctx, db, func(tx *sqlx.Tx) error {
+		ids := append([]string{targetID}, sourceIDs...)
+		var found int
+		err := tx.GetContext(ctx, &found, `
+			SELECT count(*) FROM brokerages WHERE id = ANY($1)`, pq.Array(ids))
+		if err != nil {
+			return err
+		}
+		if found != len(uniqueStrings(ids)) {
+			return ErrBrokerageNotFound
+		}
+
+		if len(sourceIDs) > 0 {
+			_, err = tx.ExecContext(ctx, `
+				UPDATE brokerage_aliases SET brokerage_id = $1
+				WHERE brokerage_id = ANY($2)`, targetID, pq.Array(sourceIDs))
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `
+				UPDATE stock_changes SET brokerage_id = $1
+				WHERE brokerage_id = ANY($2)`, targetID, pq.Array(sourceIDs))
+			if err != nil {
+				return err
+			}
+		}
+		for _, id := range uniqueStrings(sourceIDs) {
+			if err := moveRatingEvents(ctx, tx, targetID, id, nil); err != nil {
+				return err
+			}
+		}
+
+		for _, alias := range aliases {
+			key := domain.BrokerageKey(alias)
+			if key == "" {
+				return fmt.Errorf("%w: alias vacío", ErrInvalidMerge)
+			}
+			if err := moveAliasEvents(ctx, tx, targetID, key); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO brokerage_aliases (alias_key, alias, brokerage_id)
+				VALUES ($1, $2, $3)
+				ON CONFLICT (alias_key) DO UPDATE SET brokerage_id = EXCLUDED.brokerage_id`,
+				key, alias, targetID)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM brokerages b
+			WHERE b.id <> $1
+			  AND NOT EXISTS (SELECT 1 FROM brokerage_aliases a WHERE a.brokerage_id = b.id)
+			  AND NOT EXISTS (SELECT 1 FROM rating_events e WHERE e.brokerage_id = b.id)`, targetID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE brokerages SET updated_at = now() WHERE id = $1`, targetID)
+		if err != nil {
+			return err
+		}
+
+		merged, err = getBrokerage(ctx, tx, targetID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// moveAliasEvents pasa a targetID los eventos publicados con un nombre de
+// clave key que hoy pertenecen a otro bróker
+func moveAliasEvents(ctx context.Context, tx *sqlx.Tx, targetID, key string) error {
+	var ownerID string
+	err := tx.GetContext(ctx, &ownerID, `
+		SELECT brokerage_id FROM brokerage_aliases WHERE alias_key = $1`, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if ownerID == targetID {
+		return nil
+	}
+
+	var names []string
+	err = tx.SelectContext(ctx, &names, `
+		SELECT DISTINCT brokerage FROM rating_events WHERE brokerage_id = $1`, ownerID)
+	if err != nil {
+		return err
+	}
+	var matching []string
+	for _, name := range names {
+		if domain.BrokerageKey(domain.BrokerageName(name)) == key {
+			matching = append(matching, name)
+		}
+	}
+	if len(matching) == 0 {
+		return nil
+	}
+	return moveRatingEvents(ctx, tx, targetID, ownerID, matching)
+}
+
+// moveRatingEvents pasa a targetID los eventos de fromID, todos o solo los
+// publicados con los nombres names. Los que chocan con un evento de targetID
+// se descartan.
+func moveRatingEvents(ctx context.Context, tx *sqlx.Tx, targetID, fromID string, names []string) error {
+	_, err := tx.ExecContext(ctx, `
+		DELETE FROM rating_events e
+		WHERE e.brokerage_id = $2
+		  AND ($3::TEXT[] IS NULL OR e.brokerage = ANY($3))
+		  AND EXISTS (
+			SELECT 1 FROM rating_events t
+			WHERE t.brokerage_id = $1 AND t.ticker = e.ticker AND t.time = e.time
+		  )`, targetID, fromID, pq.Array(names))
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE rating_events SET brokerage_id = $1, updated_at = now()
+		WHERE brokerage_id = $2 AND ($3::TEXT[] IS NULL OR brokerage = ANY($3))`,
+		targetID, fromID, pq.Array(names))
+	return err
+}
+
+func getBrokerage(ctx context.Context, tx *sqlx.Tx, id string) (*domain.Brokerage, error) {
+	var b domain.Brokerage
+	err := tx.GetContext(ctx, &b, `
+		SELECT id, name, reputation, created_at, updated_at
+		FROM brokerages WHERE id = $1`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrBrokerageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	b.Aliases = []string{}
+	err = tx.SelectContext(ctx, &b.Aliases, `
+		SELECT alias FROM brokerage_aliases WHERE brokerage_id = $1 ORDER BY alias`, id)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var unique []string
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,387 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/JuanVel1/stock-api/domain"
+)
+
+// Tipos de cambio de stock_changes
+const (
+	ChangeInserted    = "inserted"
+	ChangeUpdated     = "updated"
+	ChangeDisappeared = "disappeared"
+)
+
+// StockKey identifica un evento de rating_events (clave primaria)
+type StockKey struct {
+	Ticker      string
+	BrokerageID string
+	Time        string
+}
+
+// KeyOf devuelve la clave del registro
+func KeyOf(stock domain.Stock) StockKey {
+	return StockKey{stock.Ticker, stock.BrokerageID, stock.Time}
+}
+
+// FieldDiffs son los campos que cambiaron en una actualización; se guarda como JSONB
+type FieldDiffs map[string]domain.FieldChange
+
+// Scan implementa sql.Scanner
+func (d *FieldDiffs) Scan(src any) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*d = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("no se puede leer %T como diff", src)
+	}
+	return json.Unmarshal(data, d)
+}
+
+// StockChange es una fila de stock_changes. Los cambios anteriores al modelo
+// normalizado no tienen bróker.
+type StockChange struct {
+	ID          string     `db:"id" json:"id"`
+	RunID       *string    `db:"run_id" json:"run_id"`
+	Ticker      string     `db:"ticker" json:"ticker"`
+	BrokerageID *string    `db:"brokerage_id" json:"brokerage_id"`
+	Brokerage   *string    `db:"brokerage" json:"brokerage,omitempty"`
+	Time        string     `db:"time" json:"time"`
+	ChangeType  string     `db:"change_type" json:"change_type"`
+	Diff        FieldDiffs `db:"diff" json:"diff,omitempty"`
+	DetectedAt  time.Time  `db:"detected_at" json:"detected_at"`
+}
+
+// newStockChange arma un cambio sin id para la clave y la ejecución runID
+func newStockChange(runID string, key StockKey, changeType string) StockChange {
+	change := StockChange{Ticker: key.Ticker, Time: key.Time, ChangeType: changeType}
+	if runID != "" {
+		change.RunID = &runID
+	}
+	if key.BrokerageID != "" {
+		brokerageID := key.BrokerageID
+		change.BrokerageID = &brokerageID
+	}
+	return change
+}
+
+// ChangeCursor es la posición de un cambio en el orden de ListStockChanges,
+// (detected_at, id). Se usa para pedir los cambios siguientes a uno ya leído.
+type ChangeCursor struct {
+	DetectedAt time.Time
+	ID         string
+}
+
+// CursorOf devuelve el cursor que apunta al cambio
+func CursorOf(change StockChange) ChangeCursor {
+	return ChangeCursor{DetectedAt: change.DetectedAt, ID: change.ID}
+}
+
+// String codifica el cursor como "<detected_at RFC3339Nano>,<id>"
+func (c ChangeCursor) String() string {
+	return c.DetectedAt.UTC().Format(time.RFC3339Nano) + "," + c.ID
+}
+
+// ParseChangeCursor interpreta un cursor generado por ChangeCursor.String
+func ParseChangeCursor(value string) (ChangeCursor, error) {
+	detectedAt, id, found := strings.Cut(value, ",")
+	if !found || id == "" {
+		return ChangeCursor{}, fmt.Errorf("cursor inválido %q", value)
+	}
+	parsed, err := time.Parse(time.RFC3339Nano, detectedAt)
+	if err != nil {
+		return ChangeCursor{}, fmt.Errorf("cursor inválido %q: %w", value, err)
+	}
+	return ChangeCursor{DetectedAt: parsed, ID: id}, nil
+}
+
+// StockChangeFilter acota la consulta de cambios; los campos vacíos no filtran
+type StockChangeFilter struct {
+	Since time.Time
+	// After devuelve solo los cambios posteriores al cursor
+	After      *ChangeCursor
+	ChangeType string
+	Ticker     string
+	// SettleWindow oculta los cambios detectados hace menos de este tiempo.
+	// detected_at es el inicio de la transacción que escribió el cambio, así
+	// que una transacción todavía abierta puede confirmar cambios con un
+	// detected_at anterior a otros ya visibles; esperar la ventana evita que
+	// un cursor los saltee, siempre que las transacciones de escritura duren
+	// menos que ella.
+	SettleWindow time.Duration
+}
+
+// args devuelve los parámetros $1..$6 de las consultas de stock_changes
+func (f StockChangeFilter) args() []any {
+	var afterAt, afterID any
+	if f.After != nil {
+		afterAt, afterID = f.After.DetectedAt, f.After.ID
+	}
+	return []any{f.Since, afterAt, afterID, f.ChangeType, f.Ticker, f.SettleWindow.Microseconds()}
+}
+
+// stockChangesWhere es la condición de ListStockChanges y CountStockChanges
+// sobre los parámetros de StockChangeFilter.args
+const stockChangesWhere = `
+	c.detected_at > $1
+	AND ($2::TIMESTAMPTZ IS NULL OR (c.detected_at, c.id) > ($2::TIMESTAMPTZ, $3::UUID))
+	AND ($4 = '' OR c.change_type = $4)
+	AND ($5 = '' OR c.ticker = $5)
+	AND c.detected_at <= now() - $6 * INTERVAL '1 microsecond'`
+
+// ExistingStocks devuelve los eventos de rating_events con las claves del lote
+func ExistingStocks(ctx context.Context, tx *sqlx.Tx, batch []domain.Stock) (map[StockKey]domain.Stock, error) {
+	tickers := make([]string, len(batch))
+	times := make([]string, len(batch))
+	for i, stock := range batch {
+		tickers[i] = stock.Ticker
+		times[i] = stock.Time
+	}
+
+	var rows []domain.Stock
+	err := tx.SelectContext(ctx, &rows, `
+		SELECT e.ticker, c.name AS company, e.brokerage, e.brokerage_id,
+			e.action, e.rating_from, e.rating_to, e.target_from, e.target_to,
+			e.time, e.normalized_action, e.normalized_rating_from,
+			e.normalized_rating_to, e.disappeared_at, e.source_id,
+			e.source_priority, e.fetched_at, e.page_ref
+		FROM rating_events e
+		JOIN companies c ON c.ticker = e.ticker
+		WHERE e.ticker = ANY($1) AND e.time = ANY($2)`,
+		pq.Array(tickers), pq.Array(times))
+	if err != nil {
+		return nil, err
+	}
+
+	// ANY sobre cada columna trae también combinaciones que no están en el
+	// lote, y de otros brókers; se filtra por la clave completa
+	wanted := make(map[StockKey]bool, len(batch))
+	for _, stock := range batch {
+		wanted[KeyOf(stock)] = true
+	}
+	existing := make(map[StockKey]domain.Stock, len(rows))
+	for _, row := range rows {
+		if key := KeyOf(row); wanted[key] {
+			existing[key] = row
+		}
+	}
+	return existing, nil
+}
+
+// SourceStocks devuelve los eventos escritos por la fuente sourceID junto
+// con todos los de los tickers indicados, aunque los haya escrito otra fuente
+func SourceStocks(ctx context.Context, db *sqlx.DB, sourceID string, tickers []string) ([]domain.Stock, error) {
+	rows := []domain.Stock{}
+	err := db.SelectContext(ctx, &rows, `
+		SELECT e.ticker, c.name AS company, e.brokerage, e.brokerage_id,
+			e.action, e.rating_from, e.rating_to, e.target_from, e.target_to,
+			e.time, e.normalized_action, e.normalized_rating_from,
+			e.normalized_rating_to, e.disappeared_at, e.source_id,
+			e.source_priority, e.fetched_at, e.page_ref
+		FROM rating_events e
+		JOIN companies c ON c.ticker = e.ticker
+		WHERE e.source_id = $1 OR e.ticker = ANY($2)`,
+		sourceID, pq.Array(tickers))
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo rating_events: %w", err)
+	}
+	return rows, nil
+}
+
+// FilterByPriority descarta del lote los registros que no pueden reemplazar
+// al evento guardado con la misma clave porque lo escribió otra fuente con
+// más prioridad (ver domain.Provenance.Overrides). Devuelve los que quedan y
+// cuántos descartó.
+func FilterByPriority(batch []domain.Stock, existing map[StockKey]domain.Stock) ([]domain.Stock, int) {
+	kept := make([]domain.Stock, 0, len(batch))
+	for _, stock := range batch {
+		if previous, found := existing[KeyOf(stock)]; found && !stock.Overrides(previous.Provenance) {
+			continue
+		}
+		kept = append(kept, stock)
+	}
+	return kept, len(batch) - len(kept)
+}
+
+// DedupeStocks deja una sola aparición de cada clave del lote: vale la
+// última, en la posición de la primera. Un INSERT ... ON CONFLICT DO UPDATE
+// falla si dos filas del mismo lote tienen la misma clave.
+func DedupeStocks(batch []domain.Stock) []domain.Stock {
+	index := make(map[StockKey]int, len(batch))
+	deduped := make([]domain.Stock, 0, len(batch))
+	for _, stock := range batch {
+		key := KeyOf(stock)
+		if i, seen := index[key]; seen {
+			deduped[i] = stock
+			continue
+		}
+		index[key] = len(deduped)
+		deduped = append(deduped, stock)
+	}
+	return deduped
+}
+
+// DetectChanges clasifica el lote contra las filas existentes: las claves
+// nuevas son inserted y las que cambiaron algún campo son updated con su
+// diff. Las filas idénticas no generan cambio. Si una clave se repite en el
+// lote vale la última aparición.
+func DetectChanges(runID string, batch []domain.Stock, existing map[StockKey]domain.Stock) []StockChange {
+	var changes []StockChange
+	for _, stock := range DedupeStocks(batch) {
+		key := KeyOf(stock)
+		previous, found := existing[key]
+		if !found {
+			changes = append(changes, newStockChange(runID, key, ChangeInserted))
+			continue
+		}
+		if diff := domain.DiffStocks(previous, stock); diff != nil {
+			change := newStockChange(runID, key, ChangeUpdated)
+			change.Diff = diff
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// CountChanges cuenta las inserciones y actualizaciones de DetectChanges; las
+// filas idénticas a las guardadas no suman en ninguna
+func CountChanges(changes []StockChange) (inserted, updated int) {
+	for _, change := range changes {
+		switch change.ChangeType {
+		case ChangeInserted:
+			inserted++
+		case ChangeUpdated:
+			updated++
+		}
+	}
+	return inserted, updated
+}
+
+// InsertStockChanges guarda los cambios con COPY dentro de la transacción
+func InsertStockChanges(ctx context.Context, tx *sqlx.Tx, changes []StockChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("stock_changes", "run_id", "ticker", "brokerage_id", "time", "change_type", "diff"))
+	if err != nil {
+		return fmt.Errorf("error iniciando COPY de stock_changes: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, change := range changes {
+		var diff any
+		if change.Diff != nil {
+			data, err := json.Marshal(change.Diff)
+			if err != nil {
+				return err
+			}
+			diff = string(data)
+		}
+		_, err := stmt.ExecContext(ctx, change.RunID, change.Ticker, change.BrokerageID, change.Time, change.ChangeType, diff)
+		if err != nil {
+			return fmt.Errorf("error enviando cambios por COPY: %w", err)
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return fmt.Errorf("error terminando COPY de stock_changes: %w", err)
+	}
+	return nil
+}
+
+// FindDisappeared devuelve un cambio disappeared por cada evento vigente de
+// la fuente sourceID que no está en seen, sin modificar nada. Solo tiene
+// sentido después de leer la fuente completa.
+func FindDisappeared(ctx context.Context, db *sqlx.DB, runID, sourceID string, seen map[StockKey]bool) ([]StockChange, error) {
+	var current []struct {
+		Ticker      string `db:"ticker"`
+		BrokerageID string `db:"brokerage_id"`
+		Time        string `db:"time"`
+	}
+	err := db.SelectContext(ctx, &current, `
+		SELECT ticker, brokerage_id, time FROM rating_events
+		WHERE source_id = $1 AND disappeared_at IS NULL`, sourceID)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo claves de rating_events: %w", err)
+	}
+
+	var changes []StockChange
+	for _, row := range current {
+		key := StockKey{row.Ticker, row.BrokerageID, row.Time}
+		if seen[key] {
+			continue
+		}
+		changes = append(changes, newStockChange(runID, key, ChangeDisappeared))
+	}
+	return changes, nil
+}
+
+// MarkDisappeared marca con disappeared_at las filas que encuentra
+// FindDisappeared y registra un cambio disappeared por cada una. Devuelve
+// cuántas marcó.
+func MarkDisappeared(ctx context.Context, db *sqlx.DB, runID, sourceID string, seen map[StockKey]bool) (int, error) {
+	changes, err := FindDisappeared(ctx, db, runID, sourceID, seen)
+	if err != nil {
+		return 0, err
+	}
+	if len(changes) == 0 {
+		return 0, nil
+	}
+
+	err = RunInTx(ctx, db, func(tx *sqlx.Tx) error {
+		for _, change := range changes {
+			_, err := tx.ExecContext(ctx, `
+				UPDATE rating_events SET disappeared_at = now(), updated_at = now()
+				WHERE ticker = $1 AND brokerage_id = $2 AND time = $3
+				  AND disappeared_at IS NULL`,
+				change.Ticker, change.BrokerageID, change.Time)
+			if err != nil {
+				return err
+			}
+		}
+		return InsertStockChanges(ctx, tx, changes)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error marcando registros desaparecidos: %w", err)
+	}
+	return len(changes), nil
+}
+
+// ListStockChanges devuelve los cambios que cumplen el filtro en el orden
+// (detected_at, id), los más antiguos primero
+func ListStockChanges(ctx context.Context, db *sqlx.DB, filter StockChangeFilter, offset, limit int) ([]StockChange, error) {
+	changes := []StockChange{}
+	err := db.SelectContext(ctx, &changes, `
+		SELECT c.id, c.run_id, c.ticker, c.brokerage_id, b.name AS brokerage,
+			c.time, c.change_type, c.diff, c.detected_at
+		FROM stock_changes c
+		LEFT JOIN brokerages b ON b.id = c.brokerage_id
+		WHERE `+stockChangesWhere+`
+		ORDER BY c.detected_at, c.id
+		OFFSET $7 LIMIT $8`,
+		append(filter.args(), offset, limit)...)
+	return changes, err
+}
+
+// CountStockChanges cuenta los cambios que cumplen el filtro
+func CountStockChanges(ctx context.Context, db *sqlx.DB, filter StockChangeFilter) (int, error) {
+	var total int
+	err := db.GetContext(ctx, &total, `
+		SELECT count(*) FROM stock_changes c
+		WHERE `+stockChangesWhere, filter.args()...)
+	return total, err
+}
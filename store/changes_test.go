@@ -0,0 +1,104 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JuanVel1/stock-api/domain"
+)
+
+// TestDetectChanges verifica la clasificación de un lote contra las filas existentes
+func TestDetectChanges(t *testing.T) {
+	unchanged := domain.Stock{Ticker: "AAPL", BrokerageID: "b1", Time: "t1", RatingTo: "Buy", TargetTo: domain.Price(180)}
+	before := domain.Stock{Ticker: "MSFT", BrokerageID: "b1", Time: "t1", RatingTo: "Hold", TargetTo: domain.Price(400)}
+	after := before
+	after.RatingTo = "Buy"
+	inserted := domain.Stock{Ticker: "NVDA", BrokerageID: "b1", Time: "t1", RatingTo: "Buy"}
+	// Mismo ticker y fecha que unchanged, pero de otro bróker
+	otherBrokerage := unchanged
+	otherBrokerage.BrokerageID = "b2"
+
+	existing := map[StockKey]domain.Stock{
+		KeyOf(unchanged): unchanged,
+		KeyOf(before):    before,
+	}
+	changes := DetectChanges("run-1", []domain.Stock{unchanged, before, after, inserted, otherBrokerage}, existing)
+
+	require.Len(t, changes, 3)
+	assert.Equal(t, "MSFT", changes[0].Ticker)
+	assert.Equal(t, ChangeUpdated, changes[0].ChangeType)
+	assert.Equal(t, domain.FieldChange{Old: "Hold", New: "Buy"}, changes[0].Diff["rating_to"])
+	assert.Equal(t, "run-1", *changes[0].RunID)
+	assert.Equal(t, "b1", *changes[0].BrokerageID)
+
+	assert.Equal(t, "NVDA", changes[1].Ticker)
+	assert.Equal(t, ChangeInserted, changes[1].ChangeType)
+	assert.Nil(t, changes[1].Diff)
+
+	assert.Equal(t, "AAPL", changes[2].Ticker)
+	assert.Equal(t, ChangeInserted, changes[2].ChangeType)
+	assert.Equal(t, "b2", *changes[2].BrokerageID)
+
+	// La fila sin cambios no cuenta como actualizada
+	insertedCount, updatedCount := CountChanges(changes)
+	assert.Equal(t, 2, insertedCount)
+	assert.Equal(t, 1, updatedCount)
+}
+
+// TestFilterByPriority verifica que una fuente no pise a otra de más prioridad
+func TestFilterByPriority(t *testing.T) {
+	primary := domain.Provenance{SourceID: "primary", SourcePriority: 10}
+	backup := domain.Provenance{SourceID: "backup", SourcePriority: 5}
+
+	stored := domain.Stock{Ticker: "AAPL", BrokerageID: "b1", Time: "t1", Provenance: primary}
+	existing := map[StockKey]domain.Stock{KeyOf(stored): stored}
+
+	fromBackup := stored
+	fromBackup.Provenance = backup
+	newFromBackup := domain.Stock{Ticker: "MSFT", BrokerageID: "b1", Time: "t1", Provenance: backup}
+	fromPrimary := stored
+	fromPrimary.RatingTo = "Buy"
+
+	kept, skipped := FilterByPriority([]domain.Stock{fromBackup, newFromBackup, fromPrimary}, existing)
+	assert.Equal(t, 1, skipped)
+	assert.Equal(t, []domain.Stock{newFromBackup, fromPrimary}, kept)
+}
+
+// TestDedupeStocks verifica que una clave repetida en el lote quede una sola
+// vez, con la última aparición
+func TestDedupeStocks(t *testing.T) {
+	first := domain.Stock{Ticker: "AAPL", BrokerageID: "b1", Time: "t1", RatingTo: "Hold"}
+	other := domain.Stock{Ticker: "MSFT", BrokerageID: "b1", Time: "t1", RatingTo: "Buy"}
+	last := first
+	last.RatingTo = "Buy"
+
+	deduped := DedupeStocks([]domain.Stock{first, other, last})
+	assert.Equal(t, []domain.Stock{last, other}, deduped)
+
+	// Con la clave repetida, DetectChanges registra un solo cambio
+	changes := DetectChanges("run-1", []domain.Stock{first, other, last}, map[StockKey]domain.Stock{KeyOf(first): first})
+	require.Len(t, changes, 2)
+	assert.Equal(t, ChangeUpdated, changes[0].ChangeType)
+	assert.Equal(t, domain.FieldChange{Old: "Hold", New: "Buy"}, changes[0].Diff["rating_to"])
+	assert.Equal(t, ChangeInserted, changes[1].ChangeType)
+}
+
+// TestChangeCursor verifica que el cursor de un cambio se pueda volver a leer
+func TestChangeCursor(t *testing.T) {
+	detectedAt := time.Date(2025, 1, 13, 0, 30, 5, 123456000, time.UTC)
+	cursor := CursorOf(StockChange{ID: "7f0c2d4e-1b2a-4c3d-9e8f-0a1b2c3d4e5f", DetectedAt: detectedAt})
+	assert.Equal(t, "2025-01-13T00:30:05.123456Z,7f0c2d4e-1b2a-4c3d-9e8f-0a1b2c3d4e5f", cursor.String())
+
+	parsed, err := ParseChangeCursor(cursor.String())
+	require.NoError(t, err)
+	assert.True(t, parsed.DetectedAt.Equal(detectedAt))
+	assert.Equal(t, cursor.ID, parsed.ID)
+
+	for _, invalid := range []string{"", "abc", "2025-01-13T00:30:05Z", "ayer,7f0c2d4e"} {
+		_, err := ParseChangeCursor(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
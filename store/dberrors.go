@@ -0,0 +1,112 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+
+	"github.com/lib/pq"
+)
+
+// ErrorClass indica qué hacer con un error de base de datos
+type ErrorClass string
+
+const (
+	// ErrorRetryable son conflictos de la transacción (serialización,
+	// deadlock, bloqueos): se puede repetir la transacción tal cual
+	ErrorRetryable ErrorClass = "retryable"
+	// ErrorConnection son fallas de la conexión o del nodo: hay que
+	// reconectar antes de reintentar
+	ErrorConnection ErrorClass = "connection"
+	// ErrorPermanent son errores que no se arreglan reintentando (sintaxis,
+	// restricciones, permisos)
+	ErrorPermanent ErrorClass = "permanent"
+)
+
+// ErrorDecision es el resultado de clasificar un error: la clase, el
+// SQLSTATE (vacío si el error no viene del servidor) y el motivo
+type ErrorDecision struct {
+	Class  ErrorClass
+	Code   string
+	Reason string
+}
+
+// Retry indica si vale la pena reintentar la operación
+func (d ErrorDecision) Retry() bool {
+	return d.Class == ErrorRetryable || d.Class == ErrorConnection
+}
+
+// Reconnect indica si hay que abrir una conexión nueva antes de reintentar
+func (d ErrorDecision) Reconnect() bool {
+	return d.Class == ErrorConnection
+}
+
+func (d ErrorDecision) String() string {
+	if d.Code == "" {
+		return fmt.Sprintf("%s (%s)", d.Class, d.Reason)
+	}
+	return fmt.Sprintf("%s (SQLSTATE %s %s)", d.Class, d.Code, d.Reason)
+}
+
+// retryableCodes son los SQLSTATE de conflictos entre transacciones
+var retryableCodes = map[pq.ErrorCode]bool{
+	"40001": true, // serialization_failure (restart transaction en CockroachDB)
+	"40P01": true, // deadlock_detected
+	"40003": true, // statement_completion_unknown (resultado ambiguo en CockroachDB)
+	"55P03": true, // lock_not_available
+	"57014": true, // query_canceled (statement_timeout)
+	"53300": true, // too_many_connections
+}
+
+// connectionCodes son los SQLSTATE que dejan la conexión inutilizable
+var connectionCodes = map[pq.ErrorCode]bool{
+	"57P01": true, // admin_shutdown
+	"57P02": true, // crash_shutdown
+	"57P03": true, // cannot_connect_now
+}
+
+// ClassifyError decide si un error de base de datos se puede reintentar a
+// partir del SQLSTATE de *pq.Error; para errores sin código (red, contexto)
+// se usa el tipo del error, nunca el texto del mensaje
+func ClassifyError(err error) ErrorDecision {
+	if err == nil {
+		return ErrorDecision{}
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		decision := ErrorDecision{Class: ErrorPermanent, Code: string(pqErr.Code), Reason: pqErr.Code.Name()}
+		switch {
+		case pqErr.Code.Class() == "08" || connectionCodes[pqErr.Code]:
+			decision.Class = ErrorConnection
+		case retryableCodes[pqErr.Code]:
+			decision.Class = ErrorRetryable
+		}
+		if decision.Reason == "" {
+			decision.Reason = "unknown"
+		}
+		return decision
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return ErrorDecision{Class: ErrorPermanent, Reason: "context canceled"}
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorDecision{Class: ErrorRetryable, Reason: "timeout"}
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone):
+		return ErrorDecision{Class: ErrorConnection, Reason: "bad connection"}
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrorDecision{Class: ErrorConnection, Reason: "connection closed"}
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return ErrorDecision{Class: ErrorConnection, Reason: "connection refused or reset"}
+	case errors.As(err, &netErr):
+		return ErrorDecision{Class: ErrorConnection, Reason: "network error"}
+	}
+	return ErrorDecision{Class: ErrorPermanent, Reason: "unclassified"}
+}
@@ -0,0 +1,46 @@
+package store
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestClassifyError verifica la clasificación por SQLSTATE y por tipo de error
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		class ErrorClass
+		code  string
+	}{
+		{"Serialización", &pq.Error{Code: "40001"}, ErrorRetryable, "40001"},
+		{"Deadlock", &pq.Error{Code: "40P01"}, ErrorRetryable, "40P01"},
+		{"Apagado del nodo", &pq.Error{Code: "57P01"}, ErrorConnection, "57P01"},
+		{"Clase 08", &pq.Error{Code: "08006"}, ErrorConnection, "08006"},
+		{"Violación de unicidad", &pq.Error{Code: "23505"}, ErrorPermanent, "23505"},
+		{"Sintaxis", &pq.Error{Code: "42601"}, ErrorPermanent, "42601"},
+		{"Envuelto", fmt.Errorf("error ejecutando consulta: %w", &pq.Error{Code: "40001"}), ErrorRetryable, "40001"},
+		{"Conexión inválida", driver.ErrBadConn, ErrorConnection, ""},
+		{"Red", &net.OpError{Op: "dial", Err: errors.New("refused")}, ErrorConnection, ""},
+		{"Timeout", context.DeadlineExceeded, ErrorRetryable, ""},
+		{"Cancelado", context.Canceled, ErrorPermanent, ""},
+		// El texto ya no decide: "lock" en el mensaje no lo hace reintentable
+		{"Texto engañoso", errors.New("column \"lock\" does not exist"), ErrorPermanent, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := ClassifyError(tt.err)
+			assert.Equal(t, tt.class, decision.Class)
+			assert.Equal(t, tt.code, decision.Code)
+			assert.Equal(t, tt.class != ErrorPermanent, decision.Retry())
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// IngestClaimTimeout es cuánto se respeta una clave de idempotencia cuya
+// petición no terminó; después se asume que el proceso murió y otra
+// petición puede tomarla
+const IngestClaimTimeout = 10 * time.Minute
+
+// IngestRequest es una fila de ingest_requests
+type IngestRequest struct {
+	Source         string     `db:"source"`
+	IdempotencyKey string     `db:"idempotency_key"`
+	RequestHash    string     `db:"request_hash"`
+	RunID          *string    `db:"run_id"`
+	StatusCode     *int       `db:"status_code"`
+	Response       []byte     `db:"response"`
+	CreatedAt      time.Time  `db:"created_at"`
+	CompletedAt    *time.Time `db:"completed_at"`
+}
+
+// Completed indica si la petición terminó y tiene respuesta guardada
+func (r *IngestRequest) Completed() bool {
+	return r.StatusCode != nil
+}
+
+// ClaimIngestRequest reserva la clave de idempotencia para una petición
+// nueva. Si la clave ya existe no la modifica y devuelve la fila existente
+// con claimed=false.
+func ClaimIngestRequest(ctx context.Context, db *sqlx.DB, source, key, requestHash string) (existing *IngestRequest, claimed bool, err error) {
+	err = RunInTx(ctx, db, func(tx *sqlx.Tx) error {
+		existing, claimed = nil, false
+
+		_, err := tx.ExecContext(ctx, `
+			DELETE FROM ingest_requests
+			WHERE source = $1 AND idempotency_key = $2
+			  AND status_code IS NULL AND created_at < $3`,
+			source, key, time.Now().Add(-IngestClaimTimeout))
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO ingest_requests (source, idempotency_key, request_hash)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (source, idempotency_key) DO NOTHING`, source, key, requestHash)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 1 {
+			claimed = true
+			return nil
+		}
+
+		var row IngestRequest
+		err = tx.GetContext(ctx, &row, `
+			SELECT source, idempotency_key, request_hash, run_id, status_code,
+				response, created_at, completed_at
+			FROM ingest_requests WHERE source = $1 AND idempotency_key = $2`, source, key)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("clave de idempotencia %q liberada durante la consulta", key)
+		}
+		if err != nil {
+			return err
+		}
+		existing = &row
+		return nil
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("error reservando la clave de idempotencia: %w", err)
+	}
+	return existing, claimed, nil
+}
+
+// CompleteIngestRequest guarda la respuesta de una petición reservada
+func CompleteIngestRequest(ctx context.Context, db *sqlx.DB, source, key string, runID *string, statusCode int, response []byte) error {
+	err := RunInTx(ctx, db, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE ingest_requests
+			SET run_id = $3, status_code = $4, response = $5, completed_at = now()
+			WHERE source = $1 AND idempotency_key = $2`,
+			source, key, runID, statusCode, string(response))
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error guardando la respuesta de la clave de idempotencia: %w", err)
+	}
+	return nil
+}
+
+// ReleaseIngestRequest libera una clave reservada que no terminó, para que
+// el cliente pueda reintentar con la misma clave
+func ReleaseIngestRequest(ctx context.Context, db *sqlx.DB, source, key string) error {
+	_, err := db.ExecContext(ctx, `
+		DELETE FROM ingest_requests
+		WHERE source = $1 AND idempotency_key = $2 AND status_code IS NULL`, source, key)
+	if err != nil {
+		return fmt.Errorf("error liberando la clave de idempotencia: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// PriceConversionError es un precio TEXT que la migración a NUMERIC no pudo interpretar
+type PriceConversionError struct {
+	Ticker     string    `db:"ticker" json:"ticker"`
+	Time       string    `db:"time" json:"time"`
+	ColumnName string    `db:"column_name" json:"column_name"`
+	RawValue   *string   `db:"raw_value" json:"raw_value"`
+	DetectedAt time.Time `db:"detected_at" json:"detected_at"`
+}
+
+// PriceConversionMigration es el nombre de la migración que convierte los precios
+const PriceConversionMigration = "numeric_target_prices"
+
+// ListPriceConversionErrors devuelve los precios que no se pudieron convertir
+func ListPriceConversionErrors(ctx context.Context, db *sqlx.DB) ([]PriceConversionError, error) {
+	var rows []PriceConversionError
+	err := db.SelectContext(ctx, &rows, `
+		SELECT ticker, time, column_name, raw_value, detected_at
+		FROM price_conversion_errors
+		ORDER BY ticker, time, column_name`)
+	return rows, err
+}
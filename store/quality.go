@@ -0,0 +1,221 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/JuanVel1/stock-api/domain"
+)
+
+// maxQualitySamples limita los registros de ejemplo guardados por regla
+const maxQualitySamples = 5
+
+// QualityReport es el reporte de calidad de datos de una ejecución
+type QualityReport struct {
+	RunID     string         `db:"run_id" json:"run_id"`
+	Source    string         `db:"source" json:"source"`
+	Checked   int            `db:"checked" json:"checked"`
+	Accepted  int            `db:"accepted" json:"accepted"`
+	Rejected  int            `db:"rejected" json:"rejected"`
+	Flagged   int            `db:"flagged" json:"flagged"`
+	CreatedAt time.Time      `db:"created_at" json:"created_at"`
+	Issues    []QualityIssue `db:"-" json:"issues"`
+}
+
+// QualityIssue cuenta los registros que violaron una regla
+type QualityIssue struct {
+	RunID    string         `db:"run_id" json:"-"`
+	Rule     string         `db:"rule" json:"rule"`
+	Severity string         `db:"severity" json:"severity"`
+	Count    int            `db:"count" json:"count"`
+	Samples  QualitySamples `db:"samples" json:"samples"`
+}
+
+// QualitySample identifica un registro con problemas
+type QualitySample struct {
+	Ticker string `json:"ticker"`
+	Time   string `json:"time"`
+	Field  string `json:"field"`
+	Value  string `json:"value"`
+}
+
+// QualitySamples se guarda como JSONB
+type QualitySamples []QualitySample
+
+// Scan implementa sql.Scanner
+func (s *QualitySamples) Scan(src any) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*s = QualitySamples{}
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("no se puede leer %T como muestras", src)
+	}
+	return json.Unmarshal(data, s)
+}
+
+// NewQualityReport crea un reporte vacío para la ejecución runID
+func NewQualityReport(runID, source string) *QualityReport {
+	return &QualityReport{RunID: runID, Source: source}
+}
+
+// Record suma al reporte el resultado de validar un registro
+func (r *QualityReport) Record(raw domain.RawStock, issues []domain.Issue) {
+	r.Checked++
+	switch {
+	case domain.Rejected(issues):
+		r.Rejected++
+	case len(issues) > 0:
+		r.Accepted++
+		r.Flagged++
+	default:
+		r.Accepted++
+	}
+
+	for _, issue := range issues {
+		entry := r.issue(issue.Rule, string(issue.Severity))
+		entry.Count++
+		if len(entry.Samples) < maxQualitySamples {
+			entry.Samples = append(entry.Samples, QualitySample{
+				Ticker: raw.Ticker, Time: raw.Time, Field: issue.Field, Value: issue.Value,
+			})
+		}
+	}
+}
+
+func (r *QualityReport) issue(rule, severity string) *QualityIssue {
+	for i := range r.Issues {
+		if r.Issues[i].Rule == rule {
+			return &r.Issues[i]
+		}
+	}
+	r.Issues = append(r.Issues, QualityIssue{RunID: r.RunID, Rule: rule, Severity: severity, Samples: QualitySamples{}})
+	sort.Slice(r.Issues, func(i, j int) bool { return r.Issues[i].Rule < r.Issues[j].Rule })
+	for i := range r.Issues {
+		if r.Issues[i].Rule == rule {
+			return &r.Issues[i]
+		}
+	}
+	return nil
+}
+
+// SaveQualityReport guarda (o reemplaza) el reporte de una ejecución
+func SaveQualityReport(ctx context.Context, db *sqlx.DB, report *QualityReport) error {
+	err := RunInTx(ctx, db, func(tx *sqlx.Tx) error {
+		_, err := tx.NamedExecContext(ctx, `
+			INSERT INTO data_quality_reports (run_id, source, checked, accepted, rejected, flagged)
+			VALUES (:run_id, :source, :checked, :accepted, :rejected, :flagged)
+			ON CONFLICT (run_id) DO UPDATE SET
+				checked = EXCLUDED.checked,
+				accepted = EXCLUDED.accepted,
+				rejected = EXCLUDED.rejected,
+				flagged = EXCLUDED.flagged`, report)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM data_quality_issues WHERE run_id = $1`, report.RunID); err != nil {
+			return err
+		}
+		for _, issue := range report.Issues {
+			samples, err := json.Marshal(issue.Samples)
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO data_quality_issues (run_id, rule, severity, count, samples)
+				VALUES ($1, $2, $3, $4, $5)`,
+				report.RunID, issue.Rule, issue.Severity, issue.Count, string(samples))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error guardando reporte de calidad de %s: %v", report.RunID, err)
+	}
+	return nil
+}
+
+// ListQualityReports devuelve los reportes más recientes primero, con sus reglas
+func ListQualityReports(ctx context.Context, db *sqlx.DB, offset, limit int) ([]QualityReport, error) {
+	reports := []QualityReport{}
+	err := db.SelectContext(ctx, &reports, `
+		SELECT run_id, source, checked, accepted, rejected, flagged, created_at
+		FROM data_quality_reports
+		ORDER BY created_at DESC OFFSET $1 LIMIT $2`, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(reports) == 0 {
+		return reports, nil
+	}
+
+	ids := make([]string, len(reports))
+	for i, report := range reports {
+		ids[i] = report.RunID
+	}
+	var issues []QualityIssue
+	err = db.SelectContext(ctx, &issues, `
+		SELECT run_id, rule, severity, count, samples
+		FROM data_quality_issues WHERE run_id = ANY($1) ORDER BY rule`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	byRun := make(map[string][]QualityIssue)
+	for _, issue := range issues {
+		byRun[issue.RunID] = append(byRun[issue.RunID], issue)
+	}
+	for i := range reports {
+		reports[i].Issues = byRun[reports[i].RunID]
+		if reports[i].Issues == nil {
+			reports[i].Issues = []QualityIssue{}
+		}
+	}
+	return reports, nil
+}
+
+// CountQualityReports devuelve el total de reportes guardados
+func CountQualityReports(ctx context.Context, db *sqlx.DB) (int, error) {
+	var total int
+	err := db.GetContext(ctx, &total, `SELECT COUNT(*) FROM data_quality_reports`)
+	return total, err
+}
+
+// GetQualityReport busca el reporte de una ejecución; devuelve nil si no existe
+func GetQualityReport(ctx context.Context, db *sqlx.DB, runID string) (*QualityReport, error) {
+	var report QualityReport
+	err := db.GetContext(ctx, &report, `
+		SELECT run_id, source, checked, accepted, rejected, flagged, created_at
+		FROM data_quality_reports WHERE run_id = $1`, runID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	report.Issues = []QualityIssue{}
+	err = db.SelectContext(ctx, &report.Issues, `
+		SELECT run_id, rule, severity, count, samples
+		FROM data_quality_issues WHERE run_id = $1 ORDER BY rule`, runID)
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
@@ -0,0 +1,36 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JuanVel1/stock-api/domain"
+)
+
+// TestQualityReportRecord verifica los conteos y el límite de ejemplos por regla
+func TestQualityReportRecord(t *testing.T) {
+	report := NewQualityReport("run-1", "api")
+	for i := 0; i < maxQualitySamples+2; i++ {
+		raw := domain.RawStock{Ticker: "", Time: "2025-01-13T00:30:05Z"}
+		_, issues := domain.Validate(raw)
+		report.Record(raw, issues)
+	}
+	flagged := domain.RawStock{Ticker: "AAPL", RatingTo: "Mega Buy", Time: "2025-01-13T00:30:05Z"}
+	_, issues := domain.Validate(flagged)
+	report.Record(flagged, issues)
+	report.Record(domain.RawStock{Ticker: "MSFT", Time: "2025-01-13T00:30:05Z"}, nil)
+
+	assert.Equal(t, maxQualitySamples+4, report.Checked)
+	assert.Equal(t, 2, report.Accepted)
+	assert.Equal(t, maxQualitySamples+2, report.Rejected)
+	assert.Equal(t, 1, report.Flagged)
+
+	require.Len(t, report.Issues, 2)
+	assert.Equal(t, domain.RuleMissingTicker, report.Issues[0].Rule)
+	assert.Equal(t, maxQualitySamples+2, report.Issues[0].Count)
+	assert.Len(t, report.Issues[0].Samples, maxQualitySamples)
+	assert.Equal(t, domain.RuleUnknownRating, report.Issues[1].Rule)
+	assert.Equal(t, "warning", report.Issues[1].Severity)
+}
@@ -0,0 +1,269 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/JuanVel1/stock-api/domain"
+)
+
+// RatingEventsMigration es el nombre de la migración que crea companies y
+// rating_events; al aplicarla hay que ejecutar BackfillRatingEvents
+const RatingEventsMigration = "create_rating_events"
+
+// BatchResult cuenta lo que hizo UpsertStocks con un lote. Inserted y
+// Updated salen de DetectChanges: los registros iguales a los guardados no
+// cuentan como actualizados.
+type BatchResult struct {
+	Inserted int
+	Updated  int
+	// Skipped son los registros que no se escribieron porque otra fuente con
+	// más prioridad ya los tenía
+	Skipped int
+	// Retries son los reintentos por conflictos de serialización
+	Retries int
+}
+
+// backfillBatchSize son los eventos que BackfillRatingEvents inserta por transacción
+const backfillBatchSize = 500
+
+// company es una fila de companies
+type company struct {
+	Ticker string `db:"ticker"`
+	Name   string `db:"name"`
+}
+
+// UpsertCompanies crea las empresas del lote y actualiza el nombre de las
+// existentes. Si un ticker se repite en el lote vale el último nombre.
+func UpsertCompanies(ctx context.Context, tx *sqlx.Tx, batch []domain.Stock) error {
+	names := make(map[string]string, len(batch))
+	var tickers []string
+	for _, stock := range batch {
+		if _, seen := names[stock.Ticker]; !seen {
+			tickers = append(tickers, stock.Ticker)
+		}
+		names[stock.Ticker] = stock.Company
+	}
+	if len(tickers) == 0 {
+		return nil
+	}
+
+	companies := make([]company, len(tickers))
+	for i, ticker := range tickers {
+		companies[i] = company{Ticker: ticker, Name: names[ticker]}
+	}
+	_, err := tx.NamedExecContext(ctx, `
+		INSERT INTO companies (ticker, name) VALUES (:ticker, :name)
+		ON CONFLICT (ticker) DO UPDATE SET name = EXCLUDED.name, updated_at = now()
+		WHERE companies.name <> EXCLUDED.name`, companies)
+	if err != nil {
+		return fmt.Errorf("error guardando companies: %w", err)
+	}
+	return nil
+}
+
+// BackfillRatingEvents copia a rating_events las filas de stocks: registra
+// sus brókers, resuelve cada nombre a su bróker canónico e inserta los
+// eventos que todavía no existen. Es idempotente; devuelve cuántas filas leyó.
+func BackfillRatingEvents(ctx context.Context, db *sqlx.DB) (int, error) {
+	var rows []domain.Stock
+	err := db.SelectContext(ctx, &rows, `
+		SELECT ticker, COALESCE(company, '') AS company,
+			COALESCE(brokerage, '') AS brokerage, COALESCE(action, '') AS action,
+			COALESCE(rating_from, '') AS rating_from, COALESCE(rating_to, '') AS rating_to,
+			target_from, target_to, time, normalized_action,
+			normalized_rating_from, normalized_rating_to, disappeared_at
+		FROM stocks`)
+	if err != nil {
+		return 0, fmt.Errorf("error leyendo stocks: %w", err)
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	names := make([]string, 0, len(rows))
+	for _, row := range rows {
+		names = append(names, domain.BrokerageName(row.Brokerage))
+	}
+	if err := EnsureBrokerages(ctx, db, uniqueStrings(names)); err != nil {
+		return 0, err
+	}
+	directory, err := LoadBrokerageDirectory(ctx, db)
+	if err != nil {
+		return 0, fmt.Errorf("error leyendo brokerages: %w", err)
+	}
+	for i := range rows {
+		b, ok := directory.Resolve(domain.BrokerageName(rows[i].Brokerage))
+		if !ok || b.ID == "" {
+			return 0, fmt.Errorf("%w: %q", ErrBrokerageNotFound, rows[i].Brokerage)
+		}
+		rows[i].BrokerageID = b.ID
+	}
+
+	for i := 0; i < len(rows); i += backfillBatchSize {
+		batch := rows[i:min(i+backfillBatchSize, len(rows))]
+		err := RunInTx(ctx, db, func(tx *sqlx.Tx) error {
+			// La migración ya creó las empresas; esto cubre las filas escritas después
+			_, err := tx.NamedExecContext(ctx, `
+				INSERT INTO companies (ticker, name) VALUES (:ticker, :company)
+				ON CONFLICT (ticker) DO NOTHING`, batch)
+			if err != nil {
+				return err
+			}
+			_, err = tx.NamedExecContext(ctx, `
+				INSERT INTO rating_events (
+					ticker, brokerage_id, time, brokerage, action,
+					rating_from, rating_to, target_from, target_to,
+					normalized_action, normalized_rating_from, normalized_rating_to,
+					disappeared_at
+				) VALUES (
+					:ticker, :brokerage_id, :time, :brokerage, :action,
+					:rating_from, :rating_to, :target_from, :target_to,
+					:normalized_action, :normalized_rating_from, :normalized_rating_to,
+					:disappeared_at
+				) ON CONFLICT (ticker, brokerage_id, time) DO NOTHING`, batch)
+			return err
+		})
+		if err != nil {
+			return 0, fmt.Errorf("error copiando stocks a rating_events: %w", err)
+		}
+	}
+	return len(rows), nil
+}
+
+// UpsertStocks guarda el lote en companies y rating_events en una
+// transacción con RunInTxWithOptions, que repite el upsert ante conflictos de
+// serialización, y registra en stock_changes lo que cambió respecto de los
+// eventos existentes. Es la escritura común del proceso save y de
+// POST /api/ingest.
+func UpsertStocks(ctx context.Context, db *sqlx.DB, runID string, batch []domain.Stock, opts TxOptions) (BatchResult, error) {
+	var result BatchResult
+	retries := 0
+
+	onRetry := opts.OnRetry
+	opts.OnRetry = func(retry int, err error) {
+		retries = retry
+		if onRetry != nil {
+			onRetry(retry, err)
+		}
+	}
+	// Una clave repetida en el lote haría fallar el upsert ("cannot affect row
+	// a second time") y se contaría dos veces; vale la última aparición
+	deduped := DedupeStocks(batch)
+	err := RunInTxWithOptions(ctx, db, opts, func(tx *sqlx.Tx) error {
+		// Se recalcula en cada intento: otra transacción pudo insertar las claves
+		result = BatchResult{}
+
+		// Distinguir inserciones de actualizaciones antes del upsert
+		existing, err := ExistingStocks(ctx, tx, deduped)
+		if err != nil {
+			return fmt.Errorf("error consultando claves existentes: %w", err)
+		}
+		// Los registros que otra fuente con más prioridad ya escribió no se tocan
+		winners, skipped := FilterByPriority(deduped, existing)
+		result.Skipped = skipped
+		if len(winners) == 0 {
+			return nil
+		}
+		changes := DetectChanges(runID, winners, existing)
+		result.Inserted, result.Updated = CountChanges(changes)
+
+		if err := UpsertCompanies(ctx, tx, winners); err != nil {
+			return err
+		}
+
+		// Usamos NamedExec para inserción por lotes
+		query := `
+			INSERT INTO rating_events (
+				ticker, brokerage_id, time, brokerage, action,
+				rating_from, rating_to, target_from, target_to,
+				normalized_action, normalized_rating_from, normalized_rating_to,
+				source_id, source_priority, fetched_at, page_ref
+			) VALUES (
+				:ticker, :brokerage_id, :time, :brokerage, :action,
+				:rating_from, :rating_to, :target_from, :target_to,
+				:normalized_action, :normalized_rating_from, :normalized_rating_to,
+				:source_id, :source_priority, :fetched_at, :page_ref
+			) ON CONFLICT (ticker, brokerage_id, time) DO UPDATE SET
+				brokerage = EXCLUDED.brokerage,
+				action = EXCLUDED.action,
+				rating_from = EXCLUDED.rating_from,
+				rating_to = EXCLUDED.rating_to,
+				target_from = EXCLUDED.target_from,
+				target_to = EXCLUDED.target_to,
+				normalized_action = EXCLUDED.normalized_action,
+				normalized_rating_from = EXCLUDED.normalized_rating_from,
+				normalized_rating_to = EXCLUDED.normalized_rating_to,
+				source_id = EXCLUDED.source_id,
+				source_priority = EXCLUDED.source_priority,
+				fetched_at = EXCLUDED.fetched_at,
+				page_ref = EXCLUDED.page_ref,
+				disappeared_at = NULL,
+				updated_at = now()
+			WHERE rating_events.source_id = EXCLUDED.source_id
+			   OR rating_events.source_priority <= EXCLUDED.source_priority`
+
+		if _, err := tx.NamedExecContext(ctx, query, winners); err != nil {
+			return fmt.Errorf("error ejecutando consulta: %w", err)
+		}
+		if err := InsertStockChanges(ctx, tx, changes); err != nil {
+			return err
+		}
+		return nil
+	})
+	result.Retries = retries
+	return result, err
+}
+
+// deleteBatchSize son los eventos que DeleteRatingEvents borra por sentencia
+const deleteBatchSize = 1000
+
+// CountRatingEventsBySource devuelve cuántos eventos escribió cada fuente;
+// los anteriores al registro del origen quedan bajo la fuente vacía
+func CountRatingEventsBySource(ctx context.Context, db *sqlx.DB) (map[string]int, error) {
+	var rows []struct {
+		SourceID string `db:"source_id"`
+		Count    int    `db:"count"`
+	}
+	err := db.SelectContext(ctx, &rows, `
+		SELECT source_id, count(*) AS count FROM rating_events GROUP BY source_id`)
+	if err != nil {
+		return nil, fmt.Errorf("error contando rating_events: %w", err)
+	}
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.SourceID] = row.Count
+	}
+	return counts, nil
+}
+
+// DeleteRatingEvents borra los eventos escritos por las fuentes sources, o
+// todos si sources es nil, de a deleteBatchSize para no armar una
+// transacción enorme. stock_changes conserva el historial. Devuelve cuántos
+// eventos borró.
+func DeleteRatingEvents(ctx context.Context, db *sqlx.DB, sources []string) (int64, error) {
+	var total int64
+	for {
+		result, err := db.ExecContext(ctx, `
+			DELETE FROM rating_events
+			WHERE (ticker, brokerage_id, time) IN (
+				SELECT ticker, brokerage_id, time FROM rating_events
+				WHERE $1::TEXT[] IS NULL OR source_id = ANY($1)
+				LIMIT $2
+			)`, pq.Array(sources), deleteBatchSize)
+		if err != nil {
+			return total, fmt.Errorf("error borrando rating_events: %w", err)
+		}
+		deleted, err := result.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += deleted
+		if deleted == 0 {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// Package store contiene el acceso a las tablas compartidas entre la API y
+// el proceso de sincronización (save).
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Estados posibles de una ejecución
+const (
+	RunRunning   = "running"
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+	// RunInterrupted es una ejecución detenida por una señal; se puede
+	// reanudar desde su último checkpoint
+	RunInterrupted = "interrupted"
+)
+
+// SyncRun es una fila de la tabla sync_runs
+type SyncRun struct {
+	ID           string     `db:"id" json:"id"`
+	Kind         string     `db:"kind" json:"kind"`
+	Source       string     `db:"source" json:"source"`
+	Status       string     `db:"status" json:"status"`
+	StartedAt    time.Time  `db:"started_at" json:"started_at"`
+	FinishedAt   *time.Time `db:"finished_at" json:"finished_at"`
+	PagesFetched int        `db:"pages_fetched" json:"pages_fetched"`
+	RowsInserted int        `db:"rows_inserted" json:"rows_inserted"`
+	RowsUpdated  int        `db:"rows_updated" json:"rows_updated"`
+	RowsFailed   int        `db:"rows_failed" json:"rows_failed"`
+	Retries      int        `db:"retries" json:"retries"`
+	Error        *string    `db:"error" json:"error"`
+	ErrorCode    *string    `db:"error_code" json:"error_code"`
+	ErrorClass   *string    `db:"error_class" json:"error_class"`
+	// RowsCopied son las filas cargadas por COPY en lugar de upserts
+	RowsCopied    int      `db:"rows_copied" json:"rows_copied"`
+	RowsPerSecond *float64 `db:"rows_per_second" json:"rows_per_second"`
+	// RowsSkipped son los registros que no se escribieron porque otra fuente
+	// con más prioridad ya los tenía
+	RowsSkipped int `db:"rows_skipped" json:"rows_skipped"`
+}
+
+// RecordError guarda en la ejecución la clasificación de un error de base de
+// datos; el SQLSTATE queda en NULL si el error no vino del servidor
+func (r *SyncRun) RecordError(err error) ErrorDecision {
+	decision := ClassifyError(err)
+	class := string(decision.Class)
+	r.ErrorClass = &class
+	r.ErrorCode = nil
+	if decision.Code != "" {
+		code := decision.Code
+		r.ErrorCode = &code
+	}
+	return decision
+}
+
+const syncRunColumns = `id, kind, source, status, started_at, finished_at,
+	pages_fetched, rows_inserted, rows_updated, rows_failed, retries, error,
+	error_code, error_class, rows_copied, rows_per_second, rows_skipped`
+
+// CreateSyncRun registra el inicio de una ejecución
+func CreateSyncRun(ctx context.Context, db *sqlx.DB, kind, source string) (*SyncRun, error) {
+	run := &SyncRun{Kind: kind, Source: source, Status: RunRunning}
+	err := RunInTx(ctx, db, func(tx *sqlx.Tx) error {
+		return tx.QueryRowxContext(ctx, `
+			INSERT INTO sync_runs (kind, source, status) VALUES ($1, $2, $3)
+			RETURNING id, started_at`, kind, source, RunRunning).Scan(&run.ID, &run.StartedAt)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error registrando ejecución: %v", err)
+	}
+	return run, nil
+}
+
+// FinishSyncRun guarda los contadores finales y el estado según runErr, con
+// la clasificación del error si la ejecución falló. Un runErr que envuelve
+// context.Canceled deja la ejecución como interrumpida.
+func FinishSyncRun(ctx context.Context, db *sqlx.DB, run *SyncRun, runErr error) error {
+	now := time.Now()
+	run.FinishedAt = &now
+	// Throughput de escritura: filas insertadas o actualizadas por segundo
+	if elapsed := now.Sub(run.StartedAt).Seconds(); elapsed > 0 {
+		rate := float64(run.RowsInserted+run.RowsUpdated) / elapsed
+		run.RowsPerSecond = &rate
+	}
+	run.Status = RunSucceeded
+	run.Error = nil
+	if runErr != nil {
+		message := runErr.Error()
+		run.Status = RunFailed
+		if errors.Is(runErr, context.Canceled) {
+			run.Status = RunInterrupted
+		}
+		run.Error = &message
+		// Un lote fallido ya dejó su clasificación; si no, se clasifica runErr
+		if run.ErrorClass == nil {
+			run.RecordError(runErr)
+		}
+	}
+
+	err := RunInTx(ctx, db, func(tx *sqlx.Tx) error {
+		_, err := tx.NamedExecContext(ctx, `
+			UPDATE sync_runs SET
+				status = :status,
+				finished_at = :finished_at,
+				pages_fetched = :pages_fetched,
+				rows_inserted = :rows_inserted,
+				rows_updated = :rows_updated,
+				rows_failed = :rows_failed,
+				retries = :retries,
+				error = :error,
+				error_code = :error_code,
+				error_class = :error_class,
+				rows_copied = :rows_copied,
+				rows_per_second = :rows_per_second,
+				rows_skipped = :rows_skipped
+			WHERE id = :id`, run)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error actualizando ejecución %s: %v", run.ID, err)
+	}
+	return nil
+}
+
+// ListSyncRuns devuelve las ejecuciones más recientes primero
+func ListSyncRuns(ctx context.Context, db *sqlx.DB, offset, limit int) ([]SyncRun, error) {
+	runs := []SyncRun{}
+	err := db.SelectContext(ctx, &runs, `
+		SELECT `+syncRunColumns+` FROM sync_runs
+		ORDER BY started_at DESC OFFSET $1 LIMIT $2`, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// LastSyncRuns devuelve la ejecución más reciente de cada fuente, ordenadas
+// por fuente
+func LastSyncRuns(ctx context.Context, db *sqlx.DB) ([]SyncRun, error) {
+	runs := []SyncRun{}
+	err := db.SelectContext(ctx, &runs, `
+		SELECT DISTINCT ON (source) `+syncRunColumns+` FROM sync_runs
+		ORDER BY source, started_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// CountSyncRuns devuelve el total de ejecuciones registradas
+func CountSyncRuns(ctx context.Context, db *sqlx.DB) (int, error) {
+	var total int
+	err := db.GetContext(ctx, &total, `SELECT COUNT(*) FROM sync_runs`)
+	return total, err
+}
+
+// GetSyncRun busca una ejecución por id; devuelve nil si no existe
+func GetSyncRun(ctx context.Context, db *sqlx.DB, id string) (*SyncRun, error) {
+	var run SyncRun
+	err := db.GetContext(ctx, &run, `SELECT `+syncRunColumns+` FROM sync_runs WHERE id = $1`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
@@ -0,0 +1,188 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Dialect es el motor SQL al que está conectada la base de datos
+type Dialect string
+
+const (
+	DialectCockroach Dialect = "cockroach"
+	DialectPostgres  Dialect = "postgres"
+)
+
+// dialects guarda el dialecto detectado por cada conexión (*sqlx.DB)
+var dialects sync.Map
+
+// DetectDialect consulta version() una vez por conexión para saber si el
+// servidor es CockroachDB o PostgreSQL
+func DetectDialect(ctx context.Context, db *sqlx.DB) (Dialect, error) {
+	if dialect, ok := dialects.Load(db); ok {
+		return dialect.(Dialect), nil
+	}
+
+	var version string
+	if err := db.GetContext(ctx, &version, `SELECT version()`); err != nil {
+		return "", fmt.Errorf("error detectando el motor de base de datos: %w", err)
+	}
+
+	dialect := DialectPostgres
+	if strings.Contains(version, "CockroachDB") {
+		dialect = DialectCockroach
+	}
+	dialects.Store(db, dialect)
+	return dialect, nil
+}
+
+// TxOptions ajusta los reintentos de RunInTxWithOptions
+type TxOptions struct {
+	// MaxRetries es el máximo de reintentos por conflicto (por defecto 10)
+	MaxRetries int
+	// OnRetry se llama antes de cada reintento con el número de reintento
+	// (desde 1) y el error que lo provocó
+	OnRetry func(retry int, err error)
+}
+
+const defaultTxRetries = 10
+
+// cockroachSavepoint es el savepoint especial con el que CockroachDB
+// reinicia una transacción sin perder su prioridad
+const cockroachSavepoint = "cockroach_restart"
+
+// RunInTx ejecuta fn en una transacción serializable y la repite mientras
+// falle por conflictos de serialización. fn puede ejecutarse varias veces,
+// así que no debe acumular estado fuera de la transacción entre intentos.
+func RunInTx(ctx context.Context, db *sqlx.DB, fn func(tx *sqlx.Tx) error) error {
+	return RunInTxWithOptions(ctx, db, TxOptions{}, fn)
+}
+
+// RunInTxWithOptions es RunInTx con límite de reintentos y aviso de cada
+// reintento. En CockroachDB usa el protocolo SAVEPOINT cockroach_restart; en
+// PostgreSQL abre una transacción nueva en cada intento.
+func RunInTxWithOptions(ctx context.Context, db *sqlx.DB, opts TxOptions, fn func(tx *sqlx.Tx) error) error {
+	if opts.MaxRetries <= 0 {
+		opts.MaxRetries = defaultTxRetries
+	}
+
+	dialect, err := DetectDialect(ctx, db)
+	if err != nil {
+		return err
+	}
+	if dialect == DialectCockroach {
+		return runCockroachTx(ctx, db, opts, fn)
+	}
+	return runPostgresTx(ctx, db, opts, fn)
+}
+
+// runCockroachTx implementa el reintento del lado del cliente de CockroachDB:
+// ante un 40001 vuelve al savepoint y repite fn dentro de la misma transacción
+func runCockroachTx(ctx context.Context, db *sqlx.DB, opts TxOptions, fn func(tx *sqlx.Tx) error) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error iniciando transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT "+cockroachSavepoint); err != nil {
+		return fmt.Errorf("error creando savepoint: %w", err)
+	}
+
+	for retry := 0; ; retry++ {
+		err := fn(tx)
+		if err == nil {
+			// RELEASE es el commit real en CockroachDB; puede fallar con 40001
+			_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT "+cockroachSavepoint)
+			if err == nil {
+				if err := tx.Commit(); err != nil {
+					return fmt.Errorf("error confirmando transacción: %w", err)
+				}
+				return nil
+			}
+		}
+
+		if !isSerializationFailure(err) || retry >= opts.MaxRetries {
+			return err
+		}
+		if opts.OnRetry != nil {
+			opts.OnRetry(retry+1, err)
+		}
+		if _, rollbackErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+cockroachSavepoint); rollbackErr != nil {
+			return fmt.Errorf("error volviendo al savepoint: %w", rollbackErr)
+		}
+	}
+}
+
+// runPostgresTx repite la transacción completa con nivel SERIALIZABLE
+// mientras falle por serialización o deadlock
+func runPostgresTx(ctx context.Context, db *sqlx.DB, opts TxOptions, fn func(tx *sqlx.Tx) error) error {
+	for retry := 0; ; retry++ {
+		err := runPostgresAttempt(ctx, db, fn)
+		if err == nil {
+			return nil
+		}
+
+		decision := ClassifyError(err)
+		if decision.Class != ErrorRetryable || !isConflictCode(decision.Code) || retry >= opts.MaxRetries {
+			return err
+		}
+		if opts.OnRetry != nil {
+			opts.OnRetry(retry+1, err)
+		}
+		if err := sleepContext(ctx, txBackoff(retry)); err != nil {
+			return err
+		}
+	}
+}
+
+func runPostgresAttempt(ctx context.Context, db *sqlx.DB, fn func(tx *sqlx.Tx) error) error {
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return fmt.Errorf("error iniciando transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error confirmando transacción: %w", err)
+	}
+	return nil
+}
+
+// isSerializationFailure indica si err es un 40001 (reiniciar la transacción)
+func isSerializationFailure(err error) bool {
+	return ClassifyError(err).Code == "40001"
+}
+
+// isConflictCode indica si el SQLSTATE es un conflicto entre transacciones
+// que se resuelve repitiendo la transacción completa
+func isConflictCode(code string) bool {
+	return code == "40001" || code == "40P01"
+}
+
+// txBackoff es una espera exponencial corta con jitter entre reintentos
+func txBackoff(retry int) time.Duration {
+	base := time.Duration(1<<min(retry, 6)) * 10 * time.Millisecond
+	return base + time.Duration(rand.Int63n(int64(base)))
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,30 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestTxRetryDecision verifica qué errores repiten la transacción completa
+func TestTxRetryDecision(t *testing.T) {
+	assert.True(t, isSerializationFailure(&pq.Error{Code: "40001"}))
+	assert.False(t, isSerializationFailure(&pq.Error{Code: "40P01"}))
+
+	assert.True(t, isConflictCode("40001"))
+	assert.True(t, isConflictCode("40P01"))
+	assert.False(t, isConflictCode("57P01"))
+	assert.False(t, isConflictCode(""))
+}
+
+// TestTxBackoff verifica que la espera crezca y quede acotada
+func TestTxBackoff(t *testing.T) {
+	for retry := 0; retry < 20; retry++ {
+		base := time.Duration(1<<min(retry, 6)) * 10 * time.Millisecond
+		backoff := txBackoff(retry)
+		assert.GreaterOrEqual(t, backoff, base)
+		assert.Less(t, backoff, 2*base)
+	}
+}
@@ -0,0 +1,53 @@
+package store
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/JuanVel1/stock-api/domain"
+)
+
+// UnmappedValue es un rating o acción presente en rating_events que no está en el vocabulario
+type UnmappedValue struct {
+	Kind     string `db:"kind" json:"kind"`
+	RawValue string `db:"raw_value" json:"raw_value"`
+	Count    int    `db:"count" json:"count"`
+}
+
+// LoadVocabulary lee la tabla vocabulary; si está vacía usa domain.DefaultMappings
+func LoadVocabulary(ctx context.Context, db *sqlx.DB) (*domain.Vocabulary, error) {
+	var mappings []domain.Mapping
+	err := db.SelectContext(ctx, &mappings, `SELECT kind, raw_value, canonical, level FROM vocabulary`)
+	if err != nil {
+		return nil, err
+	}
+	if len(mappings) == 0 {
+		return domain.DefaultVocabulary(), nil
+	}
+	return domain.NewVocabulary(mappings), nil
+}
+
+// ListUnmappedValues devuelve los ratings y acciones guardados que no tienen
+// traducción, los más frecuentes primero
+func ListUnmappedValues(ctx context.Context, db *sqlx.DB) ([]UnmappedValue, error) {
+	values := []UnmappedValue{}
+	err := db.SelectContext(ctx, &values, `
+		WITH terms AS (
+			SELECT 'rating' AS kind, rating_from AS raw_value FROM rating_events
+			UNION ALL
+			SELECT 'rating', rating_to FROM rating_events
+			UNION ALL
+			SELECT 'action', action FROM rating_events
+		)
+		SELECT t.kind, t.raw_value, count(*) AS count
+		FROM terms t
+		WHERE COALESCE(trim(t.raw_value), '') <> ''
+		  AND NOT EXISTS (
+			SELECT 1 FROM vocabulary v
+			WHERE v.kind = t.kind AND v.raw_value = lower(trim(t.raw_value))
+		  )
+		GROUP BY t.kind, t.raw_value
+		ORDER BY count DESC, t.kind, t.raw_value`)
+	return values, err
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/JuanVel1/stock-api/store"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// getSyncRuns devuelve el historial de ejecuciones del proceso save, paginado
+// igual que /api/stocks
+func getSyncRuns(c *gin.Context) {
+	nextNum := 0
+	limitNum := 20
+
+	if n, err := strconv.Atoi(c.DefaultQuery("next", "0")); err == nil && n >= 0 {
+		nextNum = n
+	}
+	if l, err := strconv.Atoi(c.DefaultQuery("limit", "20")); err == nil && l > 0 && l <= 100 {
+		limitNum = l
+	}
+
+	total, err := store.CountSyncRuns(c.Request.Context(), db)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	runs, err := store.ListSyncRuns(c.Request.Context(), db, nextNum, limitNum)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"data": runs,
+		"pagination": gin.H{
+			"current_offset": nextNum,
+			"per_page":       limitNum,
+			"total":          total,
+			"has_more":       (nextNum + limitNum) < total,
+			"next_offset":    nextNum + limitNum,
+		},
+	})
+}
+
+// getSyncRun devuelve una ejecución por id
+func getSyncRun(c *gin.Context) {
+	id := c.Param("id")
+	if !uuidPattern.MatchString(id) {
+		c.JSON(400, gin.H{"error": "id de ejecución inválido"})
+		return
+	}
+
+	run, err := store.GetSyncRun(c.Request.Context(), db, id)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	if run == nil {
+		c.JSON(404, gin.H{"error": "ejecución no encontrada"})
+		return
+	}
+
+	c.JSON(200, run)
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/JuanVel1/stock-api/store"
+)
+
+// getUnmappedVocabulary lista los ratings y acciones guardados que no están
+// en la tabla vocabulary, con la cantidad de registros que los usan
+func getUnmappedVocabulary(c *gin.Context) {
+	values, err := store.ListUnmappedValues(c.Request.Context(), db)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"data": values})
+}